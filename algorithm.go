@@ -1,8 +1,6 @@
 package xy3
 
 import (
-	"strings"
-
 	"github.com/nguyengg/xy3/archive"
 	"github.com/nguyengg/xy3/codec"
 )
@@ -11,57 +9,47 @@ import (
 const DefaultAlgorithmName = "zstd"
 
 // NewCompressorFromName returns a compressor with the given algorithm name.
+//
+// The algorithm name can be the name or extension of a codec registered with codec.Register (e.g. "zstd", "gzip",
+// "gz"), in which case the compressor creates tar archives compressed with that codec. Otherwise, the name can be
+// that of an archiver registered with archive.Register that can create archives (e.g. "zip", "tar"). Returns nil if
+// there is no match.
 func NewCompressorFromName(algorithmName string) archive.Archiver {
-	switch algorithmName {
-	case "gzip", "gz":
-		return &archive.Tar{Codec: &codec.GzipCodec{}}
-	case "zip":
-		return &archive.Zip{}
-	case "zstd":
-		return &archive.Tar{Codec: &codec.ZstdCodec{}}
-	case "xz":
-		return &archive.Tar{Codec: &codec.XzCodec{}}
-	default:
-		return nil
+	if c := codec.New(algorithmName); c != nil {
+		return &archive.Tar{Codec: c}
+	}
+
+	if arc := archive.New(algorithmName); arc != nil && archive.CanCreate(arc) {
+		return arc
+	}
+
+	return nil
+}
+
+// CompressorNames returns the names of all algorithms that NewCompressorFromName accepts.
+//
+// Extension aliases (e.g. "gz") are not included.
+func CompressorNames() []string {
+	names := codec.Names()
+	for _, name := range archive.Names() {
+		if archive.CanCreate(archive.New(name)) {
+			names = append(names, name)
+		}
 	}
+
+	return names
 }
 
 // NewDecompressorFromName returns a decompressor for extracting from an archive with the given name.
 //
-// TODO use http.DetectContentType() instead of relying on file extension.
+// See archive.NewFromName.
 func NewDecompressorFromName(name string) archive.Archiver {
-	switch {
-	case strings.HasSuffix(name, ".tar"):
-		return &archive.Tar{}
-	case strings.HasSuffix(name, ".tar.gz"):
-		return &archive.Tar{Codec: &codec.GzipCodec{}}
-	case strings.HasSuffix(name, ".tar.xz"):
-		return &archive.Tar{Codec: &codec.XzCodec{}}
-	case strings.HasSuffix(name, ".tar.zst"):
-		return &archive.Tar{Codec: &codec.ZstdCodec{}}
-	case strings.HasSuffix(name, ".7z"):
-		return &archive.SevenZip{}
-	case strings.HasSuffix(name, ".rar"):
-		return &archive.Rar{}
-	case strings.HasSuffix(name, ".zip"):
-		return &archive.Zip{}
-	default:
-		return nil
-	}
+	return archive.NewFromName(name)
 }
 
 // NewDecoderFromExt returns a decoder for decompressing from files with the given file name extension.
 //
-// TODO use http.DetectContentType() instead of relying on file extension.
+// See codec.NewFromExt.
 func NewDecoderFromExt(ext string) codec.Codec {
-	switch ext {
-	case ".gz":
-		return &codec.GzipCodec{}
-	case ".xz":
-		return &codec.XzCodec{}
-	case ".zst":
-		return &codec.ZstdCodec{}
-	default:
-		return nil
-	}
+	return codec.NewFromExt(ext)
 }
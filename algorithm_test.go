@@ -5,6 +5,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/nguyengg/xy3/archive"
+	"github.com/nguyengg/xy3/codec"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -100,3 +102,30 @@ func TestNewDecoderFromExt(t *testing.T) {
 		})
 	}
 }
+
+func TestNewCompressorFromName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected archive.Archiver
+	}{
+		{name: "zstd", expected: &archive.Tar{Codec: &codec.ZstdCodec{}}},
+		{name: "zst", expected: &archive.Tar{Codec: &codec.ZstdCodec{}}},
+		{name: "gzip", expected: &archive.Tar{Codec: &codec.GzipCodec{}}},
+		{name: "gz", expected: &archive.Tar{Codec: &codec.GzipCodec{}}},
+		{name: "xz", expected: &archive.Tar{Codec: &codec.XzCodec{}}},
+		{name: "zip", expected: &archive.Zip{}},
+		{name: "tar", expected: &archive.Tar{}},
+		// read-only archivers cannot be used to compress.
+		{name: "7z", expected: nil},
+		{name: "rar", expected: nil},
+		{name: "bzip2", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewCompressorFromName(tt.name))
+		})
+	}
+
+	assert.Equal(t, []string{"zstd", "gzip", "xz", "zip", "tar"}, CompressorNames())
+}
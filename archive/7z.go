@@ -13,26 +13,41 @@ import (
 type SevenZip struct {
 }
 
-var _ Archiver = SevenZip{}
+var _ ReadOnlyArchiver = SevenZip{}
 
 func (s SevenZip) Create(_ io.Writer, _ string) (AddFunction, CloseFunction, error) {
 	panic("not implemented")
 }
 
+func (s SevenZip) ReadOnly() bool {
+	return true
+}
+
 func (s SevenZip) Open(src io.Reader) (iter.Seq2[File, error], error) {
-	f, ok := src.(*os.File)
-	if !ok {
-		return nil, fmt.Errorf("7z archives must be opened as os.File")
-	}
+	var (
+		zr  *sevenzip.Reader
+		err error
+	)
 
-	fi, err := f.Stat()
-	if err != nil {
-		return nil, fmt.Errorf(`stat file "%s" error: %w`, f.Name(), err)
-	}
+	switch r := src.(type) {
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil {
+			return nil, fmt.Errorf(`stat file "%s" error: %w`, r.Name(), err)
+		}
+
+		if zr, err = sevenzip.NewReader(r, fi.Size()); err != nil {
+			return nil, fmt.Errorf(`open 7z file "%s" error: %w`, r.Name(), err)
+		}
+
+	case sizedReaderAt:
+		// s3reader.Reader is one such implementation.
+		if zr, err = sevenzip.NewReader(r, r.Size()); err != nil {
+			return nil, fmt.Errorf("open 7z archive error: %w", err)
+		}
 
-	zr, err := sevenzip.NewReader(f, fi.Size())
-	if err != nil {
-		return nil, fmt.Errorf(`open 7z file "%s" error: %w`, f.Name(), err)
+	default:
+		return nil, fmt.Errorf("7z archives must be opened as os.File or io.ReaderAt with known size")
 	}
 
 	return func(yield func(File, error) bool) {
@@ -48,7 +63,7 @@ func (s SevenZip) Open(src io.Reader) (iter.Seq2[File, error], error) {
 }
 
 func (s SevenZip) ArchiveExt() string {
-	return "7z"
+	return ".7z"
 }
 
 func (s SevenZip) ContentType() string {
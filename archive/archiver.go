@@ -41,6 +41,12 @@ type AddFunction func(path string, fi os.FileInfo) (io.WriteCloser, error)
 // CloseFunction closes the writer.
 type CloseFunction func() error
 
+// sizedReaderAt is an io.ReaderAt that knows its own size, such as s3reader.Reader.
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
 // File represents a file in an archive.
 //
 // The interface intentionally matches that of zip.File for simplicity.
@@ -0,0 +1,541 @@
+package archive
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nguyengg/xy3/codec"
+)
+
+// ErrUnknownFormat is returned by Detect and FS if the archive format cannot be detected.
+var ErrUnknownFormat = errors.New("unknown archive format")
+
+// Detect sniffs the magic bytes at the start of src to return an Archiver that can open it.
+//
+// The magic bytes of the registered archivers (see Register) are checked first, followed by those of the registered
+// codecs (see codec.Register) which are assumed to be compressed tar archives, and finally uncompressed tar. As a
+// result, Detect cannot tell a compressed tar archive apart from any other compressed file.
+func Detect(src io.ReaderAt) (Archiver, error) {
+	header := make([]byte, 512)
+	n, err := src.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("read archive header error: %w", err)
+	}
+	header = header[:n]
+
+	if arc := detect(header); arc != nil {
+		return arc, nil
+	}
+
+	if c := codec.Detect(header); c != nil {
+		return &Tar{Codec: c}, nil
+	}
+
+	if len(header) >= 262 && string(header[257:262]) == "ustar" {
+		return &Tar{}, nil
+	}
+
+	return nil, ErrUnknownFormat
+}
+
+// FileSystem is the fs.FS returned by FS.
+type FileSystem interface {
+	fs.ReadDirFS
+	fs.StatFS
+}
+
+// FSOptions customises FS.
+type FSOptions struct {
+	// Size is the size of the archive.
+	//
+	// Required unless src is an *os.File or has a `Size() int64` method (e.g. io.SectionReader, bytes.Reader, and
+	// s3reader.Reader).
+	Size int64
+
+	// Archiver if given will be used to read the archive instead of detecting the format with Detect.
+	Archiver Archiver
+}
+
+// FS returns a read-only file system view over the archive read from src.
+//
+// FS reads the archive once to build an index of its files. Directories that don't have their own entries in the
+// archive are synthesised from the file paths. Only regular files and directories are included; symlinks and other
+// file types are skipped.
+//
+// How files are opened depends on the archive format:
+//   - zip and 7z support random access so opening a file reads directly from its offset.
+//   - Uncompressed tar files are indexed by the offsets of their contents so opening a file also reads directly from
+//     its offset.
+//   - Compressed tar (e.g. tar.gz, tar.zst) and rar archives can only be read sequentially so opening a file scans
+//     the archive again from the start until the file is found. Avoid opening many files from these archives.
+//
+// All files returned by FileSystem.Open implement io.Seeker so that the file system can be used with
+// http.FileServerFS. Seeking backwards in files that don't support random access reopens the file, so it should be
+// used sparingly.
+func FS(src io.ReaderAt, optFns ...func(*FSOptions)) (FileSystem, error) {
+	opts := &FSOptions{Size: -1}
+	switch r := src.(type) {
+	case *os.File:
+		fi, err := r.Stat()
+		if err != nil {
+			return nil, fmt.Errorf(`stat file "%s" error: %w`, r.Name(), err)
+		}
+		opts.Size = fi.Size()
+	case sizedReaderAt:
+		opts.Size = r.Size()
+	}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	if opts.Size < 0 {
+		return nil, fmt.Errorf("archive size must be given")
+	}
+
+	arc := opts.Archiver
+	if arc == nil {
+		var err error
+		if arc, err = Detect(src); err != nil {
+			return nil, err
+		}
+	}
+
+	fsys := &archiveFS{nodes: map[string]*fsNode{
+		".": {name: ".", fi: &fsFileInfo{name: ".", mode: fs.ModeDir | 0555}},
+	}}
+
+	var err error
+	switch a := arc.(type) {
+	case Zip, *Zip, SevenZip, *SevenZip:
+		err = fsys.indexRandomAccess(io.NewSectionReader(src, 0, opts.Size), a)
+	case *Tar:
+		if a.Codec == nil {
+			err = fsys.indexTar(src, opts.Size)
+		} else {
+			err = fsys.indexSequential(src, opts.Size, a)
+		}
+	default:
+		err = fsys.indexSequential(src, opts.Size, a)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, n := range fsys.nodes {
+		slices.SortFunc(n.children, func(a, b *fsNode) int { return strings.Compare(a.fi.name, b.fi.name) })
+	}
+
+	return fsys, nil
+}
+
+// indexRandomAccess is used for archives whose File.Open remains valid after the iteration is over.
+func (fsys *archiveFS) indexRandomAccess(src *io.SectionReader, arc Archiver) error {
+	files, err := arc.Open(src)
+	if err != nil {
+		return fmt.Errorf("read archive error: %w", err)
+	}
+
+	for f, err := range files {
+		if err != nil {
+			return fmt.Errorf("read archive error: %w", err)
+		}
+
+		fsys.add(f.Name(), f.FileInfo(), f.Open)
+	}
+
+	return nil
+}
+
+// indexTar records the offsets of the contents of every file in an uncompressed tar archive.
+func (fsys *archiveFS) indexTar(src io.ReaderAt, size int64) error {
+	// tar.Reader will seek past the file contents because io.SectionReader is also an io.Seeker.
+	sr := io.NewSectionReader(src, 0, size)
+	tr := tar.NewReader(sr)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar header error: %w", err)
+		}
+
+		offset, err := sr.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return fmt.Errorf("read tar header error: %w", err)
+		}
+
+		contentSize := hdr.Size
+		fsys.add(hdr.Name, hdr.FileInfo(), func() (io.ReadCloser, error) {
+			return &sectionReadCloser{io.NewSectionReader(src, offset, contentSize)}, nil
+		})
+	}
+}
+
+// indexSequential is used for archives that can only be read sequentially.
+//
+// Opening the i-th file will open the archive again and skip the first i-1 files.
+func (fsys *archiveFS) indexSequential(src io.ReaderAt, size int64, arc Archiver) error {
+	files, err := arc.Open(io.NewSectionReader(src, 0, size))
+	if err != nil {
+		return fmt.Errorf("read archive error: %w", err)
+	}
+
+	i := 0
+	for f, err := range files {
+		if err != nil {
+			return fmt.Errorf("read archive error: %w", err)
+		}
+
+		index := i
+		fsys.add(f.Name(), f.FileInfo(), func() (io.ReadCloser, error) {
+			files, err := arc.Open(io.NewSectionReader(src, 0, size))
+			if err != nil {
+				return nil, err
+			}
+
+			// iter.Pull2 keeps the iterator (and its decoder) alive until the returned io.ReadCloser is closed.
+			next, stop := iter.Pull2(files)
+			for j := 0; ; j++ {
+				f, err, ok := next()
+				switch {
+				case !ok:
+					stop()
+					return nil, io.ErrUnexpectedEOF
+				case err != nil:
+					stop()
+					return nil, err
+				case j < index:
+					continue
+				}
+
+				r, err := f.Open()
+				if err != nil {
+					stop()
+					return nil, err
+				}
+
+				return &pullReadCloser{Reader: r, close: func() error {
+					err := r.Close()
+					stop()
+					return err
+				}}, nil
+			}
+		})
+		i++
+	}
+
+	return nil
+}
+
+// add creates the node for the given archive file as well as any missing parent directories.
+func (fsys *archiveFS) add(name string, fi fs.FileInfo, open func() (io.ReadCloser, error)) {
+	isDir := fi.IsDir() || strings.HasSuffix(name, "/")
+	if !isDir && !fi.Mode().IsRegular() {
+		return
+	}
+
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+	if name == "" {
+		return
+	}
+
+	n := fsys.mkdirAll(path.Dir(name))
+
+	info := &fsFileInfo{
+		name:    path.Base(name),
+		size:    fi.Size(),
+		mode:    fi.Mode().Perm(),
+		modTime: fi.ModTime(),
+		sys:     fi.Sys(),
+	}
+	if isDir {
+		info.size = 0
+		info.mode |= fs.ModeDir
+	}
+
+	if existing, ok := fsys.nodes[name]; ok {
+		// a directory that was previously synthesised (or a duplicate entry) is replaced with this entry.
+		existing.fi = info
+		if !isDir {
+			existing.open = open
+		}
+		return
+	}
+
+	child := &fsNode{name: name, fi: info}
+	if !isDir {
+		child.open = open
+	}
+	fsys.nodes[name] = child
+	n.children = append(n.children, child)
+}
+
+// mkdirAll returns the directory node with the given name, creating it and its parents if necessary.
+func (fsys *archiveFS) mkdirAll(name string) *fsNode {
+	if n, ok := fsys.nodes[name]; ok {
+		return n
+	}
+
+	parent := fsys.mkdirAll(path.Dir(name))
+	n := &fsNode{name: name, fi: &fsFileInfo{name: path.Base(name), mode: fs.ModeDir | 0555}}
+	fsys.nodes[name] = n
+	parent.children = append(parent.children, n)
+	return n
+}
+
+type archiveFS struct {
+	nodes map[string]*fsNode
+}
+
+var _ FileSystem = &archiveFS{}
+
+func (fsys *archiveFS) lookup(op, name string) (*fsNode, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	n, ok := fsys.nodes[name]
+	if !ok {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+
+	return n, nil
+}
+
+func (fsys *archiveFS) Open(name string) (fs.File, error) {
+	n, err := fsys.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.fi.IsDir() {
+		return &fsDir{node: n}, nil
+	}
+
+	return &fsFile{node: n}, nil
+}
+
+func (fsys *archiveFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	n, err := fsys.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if !n.fi.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+	}
+
+	return n.entries(), nil
+}
+
+func (fsys *archiveFS) Stat(name string) (fs.FileInfo, error) {
+	n, err := fsys.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+
+	return n.fi, nil
+}
+
+type fsNode struct {
+	name     string
+	fi       *fsFileInfo
+	children []*fsNode
+	open     func() (io.ReadCloser, error)
+}
+
+func (n *fsNode) entries() []fs.DirEntry {
+	entries := make([]fs.DirEntry, len(n.children))
+	for i, c := range n.children {
+		entries[i] = fs.FileInfoToDirEntry(c.fi)
+	}
+
+	return entries
+}
+
+// fsFile is a regular file in the archive.
+//
+// The file's content is not opened until the first Read or Seek.
+type fsFile struct {
+	node *fsNode
+	r    io.ReadCloser
+	off  int64
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return f.node.fi, nil
+}
+
+func (f *fsFile) Read(p []byte) (n int, err error) {
+	// some decoders (e.g. rardecode) never return from reading into an empty buffer.
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if f.r == nil {
+		if f.r, err = f.node.open(); err != nil {
+			return 0, &fs.PathError{Op: "read", Path: f.node.name, Err: err}
+		}
+	}
+
+	n, err = f.r.Read(p)
+	f.off += int64(n)
+	return n, err
+}
+
+func (f *fsFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		offset += f.node.fi.size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: fs.ErrInvalid}
+	}
+
+	var err error
+	if f.r == nil {
+		if f.r, err = f.node.open(); err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: err}
+		}
+	}
+
+	if s, ok := f.r.(io.Seeker); ok {
+		if f.off, err = s.Seek(offset, io.SeekStart); err != nil {
+			return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: err}
+		}
+
+		return f.off, nil
+	}
+
+	// seeking backwards requires reopening the file.
+	if offset < f.off {
+		_ = f.r.Close()
+		f.off = 0
+		if f.r, err = f.node.open(); err != nil {
+			f.r = nil
+			return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: err}
+		}
+	}
+
+	// seeking forwards discards the contents in between; seeking past the end is allowed.
+	if _, err = io.CopyN(io.Discard, f.r, offset-f.off); err != nil && !errors.Is(err, io.EOF) {
+		return 0, &fs.PathError{Op: "seek", Path: f.node.name, Err: err}
+	}
+
+	f.off = offset
+	return f.off, nil
+}
+
+func (f *fsFile) Close() error {
+	if f.r == nil {
+		return nil
+	}
+
+	err := f.r.Close()
+	f.r = nil
+	return err
+}
+
+// fsDir is a directory in the archive.
+type fsDir struct {
+	node    *fsNode
+	entries []fs.DirEntry
+	off     int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return d.node.fi, nil
+}
+
+func (d *fsDir) Read(_ []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.node.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) ReadDir(count int) ([]fs.DirEntry, error) {
+	if d.entries == nil {
+		d.entries = d.node.entries()
+	}
+
+	n := len(d.entries) - d.off
+	if n == 0 && count > 0 {
+		return nil, io.EOF
+	}
+	if count > 0 && n > count {
+		n = count
+	}
+
+	entries := d.entries[d.off : d.off+n]
+	d.off += n
+	return entries, nil
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+type fsFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     any
+}
+
+var _ fs.FileInfo = &fsFileInfo{}
+
+func (fi *fsFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fsFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fsFileInfo) Mode() fs.FileMode {
+	return fi.mode
+}
+
+func (fi *fsFileInfo) ModTime() time.Time {
+	return fi.modTime
+}
+
+func (fi *fsFileInfo) IsDir() bool {
+	return fi.mode.IsDir()
+}
+
+func (fi *fsFileInfo) Sys() any {
+	return fi.sys
+}
+
+type sectionReadCloser struct {
+	*io.SectionReader
+}
+
+func (r *sectionReadCloser) Close() error {
+	return nil
+}
+
+type pullReadCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *pullReadCloser) Close() error {
+	return r.close()
+}
@@ -0,0 +1,90 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"testing"
+	"testing/fstest"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFS(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		expected []string
+	}{
+		{
+			name:     "zip",
+			file:     "../testdata/test.zip",
+			expected: []string{"test.txt"},
+		},
+		{
+			name:     "7z",
+			file:     "../testdata/test.7z",
+			expected: []string{"test.txt"},
+		},
+		{
+			name:     "rar",
+			file:     "../testdata/test.rar",
+			expected: []string{"test.txt"},
+		},
+		{
+			name:     "tar.gz",
+			file:     "../testdata/test.tar.gz",
+			expected: []string{"test.txt"},
+		},
+		{
+			name:     "tar.xz",
+			file:     "../testdata/test.tar.xz",
+			expected: []string{"test.txt"},
+		},
+		{
+			name:     "tar.zst",
+			file:     "../testdata/test.tar.zst",
+			expected: []string{"test.txt"},
+		},
+		{
+			// this zip file has no directory entries so they must be synthesised.
+			name:     "zip with nested directories",
+			file:     "../zipper/testdata/default.zip",
+			expected: []string{"test/a.txt", "test/path/b.txt", "test/another/path/c.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := os.Open(tt.file)
+			assert.NoError(t, err)
+			defer src.Close()
+
+			fsys, err := FS(src)
+			assert.NoError(t, err)
+			assert.NoError(t, fstest.TestFS(fsys, tt.expected...))
+		})
+	}
+}
+
+func TestFS_tar(t *testing.T) {
+	// create an uncompressed tar in memory from testdata/test.tar.gz.
+	src, err := os.Open("../testdata/test.tar.gz")
+	assert.NoError(t, err)
+	defer src.Close()
+
+	r, err := (&codec.GzipCodec{}).NewDecoder(src)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+
+	fsys, err := FS(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.NoError(t, fstest.TestFS(fsys, "test.txt"))
+
+	content, err := fs.ReadFile(fsys, "test.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, "Mr. Jock, TV quiz PhD, bags few lynx\n", string(content))
+}
@@ -13,12 +13,16 @@ import (
 type Rar struct {
 }
 
-var _ Archiver = Rar{}
+var _ ReadOnlyArchiver = Rar{}
 
 func (r Rar) Create(_ io.Writer, _ string) (AddFunction, CloseFunction, error) {
 	panic("not implemented")
 }
 
+func (r Rar) ReadOnly() bool {
+	return true
+}
+
 func (r Rar) Open(src io.Reader) (iter.Seq2[File, error], error) {
 	if f, ok := src.(*os.File); ok {
 		if rr, err := rardecode.OpenReader(f.Name()); err == nil {
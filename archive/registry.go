@@ -0,0 +1,130 @@
+package archive
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/nguyengg/xy3/codec"
+)
+
+// Factory creates a new Archiver.
+type Factory func() Archiver
+
+// ReadOnlyArchiver is implemented by Archivers that can only open archives but not create them (e.g. SevenZip and
+// Rar).
+type ReadOnlyArchiver interface {
+	Archiver
+
+	// ReadOnly returns true if Archiver.Create is not supported.
+	ReadOnly() bool
+}
+
+// CanCreate returns false if the given Archiver is a ReadOnlyArchiver that cannot create archives.
+func CanCreate(arc Archiver) bool {
+	ro, ok := arc.(ReadOnlyArchiver)
+	return !ok || !ro.ReadOnly()
+}
+
+type registration struct {
+	name    string
+	exts    []string
+	magic   [][]byte
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+func init() {
+	Register("zip", []string{".zip"}, [][]byte{[]byte("PK\x03\x04"), []byte("PK\x05\x06")}, func() Archiver { return &Zip{} })
+	Register("tar", []string{".tar"}, nil, func() Archiver { return &Tar{} })
+	Register("7z", []string{".7z"}, [][]byte{[]byte("7z\xbc\xaf\x27\x1c")}, func() Archiver { return &SevenZip{} })
+	Register("rar", []string{".rar"}, [][]byte{[]byte("Rar!\x1a\x07")}, func() Archiver { return &Rar{} })
+}
+
+// Register makes an archive format available by its name, its file name extensions, and its magic bytes.
+//
+// The extensions must include the leading dot (e.g. ".zip"), and the magic bytes are matched against the start of the
+// archive. Either can be empty. Registering a name that has already been registered replaces the previous
+// registration, which allows the built-in archivers (zip, tar, 7z, and rar) to be replaced as well.
+//
+// Compressed tar archives don't need to be registered here; register their codecs with codec.Register instead.
+//
+// Register is safe for concurrent use, but is typically called from an init function.
+func Register(name string, exts []string, magic [][]byte, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	r := registration{name: name, exts: exts, magic: magic, factory: factory}
+	if i := slices.IndexFunc(registry, func(r registration) bool { return r.name == name }); i != -1 {
+		registry[i] = r
+	} else {
+		registry = append(registry, r)
+	}
+}
+
+// New returns a new Archiver registered with the given name or extension.
+//
+// The extension may be given with or without the leading dot so that "zip" and ".zip" both return a Zip. Returns nil
+// if there is no match.
+func New(name string) Archiver {
+	if arc := find(func(r registration) bool { return r.name == name }); arc != nil {
+		return arc
+	}
+
+	ext := "." + strings.TrimPrefix(name, ".")
+	return find(func(r registration) bool { return slices.Contains(r.exts, ext) })
+}
+
+// NewFromName returns a new Archiver that can open the archive with the given file name.
+//
+// Compressed tar archives are recognised by ".tar" followed by the extension of any registered codec (e.g.
+// ".tar.gz"). Returns nil if there is no match.
+func NewFromName(name string) Archiver {
+	if i := strings.LastIndex(name, ".tar."); i != -1 {
+		if c := codec.NewFromExt(name[i+len(".tar"):]); c != nil {
+			return &Tar{Codec: c}
+		}
+	}
+
+	return find(func(r registration) bool {
+		return slices.ContainsFunc(r.exts, func(ext string) bool { return strings.HasSuffix(name, ext) })
+	})
+}
+
+// Names returns the names of all registered archivers in the order they were registered.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, len(registry))
+	for i, r := range registry {
+		names[i] = r.name
+	}
+
+	return names
+}
+
+// detect returns a new Archiver whose magic bytes match the start of the given header.
+func detect(header []byte) Archiver {
+	return find(func(r registration) bool {
+		return slices.ContainsFunc(r.magic, func(magic []byte) bool {
+			return len(magic) != 0 && bytes.HasPrefix(header, magic)
+		})
+	})
+}
+
+func find(fn func(r registration) bool) Archiver {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if i := slices.IndexFunc(registry, fn); i != -1 {
+		return registry[i].factory()
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Archiver
+	}{
+		{name: "zip", expected: &Zip{}},
+		{name: ".zip", expected: &Zip{}},
+		{name: "tar", expected: &Tar{}},
+		{name: "7z", expected: &SevenZip{}},
+		{name: "rar", expected: &Rar{}},
+		{name: "gzip", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, New(tt.name))
+		})
+	}
+}
+
+func TestNewFromName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Archiver
+	}{
+		{name: "test.zip", expected: &Zip{}},
+		{name: "test.tar", expected: &Tar{}},
+		{name: "test.tar.gz", expected: &Tar{Codec: &codec.GzipCodec{}}},
+		{name: "test.tar.zst", expected: &Tar{Codec: &codec.ZstdCodec{}}},
+		{name: "test.tar.xz", expected: &Tar{Codec: &codec.XzCodec{}}},
+		{name: "test.7z", expected: &SevenZip{}},
+		{name: "test.rar", expected: &Rar{}},
+		{name: "test.txt.gz", expected: nil},
+		{name: "test.tar.bz2", expected: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, NewFromName(tt.name))
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	// a codec that stores contents as-is after a magic prefix.
+	codec.Register("test-identity", []string{".ident"}, [][]byte{[]byte("IDENT")}, func() codec.Codec { return identityCodec{} })
+
+	assert.Equal(t, identityCodec{}, codec.New("test-identity"))
+	assert.Equal(t, identityCodec{}, codec.New("ident"))
+	assert.Equal(t, &Tar{Codec: identityCodec{}}, NewFromName("test.tar.ident"))
+	assert.Contains(t, codec.Names(), "test-identity")
+
+	// a tar archive compressed with the new codec must be detected by its magic bytes.
+	var buf bytes.Buffer
+	add, closer, err := (&Tar{Codec: identityCodec{}}).Create(&buf, "")
+	assert.NoError(t, err)
+	w, err := add("a.txt", &fakeFileInfo{name: "a.txt", size: 5})
+	assert.NoError(t, err)
+	_, err = w.Write([]byte("hello"))
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.NoError(t, closer())
+
+	arc, err := Detect(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, &Tar{Codec: identityCodec{}}, arc)
+
+	// registering an existing name replaces its registration.
+	Register("test-archiver", []string{".a1"}, nil, func() Archiver { return &Zip{} })
+	Register("test-archiver", []string{".a2"}, nil, func() Archiver { return &Tar{} })
+	assert.Nil(t, NewFromName("test.a1"))
+	assert.Equal(t, &Tar{}, NewFromName("test.a2"))
+	assert.Equal(t, 1, countOf(Names(), "test-archiver"))
+}
+
+func TestCanCreate(t *testing.T) {
+	assert.True(t, CanCreate(&Zip{}))
+	assert.True(t, CanCreate(&Tar{}))
+	assert.False(t, CanCreate(&SevenZip{}))
+	assert.False(t, CanCreate(Rar{}))
+}
+
+func countOf(names []string, name string) (n int) {
+	for _, v := range names {
+		if v == name {
+			n++
+		}
+	}
+	return
+}
+
+type identityCodec struct{}
+
+func (identityCodec) NewDecoder(src io.Reader) (io.ReadCloser, error) {
+	magic := make([]byte, 5)
+	if _, err := io.ReadFull(src, magic); err != nil {
+		return nil, err
+	}
+
+	return io.NopCloser(src), nil
+}
+
+func (identityCodec) NewEncoder(dst io.Writer) (io.WriteCloser, error) {
+	if _, err := dst.Write([]byte("IDENT")); err != nil {
+		return nil, err
+	}
+
+	return &internal.WriteNoopCloser{Writer: dst}, nil
+}
+
+func (identityCodec) Ext() string {
+	return ".ident"
+}
+
+func (identityCodec) ContentType() string {
+	return "application/octet-stream"
+}
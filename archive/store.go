@@ -0,0 +1,212 @@
+package archive
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// StorePolicy decides whether a file should be stored in the archive as-is instead of being compressed.
+//
+// The name is the path of the file in the archive while header contains up to the first 512 bytes of the file's
+// content for sniffing.
+type StorePolicy func(name string, header []byte) bool
+
+// IncompressibleExts is the list of file name extensions that DefaultStorePolicy considers already compressed.
+var IncompressibleExts = []string{
+	// images.
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".heic", ".heif", ".avif", ".jxl",
+	// videos.
+	".mp4", ".m4v", ".mov", ".mkv", ".webm", ".avi", ".wmv", ".flv",
+	// audio.
+	".mp3", ".m4a", ".aac", ".ogg", ".oga", ".opus", ".flac", ".wma",
+	// archives and compressed files.
+	".zip", ".7z", ".rar", ".gz", ".tgz", ".bz2", ".xz", ".txz", ".zst", ".lz4", ".br", ".cab",
+	// formats that are zip archives underneath.
+	".jar", ".apk", ".docx", ".xlsx", ".pptx", ".odt", ".ods", ".odp", ".epub",
+	// fonts.
+	".woff", ".woff2",
+}
+
+// DefaultStorePolicy stores files whose extensions are in IncompressibleExts, or whose contents are sniffed to be
+// images, videos, audio, or archives that are already compressed.
+func DefaultStorePolicy(name string, header []byte) bool {
+	ext := strings.ToLower(path.Ext(name))
+	for _, e := range IncompressibleExts {
+		if ext == e {
+			return true
+		}
+	}
+
+	for _, magic := range incompressibleMagics {
+		if bytes.HasPrefix(header, magic) {
+			return true
+		}
+	}
+
+	switch contentType := http.DetectContentType(header); {
+	case contentType == "image/bmp", contentType == "image/x-icon":
+		// these images are usually uncompressed.
+		return false
+	case strings.HasPrefix(contentType, "image/"),
+		strings.HasPrefix(contentType, "video/"),
+		strings.HasPrefix(contentType, "audio/") && contentType != "audio/wave" && contentType != "audio/aiff",
+		contentType == "application/zip",
+		contentType == "application/x-gzip",
+		contentType == "application/x-rar-compressed",
+		contentType == "font/woff", contentType == "font/woff2":
+		return true
+	default:
+		return false
+	}
+}
+
+// incompressibleMagics are the magic bytes of compressed formats that http.DetectContentType does not recognise.
+var incompressibleMagics = [][]byte{
+	[]byte("7z\xbc\xaf\x27\x1c"),
+	[]byte("\xfd7zXZ\x00"),
+	[]byte("\x28\xb5\x2f\xfd"),
+	[]byte("BZh"),
+}
+
+// NeverStore is a StorePolicy that compresses every file.
+func NeverStore(_ string, _ []byte) bool {
+	return false
+}
+
+// AlwaysStore is a StorePolicy that stores every file without compression.
+func AlwaysStore(_ string, _ []byte) bool {
+	return true
+}
+
+// StoreStats collects statistics about files that are stored versus compressed according to StorePolicy.
+type StoreStats struct {
+	// StoredFiles is the number of files stored without compression.
+	StoredFiles int
+	// StoredBytes is the total size of files stored without compression.
+	StoredBytes int64
+	// CompressedFiles is the number of files compressed.
+	CompressedFiles int
+	// CompressedBytes is the total uncompressed size of files compressed.
+	CompressedBytes int64
+	// CompressDuration is the total time spent writing files that are compressed.
+	CompressDuration time.Duration
+}
+
+// Add adds the other stats to this instance.
+func (s *StoreStats) Add(other StoreStats) {
+	s.StoredFiles += other.StoredFiles
+	s.StoredBytes += other.StoredBytes
+	s.CompressedFiles += other.CompressedFiles
+	s.CompressedBytes += other.CompressedBytes
+	s.CompressDuration += other.CompressDuration
+}
+
+// EstimatedTimeSaved estimates how long it would have taken to compress the stored files.
+//
+// The estimate uses the throughput of the compressed files, so it is zero if no file was compressed.
+func (s *StoreStats) EstimatedTimeSaved() time.Duration {
+	if s.CompressedBytes == 0 {
+		return 0
+	}
+
+	return time.Duration(float64(s.StoredBytes) / float64(s.CompressedBytes) * float64(s.CompressDuration))
+}
+
+// sniffWriter buffers up to the first 512 bytes of a file so that StorePolicy can decide whether to store or compress
+// the file before any of its content is written.
+type sniffWriter struct {
+	name   string
+	policy StorePolicy
+	stats  *StoreStats
+
+	// start is called once the decision has been made to return the io.Writer to write the file's content to.
+	start func(store bool) (io.Writer, error)
+
+	header []byte
+	w      io.Writer
+	store  bool
+}
+
+func newSniffWriter(name string, policy StorePolicy, stats *StoreStats, start func(store bool) (io.Writer, error)) *sniffWriter {
+	if policy == nil {
+		policy = DefaultStorePolicy
+	}
+
+	return &sniffWriter{
+		name:   name,
+		policy: policy,
+		stats:  stats,
+		start:  start,
+		header: make([]byte, 0, 512),
+	}
+}
+
+func (s *sniffWriter) Write(p []byte) (n int, err error) {
+	if s.w == nil {
+		m := min(len(p), cap(s.header)-len(s.header))
+		s.header = append(s.header, p[:m]...)
+		if len(s.header) < cap(s.header) {
+			return len(p), nil
+		}
+
+		if err = s.flush(); err != nil {
+			return 0, err
+		}
+
+		n, p = m, p[m:]
+	}
+
+	m, err := s.write(p)
+	return n + m, err
+}
+
+func (s *sniffWriter) write(p []byte) (n int, err error) {
+	if s.store || s.stats == nil {
+		n, err = s.w.Write(p)
+	} else {
+		start := time.Now()
+		n, err = s.w.Write(p)
+		s.stats.CompressDuration += time.Since(start)
+	}
+
+	if s.stats != nil {
+		if s.store {
+			s.stats.StoredBytes += int64(n)
+		} else {
+			s.stats.CompressedBytes += int64(n)
+		}
+	}
+
+	return n, err
+}
+
+// flush makes the decision if it hasn't been made, then writes the buffered header.
+func (s *sniffWriter) flush() (err error) {
+	if s.w != nil {
+		return nil
+	}
+
+	s.store = s.policy(s.name, s.header)
+	if s.w, err = s.start(s.store); err != nil {
+		return err
+	}
+
+	if s.stats != nil {
+		if s.store {
+			s.stats.StoredFiles++
+		} else {
+			s.stats.CompressedFiles++
+		}
+	}
+
+	_, err = s.write(s.header)
+	return err
+}
+
+func (s *sniffWriter) Close() error {
+	return s.flush()
+}
@@ -0,0 +1,141 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStorePolicy(t *testing.T) {
+	// photo.jpg is stored because of its extension, random.bin because its content sniffs as gzip, and the large
+	// random data spans multiple zstd raw blocks.
+	gz, err := os.ReadFile("../testdata/test.txt.gz")
+	assert.NoError(t, err)
+	large := make([]byte, 300*1024)
+	_, _ = rand.Read(large)
+
+	files := []struct {
+		name    string
+		content []byte
+		stored  bool
+	}{
+		{name: "a.txt", content: []byte(strings.Repeat("hello, world! ", 1000)), stored: false},
+		{name: "photo.jpg", content: large, stored: true},
+		{name: "random.bin", content: gz, stored: true},
+		{name: "empty.txt", content: []byte{}, stored: false},
+		{name: "b.txt", content: []byte("short"), stored: false},
+	}
+
+	tests := []struct {
+		name string
+		arc  func(stats *StoreStats) Archiver
+	}{
+		{
+			name: "zip",
+			arc: func(stats *StoreStats) Archiver {
+				return Zip{Stats: stats}
+			},
+		},
+		{
+			name: "tar.gz",
+			arc: func(stats *StoreStats) Archiver {
+				return &Tar{Codec: &codec.GzipCodec{}, Stats: stats}
+			},
+		},
+		{
+			name: "tar.zst",
+			arc: func(stats *StoreStats) Archiver {
+				return &Tar{Codec: &codec.ZstdCodec{}, Stats: stats}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stats := &StoreStats{}
+			arc := tt.arc(stats)
+
+			var buf bytes.Buffer
+			add, closer, err := arc.Create(&buf, "")
+			assert.NoError(t, err)
+
+			for _, f := range files {
+				w, err := add(f.name, &fakeFileInfo{name: f.name, size: int64(len(f.content))})
+				assert.NoError(t, err)
+
+				_, err = w.Write(f.content)
+				assert.NoError(t, err)
+				assert.NoError(t, w.Close())
+			}
+			assert.NoError(t, closer())
+
+			assert.Equal(t, 2, stats.StoredFiles)
+			assert.Equal(t, int64(len(large)+len(gz)), stats.StoredBytes)
+			assert.Equal(t, 3, stats.CompressedFiles)
+
+			// the archive must be readable with the same archiver.
+			data := buf.Bytes()
+			fsys, err := FS(bytes.NewReader(data), func(opts *FSOptions) {
+				opts.Archiver = arc
+			})
+			assert.NoError(t, err)
+
+			for _, f := range files {
+				r, err := fsys.Open(f.name)
+				assert.NoError(t, err)
+
+				content, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equalf(t, f.content, content, "content of %s mismatched", f.name)
+				_ = r.Close()
+
+				if zfi, ok := mustStat(t, fsys, f.name).Sys().(*zip.FileHeader); ok {
+					assert.Equalf(t, f.stored, zfi.Method == zip.Store, "method of %s mismatched", f.name)
+				}
+			}
+		})
+	}
+}
+
+func mustStat(t *testing.T, fsys FileSystem, name string) os.FileInfo {
+	fi, err := fsys.Stat(name)
+	assert.NoError(t, err)
+	return fi
+}
+
+type fakeFileInfo struct {
+	name string
+	size int64
+}
+
+func (fi *fakeFileInfo) Name() string {
+	return fi.name
+}
+
+func (fi *fakeFileInfo) Size() int64 {
+	return fi.size
+}
+
+func (fi *fakeFileInfo) Mode() os.FileMode {
+	return 0644
+}
+
+func (fi *fakeFileInfo) ModTime() time.Time {
+	return time.Unix(1700000000, 0)
+}
+
+func (fi *fakeFileInfo) IsDir() bool {
+	return false
+}
+
+func (fi *fakeFileInfo) Sys() any {
+	return nil
+}
@@ -17,6 +17,16 @@ import (
 type Tar struct {
 	// Codec if given will be used to encode/decode contents with Archiver.Open or Archiver.Create.
 	codec.Codec
+
+	// StorePolicy decides which files are stored without compression by Create.
+	//
+	// Only applicable if the encoder from Codec implements codec.StoreEncoder. Default to DefaultStorePolicy.
+	StorePolicy StorePolicy
+
+	// Stats if given will be updated by Create with statistics about stored and compressed files.
+	//
+	// Only applicable if the encoder from Codec implements codec.StoreEncoder.
+	Stats *StoreStats
 }
 
 var _ Archiver = &Tar{}
@@ -37,7 +47,30 @@ func (t *Tar) Create(dst io.Writer, root string) (add AddFunction, closer CloseF
 
 	w := tar.NewWriter(enc)
 
+	// if the encoder can switch to storing mid-stream, the content of each regular file is sniffed to decide
+	// whether it should be stored. the tar headers and paddings are always compressed.
+	se, _ := enc.(codec.StoreEncoder)
+	var pending *sniffWriter
+
 	add = func(name string, fi os.FileInfo) (io.WriteCloser, error) {
+		if se != nil {
+			if pending != nil {
+				if err := pending.flush(); err != nil {
+					return nil, err
+				}
+				pending = nil
+			}
+
+			// Flush writes the padding of the previous file so that the next header can be compressed.
+			if err := w.Flush(); err != nil {
+				return nil, err
+			}
+
+			if err := se.SetStore(false); err != nil {
+				return nil, err
+			}
+		}
+
 		name = filepath.ToSlash(name)
 		isDir := fi.IsDir() || strings.HasSuffix(name, "/")
 
@@ -56,10 +89,26 @@ func (t *Tar) Create(dst io.Writer, root string) (add AddFunction, closer CloseF
 			return nil, err
 		}
 
-		return &internal.WriteNoopCloser{Writer: w}, nil
+		if se == nil || isDir || !fi.Mode().IsRegular() {
+			return &internal.WriteNoopCloser{Writer: w}, nil
+		}
+
+		pending = newSniffWriter(hdr.Name, t.StorePolicy, t.Stats, func(store bool) (io.Writer, error) {
+			return w, se.SetStore(store)
+		})
+
+		return pending, nil
 	}
 
-	closer = internal.ChainCloser(w.Close, enc.Close)
+	closer = internal.ChainCloser(func() error {
+		if pending != nil {
+			if err := pending.flush(); err != nil {
+				return err
+			}
+		}
+
+		return w.Close()
+	}, enc.Close)
 
 	return
 }
@@ -17,10 +17,21 @@ import (
 
 // Zip implements Archiver for ZIP files.
 type Zip struct {
+	// StorePolicy decides which files are written with zip.Store instead of zip.Deflate by Create.
+	//
+	// Default to DefaultStorePolicy.
+	StorePolicy StorePolicy
+
+	// Stats if given will be updated by Create with statistics about stored and compressed files.
+	Stats *StoreStats
 }
 
 var _ Archiver = Zip{}
 
+// Create returns methods to write a zip archive.
+//
+// The header of each regular file is not written until its first 512 bytes have been written (or the file is closed)
+// so that Zip.StorePolicy can sniff the content to decide between zip.Store and zip.Deflate.
 func (z Zip) Create(dst io.Writer, root string) (add AddFunction, closer CloseFunction, err error) {
 	root = filepath.ToSlash(root)
 
@@ -29,9 +40,20 @@ func (z Zip) Create(dst io.Writer, root string) (add AddFunction, closer CloseFu
 		return flate.NewWriter(w, flate.BestCompression)
 	})
 
+	// the previous file whose header may not have been written yet.
+	var pending *sniffWriter
+
 	add = func(name string, fi os.FileInfo) (io.WriteCloser, error) {
+		if pending != nil {
+			if err := pending.flush(); err != nil {
+				return nil, err
+			}
+			pending = nil
+		}
+
 		name = filepath.ToSlash(name)
-		if fi.IsDir() || strings.HasSuffix(name, "/") {
+		isDir := fi.IsDir() || strings.HasSuffix(name, "/")
+		if isDir {
 			name = path.Join(root, name) + "/"
 		} else {
 			name = path.Join(root, name)
@@ -44,29 +66,58 @@ func (z Zip) Create(dst io.Writer, root string) (add AddFunction, closer CloseFu
 		}
 		fh.SetMode(fi.Mode())
 
-		fw, err := w.CreateHeader(fh)
-		if err != nil {
-			return nil, err
+		if isDir {
+			fw, err := w.CreateHeader(fh)
+			if err != nil {
+				return nil, err
+			}
+
+			return &internal.WriteNoopCloser{Writer: fw}, nil
 		}
 
-		return &internal.WriteNoopCloser{Writer: fw}, nil
+		pending = newSniffWriter(name, z.StorePolicy, z.Stats, func(store bool) (io.Writer, error) {
+			if store {
+				fh.Method = zip.Store
+			}
+
+			return w.CreateHeader(fh)
+		})
+
+		return pending, nil
 	}
 
-	closer = w.Close
+	closer = func() error {
+		if pending != nil {
+			if err := pending.flush(); err != nil {
+				return err
+			}
+		}
+
+		return w.Close()
+	}
 
 	return
 }
 
 func (z Zip) Open(src io.Reader) (iter.Seq2[File, error], error) {
-	if f, ok := src.(*os.File); ok {
-		return fromZipFile(f)
-	}
+	switch r := src.(type) {
+	case *os.File:
+		return fromZipFile(r)
+	case sizedReaderAt:
+		// s3reader.Reader is one such implementation.
+		zr, err := zip.NewReader(r, r.Size())
+		if err != nil {
+			return nil, fmt.Errorf("open zip archive error: %w", err)
+		}
 
-	return fromZipReader(src)
+		return fromZipArchive(zr), nil
+	default:
+		return fromZipReader(src)
+	}
 }
 
 func (z Zip) ArchiveExt() string {
-	return "zip"
+	return ".zip"
 }
 
 func (z Zip) ContentType() string {
@@ -110,6 +161,10 @@ func fromZipFile(src *os.File) (iter.Seq2[File, error], error) {
 		return nil, fmt.Errorf(`open zip file "%s" error: %w`, src.Name(), err)
 	}
 
+	return fromZipArchive(zr), nil
+}
+
+func fromZipArchive(zr *zip.Reader) iter.Seq2[File, error] {
 	return func(yield func(File, error) bool) {
 		for _, zf := range zr.File {
 			if !yield(&zipFile{
@@ -119,7 +174,7 @@ func fromZipFile(src *os.File) (iter.Seq2[File, error], error) {
 				return
 			}
 		}
-	}, nil
+	}
 }
 
 type zipFile struct {
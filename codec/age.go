@@ -0,0 +1,138 @@
+package codec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+
+	"filippo.io/age"
+)
+
+// AgeScheme is the name of the encryption scheme implemented by AgeCodec.
+const AgeScheme = "age"
+
+// AgeCodec implements Codec for encrypting and decrypting with age (https://age-encryption.org).
+//
+// AgeCodec can be stacked on top of another Codec to compress before encrypting and to decrypt before decompressing.
+// Without a Codec, AgeCodec encrypts the stream as-is which is how archives from any archive.Archiver are encrypted.
+type AgeCodec struct {
+	// Codec is the optional codec to compress with before encrypting.
+	Codec Codec
+
+	// Recipients are the recipients to encrypt to. Required by NewEncoder.
+	//
+	// An age.ScryptRecipient (passphrase) must be the only recipient if given.
+	Recipients []age.Recipient
+
+	// Identities are the identities to decrypt with. Required by NewDecoder.
+	Identities []age.Identity
+}
+
+var _ Codec = AgeCodec{}
+
+func (c AgeCodec) NewDecoder(src io.Reader) (io.ReadCloser, error) {
+	if len(c.Identities) == 0 {
+		return nil, errors.New("no age identities to decrypt with")
+	}
+
+	r, err := age.Decrypt(src, c.Identities...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Codec == nil {
+		return io.NopCloser(r), nil
+	}
+
+	return c.Codec.NewDecoder(r)
+}
+
+// NewEncoder returns an encoder that encrypts to all AgeCodec.Recipients.
+//
+// If Codec is given and its encoder implements StoreEncoder, so does the returned encoder.
+func (c AgeCodec) NewEncoder(dst io.Writer) (io.WriteCloser, error) {
+	if len(c.Recipients) == 0 {
+		return nil, errors.New("no age recipients to encrypt to")
+	}
+
+	w, err := age.Encrypt(dst, c.Recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.Codec == nil {
+		return w, nil
+	}
+
+	enc, err := c.Codec.NewEncoder(w)
+	if err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+
+	if se, ok := enc.(StoreEncoder); ok {
+		return &ageStoreEncoder{StoreEncoder: se, w: w}, nil
+	}
+
+	return &ageEncoder{WriteCloser: enc, w: w}, nil
+}
+
+// Ext returns the extension of the Codec (if given) followed by ".age".
+func (c AgeCodec) Ext() string {
+	if c.Codec != nil {
+		return c.Codec.Ext() + ".age"
+	}
+
+	return ".age"
+}
+
+func (c AgeCodec) ContentType() string {
+	return "application/octet-stream"
+}
+
+// ageEncoder closes the inner encoder before closing the age writer.
+type ageEncoder struct {
+	io.WriteCloser
+	w io.WriteCloser
+}
+
+func (e *ageEncoder) Close() error {
+	if err := e.WriteCloser.Close(); err != nil {
+		_ = e.w.Close()
+		return err
+	}
+
+	return e.w.Close()
+}
+
+// ageStoreEncoder is ageEncoder for inner encoders that implement StoreEncoder.
+type ageStoreEncoder struct {
+	StoreEncoder
+	w io.WriteCloser
+}
+
+func (e *ageStoreEncoder) Close() error {
+	if err := e.StoreEncoder.Close(); err != nil {
+		_ = e.w.Close()
+		return err
+	}
+
+	return e.w.Close()
+}
+
+// AgeFingerprint returns a short fingerprint of the given recipient that is safe to record in manifests.
+//
+// X25519 recipients are fingerprinted by the first 8 bytes of the SHA-256 hash of their public keys, while scrypt
+// (passphrase) recipients all have the same fingerprint "scrypt" since they have no public component.
+func AgeFingerprint(r age.Recipient) string {
+	switch v := r.(type) {
+	case *age.X25519Recipient:
+		h := sha256.Sum256([]byte(v.String()))
+		return "x25519:" + hex.EncodeToString(h[:8])
+	case *age.ScryptRecipient:
+		return "scrypt"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,353 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// BGZFBlockSize is the maximum number of uncompressed bytes in each BGZF block.
+//
+// This is the same value used by samtools/htslib so that the compressed block (including header and footer) is
+// always smaller than 64 KiB even if the data is incompressible.
+const BGZFBlockSize = 0xff00
+
+// bgzfHeaderSize is the size of the gzip header of a BGZF block; the footer (CRC32 and ISIZE) is 8 bytes.
+const bgzfHeaderSize = 18
+
+// bgzfEOF is the empty BGZF block that marks the end of a BGZF file.
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43, 0x02, 0x00,
+	0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// bgzfEncoder compresses blocks of BGZFBlockSize bytes in parallel.
+//
+// Each block is a standalone gzip member so the output can be read by any gzip decoder that supports multiple
+// members (such as gzip.Reader). The extra field "BC" in each member's header records the compressed size of the
+// block which allows ReadBGZFIndex to index the blocks without decompressing them.
+type bgzfEncoder struct {
+	dst   io.Writer
+	level int
+	store bool
+
+	buf []byte
+
+	// sem limits the number of blocks being compressed at the same time.
+	sem chan struct{}
+	// results are consumed in order by the goroutine that writes to dst.
+	results chan chan []byte
+	done    chan struct{}
+
+	mu  sync.Mutex
+	err error
+
+	closed bool
+}
+
+var _ StoreEncoder = &bgzfEncoder{}
+
+func newBGZFEncoder(dst io.Writer, level, concurrency int) *bgzfEncoder {
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	e := &bgzfEncoder{
+		dst:     dst,
+		level:   level,
+		buf:     make([]byte, 0, BGZFBlockSize),
+		sem:     make(chan struct{}, concurrency),
+		results: make(chan chan []byte, concurrency),
+		done:    make(chan struct{}),
+	}
+
+	go e.writeLoop()
+
+	return e
+}
+
+func (e *bgzfEncoder) writeLoop() {
+	defer close(e.done)
+
+	for res := range e.results {
+		block := <-res
+		if e.getErr() != nil {
+			continue
+		}
+
+		if _, err := e.dst.Write(block); err != nil {
+			e.setErr(err)
+		}
+	}
+}
+
+func (e *bgzfEncoder) getErr() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.err
+}
+
+func (e *bgzfEncoder) setErr(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+func (e *bgzfEncoder) Write(p []byte) (n int, err error) {
+	if e.closed {
+		return 0, errors.New("write to closed encoder")
+	}
+
+	for len(p) > 0 {
+		if err = e.getErr(); err != nil {
+			return n, err
+		}
+
+		m := min(len(p), BGZFBlockSize-len(e.buf))
+		e.buf = append(e.buf, p[:m]...)
+		p = p[m:]
+		n += m
+
+		if len(e.buf) == BGZFBlockSize {
+			e.flushBlock()
+		}
+	}
+
+	return n, nil
+}
+
+// flushBlock submits the buffered data to be compressed as a new block.
+func (e *bgzfEncoder) flushBlock() {
+	if len(e.buf) == 0 {
+		return
+	}
+
+	data, level := e.buf, e.level
+	if e.store {
+		level = flate.NoCompression
+	}
+	e.buf = make([]byte, 0, BGZFBlockSize)
+
+	res := make(chan []byte, 1)
+	e.results <- res
+	e.sem <- struct{}{}
+
+	go func() {
+		defer func() { <-e.sem }()
+
+		block, err := compressBGZFBlock(data, level)
+		if err != nil {
+			e.setErr(err)
+		}
+
+		res <- block
+	}()
+}
+
+func (e *bgzfEncoder) SetStore(store bool) error {
+	if e.store == store {
+		return nil
+	}
+
+	// the current block must be compressed with the previous setting.
+	e.flushBlock()
+	e.store = store
+	return e.getErr()
+}
+
+func (e *bgzfEncoder) Close() error {
+	if e.closed {
+		return e.getErr()
+	}
+	e.closed = true
+
+	e.flushBlock()
+
+	res := make(chan []byte, 1)
+	res <- bgzfEOF
+	e.results <- res
+
+	close(e.results)
+	<-e.done
+
+	return e.getErr()
+}
+
+// compressBGZFBlock compresses the given data as a BGZF block.
+func compressBGZFBlock(data []byte, level int) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(bgzfHeaderSize + len(data) + 64)
+
+	// https://samtools.github.io/hts-specs/SAMv1.pdf section 4.1: the header has FEXTRA flag set, XLEN=6, and the
+	// "BC" subfield whose value is the total block size minus 1 (filled in after compression).
+	buf.Write([]byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 0x06, 0x00, 'B', 'C', 0x02, 0x00, 0, 0})
+
+	fw, err := flate.NewWriter(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err = fw.Close(); err != nil {
+		return nil, err
+	}
+
+	var footer [8]byte
+	binary.LittleEndian.PutUint32(footer[0:4], crc32.ChecksumIEEE(data))
+	binary.LittleEndian.PutUint32(footer[4:8], uint32(len(data)))
+	buf.Write(footer[:])
+
+	block := buf.Bytes()
+	if len(block) > 1<<16 {
+		return nil, fmt.Errorf("BGZF block too large (%d bytes)", len(block))
+	}
+	binary.LittleEndian.PutUint16(block[16:18], uint16(len(block)-1))
+
+	return block, nil
+}
+
+// BGZFBlock describes a block in a BGZF file.
+type BGZFBlock struct {
+	// Offset is the offset of the block in the compressed file.
+	Offset int64
+	// Size is the compressed size of the block including its header and footer.
+	Size int64
+	// UncompressedOffset is the offset of the block's data in the uncompressed content.
+	UncompressedOffset int64
+	// UncompressedSize is the size of the block's data when uncompressed.
+	UncompressedSize int64
+}
+
+// BGZFIndex is the list of blocks in a BGZF file, ordered by their offsets.
+type BGZFIndex []BGZFBlock
+
+// ErrNotBGZF is returned by ReadBGZFIndex if the file is not a BGZF file.
+var ErrNotBGZF = errors.New("not a BGZF file")
+
+// ReadBGZFIndex reads only the headers and footers of the blocks in the BGZF file read from src to build its index.
+//
+// Each block requires one small ReadAt call, so when reading from S3 (e.g. with s3reader.Reader) it is best to
+// persist the index rather than rebuild it often. Returns ErrNotBGZF if any block does not have the BGZF extra field,
+// which is the case for gzip files that were not created by GzipCodec.
+func ReadBGZFIndex(src io.ReaderAt, size int64) (BGZFIndex, error) {
+	idx := make(BGZFIndex, 0, size/(1<<15)+1)
+
+	// each read gets the previous block's 4-byte ISIZE as well as the next block's header.
+	buf := make([]byte, 4+bgzfHeaderSize)
+	var offset, uncompressedOffset int64
+	for offset < size {
+		var header []byte
+		if offset == 0 {
+			if _, err := src.ReadAt(buf[4:], 0); err != nil {
+				return nil, fmt.Errorf("read BGZF header at offset %d error: %w", offset, err)
+			}
+			header = buf[4:]
+		} else {
+			n, err := src.ReadAt(buf, offset-4)
+			if err != nil && !(errors.Is(err, io.EOF) && n == 4) {
+				return nil, fmt.Errorf("read BGZF header at offset %d error: %w", offset, err)
+			}
+
+			idx[len(idx)-1].UncompressedSize = int64(binary.LittleEndian.Uint32(buf[0:4]))
+			uncompressedOffset += idx[len(idx)-1].UncompressedSize
+			if n == 4 {
+				return idx, nil
+			}
+
+			header = buf[4:]
+		}
+
+		if header[0] != 0x1f || header[1] != 0x8b || header[3]&0x04 == 0 || header[12] != 'B' || header[13] != 'C' {
+			return nil, ErrNotBGZF
+		}
+
+		blockSize := int64(binary.LittleEndian.Uint16(header[16:18])) + 1
+		idx = append(idx, BGZFBlock{Offset: offset, Size: blockSize, UncompressedOffset: uncompressedOffset})
+		offset += blockSize
+	}
+
+	if n := len(idx); n != 0 {
+		if _, err := src.ReadAt(buf[:4], offset-4); err != nil {
+			return nil, fmt.Errorf("read BGZF footer at offset %d error: %w", offset-4, err)
+		}
+
+		idx[n-1].UncompressedSize = int64(binary.LittleEndian.Uint32(buf[0:4]))
+	}
+
+	return idx, nil
+}
+
+// UncompressedSize returns the total size of the uncompressed content.
+func (idx BGZFIndex) UncompressedSize() int64 {
+	if len(idx) == 0 {
+		return 0
+	}
+
+	last := idx[len(idx)-1]
+	return last.UncompressedOffset + last.UncompressedSize
+}
+
+// NewReaderAt returns an io.ReaderAt over the uncompressed content of the BGZF file read from src.
+//
+// Only the blocks that overlap the requested range are read from src and decompressed.
+func (idx BGZFIndex) NewReaderAt(src io.ReaderAt) io.ReaderAt {
+	return &bgzfReaderAt{idx: idx, src: src}
+}
+
+type bgzfReaderAt struct {
+	idx BGZFIndex
+	src io.ReaderAt
+}
+
+func (r *bgzfReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	// find the first block that contains off.
+	i := sort.Search(len(r.idx), func(i int) bool {
+		b := r.idx[i]
+		return b.UncompressedOffset+b.UncompressedSize > off
+	})
+
+	for ; n < len(p) && i < len(r.idx); i++ {
+		b := r.idx[i]
+		if b.UncompressedSize == 0 {
+			continue
+		}
+
+		compressed := make([]byte, b.Size)
+		if _, err = r.src.ReadAt(compressed, b.Offset); err != nil && !errors.Is(err, io.EOF) {
+			return n, err
+		}
+
+		gr, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return n, err
+		}
+
+		data, err := io.ReadAll(gr)
+		if err != nil {
+			return n, err
+		}
+
+		n += copy(p[n:], data[off+int64(n)-b.UncompressedOffset:])
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
@@ -16,3 +16,15 @@ type Codec interface {
 	// ContentType returns the content type of the files created with this encoder.
 	ContentType() string
 }
+
+// StoreEncoder is implemented by the encoders from Codec.NewEncoder that can switch between compressing and storing
+// data as-is in the middle of a stream.
+//
+// The stream produced by a StoreEncoder can still be decompressed by the same Codec.NewDecoder. Switching usually
+// ends the current frame or member and starts a new one so it should not be done for every few bytes.
+type StoreEncoder interface {
+	io.WriteCloser
+
+	// SetStore switches subsequent writes between being stored as-is (true) and being compressed (false).
+	SetStore(store bool) error
+}
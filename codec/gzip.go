@@ -7,16 +7,27 @@ import (
 
 // GzipCodec implements Codec for gzip compression algorithm.
 type GzipCodec struct {
+	// MaxConcurrency is the maximum number of blocks to compress in parallel.
+	//
+	// The zero value defaults to runtime.GOMAXPROCS.
+	MaxConcurrency int
 }
 
 var _ Codec = GzipCodec{}
 
+// NewDecoder returns a gzip.Reader which reads multiple concatenated members (including BGZF blocks) as one stream.
 func (c GzipCodec) NewDecoder(src io.Reader) (io.ReadCloser, error) {
 	return gzip.NewReader(src)
 }
 
+// NewEncoder returns a StoreEncoder that compresses in parallel.
+//
+// The output is in BGZF format: the data is split into blocks of BGZFBlockSize bytes, each compressed independently
+// with gzip.BestCompression as its own gzip member. The result is still a valid gzip file that can be decompressed
+// by any gzip tool, and its blocks can be indexed with ReadBGZFIndex for random access. StoreEncoder.SetStore ends
+// the current block so that subsequent blocks use gzip.NoCompression instead.
 func (c GzipCodec) NewEncoder(dst io.Writer) (io.WriteCloser, error) {
-	return gzip.NewWriterLevel(dst, gzip.BestCompression)
+	return newBGZFEncoder(dst, gzip.BestCompression, c.MaxConcurrency), nil
 }
 
 func (c GzipCodec) Ext() string {
@@ -0,0 +1,106 @@
+package codec
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Factory creates a new Codec.
+type Factory func() Codec
+
+type registration struct {
+	name    string
+	exts    []string
+	magic   [][]byte
+	factory Factory
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   []registration
+)
+
+func init() {
+	Register("zstd", []string{".zst"}, [][]byte{
+		{0x28, 0xb5, 0x2f, 0xfd},
+		// the skippable frame with an embedded dictionary (see ZstdCodec.Dictionary).
+		{0x50, 0x2a, 0x4d, 0x18},
+	}, func() Codec { return &ZstdCodec{} })
+	Register("gzip", []string{".gz"}, [][]byte{{0x1f, 0x8b}}, func() Codec { return &GzipCodec{} })
+	Register("xz", []string{".xz"}, [][]byte{{0xfd, '7', 'z', 'X', 'Z', 0x00}}, func() Codec { return &XzCodec{} })
+}
+
+// Register makes a codec available by its name, its file name extensions, and its magic bytes.
+//
+// The extensions must include the leading dot (e.g. ".gz"), and the magic bytes are matched against the start of the
+// compressed stream. Either can be empty. Registering a name that has already been registered replaces the previous
+// registration, which allows the built-in codecs (zstd, gzip, and xz) to be replaced as well.
+//
+// Register is safe for concurrent use, but is typically called from an init function.
+func Register(name string, exts []string, magic [][]byte, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	r := registration{name: name, exts: exts, magic: magic, factory: factory}
+	if i := slices.IndexFunc(registry, func(r registration) bool { return r.name == name }); i != -1 {
+		registry[i] = r
+	} else {
+		registry = append(registry, r)
+	}
+}
+
+// New returns a new Codec registered with the given name or extension.
+//
+// The extension may be given with or without the leading dot so that "gz" and ".gz" both return a GzipCodec. Returns
+// nil if there is no match.
+func New(name string) Codec {
+	if c := find(func(r registration) bool { return r.name == name }); c != nil {
+		return c
+	}
+
+	return NewFromExt("." + strings.TrimPrefix(name, "."))
+}
+
+// NewFromExt returns a new Codec registered with the given file name extension (e.g. ".gz").
+//
+// Returns nil if there is no match.
+func NewFromExt(ext string) Codec {
+	return find(func(r registration) bool { return slices.Contains(r.exts, ext) })
+}
+
+// Detect returns a new Codec whose magic bytes match the start of the given header.
+//
+// Returns nil if there is no match.
+func Detect(header []byte) Codec {
+	return find(func(r registration) bool {
+		return slices.ContainsFunc(r.magic, func(magic []byte) bool {
+			return len(magic) != 0 && bytes.HasPrefix(header, magic)
+		})
+	})
+}
+
+// Names returns the names of all registered codecs in the order they were registered.
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	names := make([]string, len(registry))
+	for i, r := range registry {
+		names[i] = r.name
+	}
+
+	return names
+}
+
+func find(fn func(r registration) bool) Codec {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	if i := slices.IndexFunc(registry, fn); i != -1 {
+		return registry[i].factory()
+	}
+
+	return nil
+}
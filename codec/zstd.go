@@ -1,18 +1,51 @@
 package codec
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
 
+	"github.com/klauspost/compress/dict"
 	"github.com/klauspost/compress/zstd"
 )
 
 // ZstdCodec implements Codec and Archiver for zstd compression algorithm.
-type ZstdCodec struct{}
+type ZstdCodec struct {
+	// Dictionary is an optional zstd dictionary (see TrainZstdDictionary).
+	//
+	// If given, NewEncoder embeds the dictionary in a skippable frame at the start of the stream before compressing
+	// with the dictionary. NewDecoder always looks for such an embedded dictionary so Dictionary is only needed for
+	// decoding streams whose dictionaries were not embedded.
+	//
+	// Because the embedded dictionary is in a skippable frame, other zstd tools can still decompress the stream if
+	// they are given the dictionary (e.g. `zstd -D`), which can be extracted with ExtractZstdDictionary.
+	Dictionary []byte
+
+	// MaxConcurrency is passed to zstd.WithEncoderConcurrency if positive.
+	MaxConcurrency int
+}
 
 var _ Codec = ZstdCodec{}
 
 func (c ZstdCodec) NewDecoder(src io.Reader) (io.ReadCloser, error) {
-	dec, err := zstd.NewReader(src)
+	br := bufio.NewReader(src)
+
+	d, err := readZstdDictionaryFrame(br)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := make([]zstd.DOption, 0, 1)
+	switch {
+	case d != nil:
+		opts = append(opts, zstd.WithDecoderDicts(d))
+	case c.Dictionary != nil:
+		opts = append(opts, zstd.WithDecoderDicts(c.Dictionary))
+	}
+
+	dec, err := zstd.NewReader(br, opts...)
 	return &zstdDecoder{dec}, err
 }
 
@@ -25,8 +58,30 @@ func (d *zstdDecoder) Close() error {
 	return nil
 }
 
+// NewEncoder returns a StoreEncoder.
+//
+// Each switch with StoreEncoder.SetStore ends the current zstd frame. Stored data is written as frames of raw
+// (uncompressed) blocks. zstd.Decoder reads multiple frames as one stream by default.
 func (c ZstdCodec) NewEncoder(dst io.Writer) (io.WriteCloser, error) {
-	return zstd.NewWriter(dst, zstd.WithEncoderLevel(zstd.SpeedBestCompression))
+	opts := []zstd.EOption{zstd.WithEncoderLevel(zstd.SpeedBestCompression)}
+	if c.Dictionary != nil {
+		opts = append(opts, zstd.WithEncoderDict(c.Dictionary))
+	}
+	if c.MaxConcurrency > 0 {
+		opts = append(opts, zstd.WithEncoderConcurrency(c.MaxConcurrency))
+	}
+
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &zstdEncoder{dst: dst, enc: enc}
+	if c.Dictionary != nil {
+		e.preamble = zstdDictionaryFrame(c.Dictionary)
+	}
+
+	return e, nil
 }
 
 func (c ZstdCodec) Ext() string {
@@ -36,3 +91,218 @@ func (c ZstdCodec) Ext() string {
 func (c ZstdCodec) ContentType() string {
 	return "application/zstd"
 }
+
+// zstdMaxRawBlockSize is the maximum size of a raw block given the window size from zstdRawFrameHeader.
+const zstdMaxRawBlockSize = 128 * 1024
+
+// zstdRawFrameHeader is the header of frames of raw blocks.
+//
+// The frame header descriptor (0x00) indicates no content size, no checksum, and no dictionary. The window descriptor
+// (0x38) sets a window size of 128 KiB which is also the maximum block size.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8878#name-zstandard-frames.
+var zstdRawFrameHeader = []byte{0x28, 0xb5, 0x2f, 0xfd, 0x00, 0x38}
+
+type zstdEncoder struct {
+	dst   io.Writer
+	enc   *zstd.Encoder
+	store bool
+
+	// preamble is written before anything else.
+	preamble []byte
+
+	// inFrame is true if a frame (compressed or raw) has been started.
+	inFrame bool
+	wrote   bool
+	buf     []byte
+}
+
+var _ StoreEncoder = &zstdEncoder{}
+
+func (e *zstdEncoder) Write(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if !e.wrote {
+		if err = e.writePreamble(); err != nil {
+			return 0, err
+		}
+	}
+
+	e.wrote = true
+
+	if !e.store {
+		if !e.inFrame {
+			e.enc.Reset(e.dst)
+			e.inFrame = true
+		}
+
+		return e.enc.Write(p)
+	}
+
+	if !e.inFrame {
+		if _, err = e.dst.Write(zstdRawFrameHeader); err != nil {
+			return 0, err
+		}
+
+		e.buf = make([]byte, 0, zstdMaxRawBlockSize)
+		e.inFrame = true
+	}
+
+	for len(p) > 0 {
+		m := min(len(p), zstdMaxRawBlockSize-len(e.buf))
+		e.buf = append(e.buf, p[:m]...)
+		p = p[m:]
+		n += m
+
+		// a full block is only written once more data arrives so that the last block can be marked as such.
+		if len(e.buf) == zstdMaxRawBlockSize && len(p) > 0 {
+			if err = e.writeRawBlock(false); err != nil {
+				return n, err
+			}
+		}
+	}
+
+	return n, nil
+}
+
+// writeRawBlock writes the buffered data as a raw block.
+func (e *zstdEncoder) writeRawBlock(last bool) error {
+	// block header is 3 bytes little-endian: 1 bit last block, 2 bits block type (0 is raw), 21 bits block size.
+	header := uint32(len(e.buf)) << 3
+	if last {
+		header |= 1
+	}
+
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], header)
+	if _, err := e.dst.Write(b[:3]); err != nil {
+		return err
+	}
+
+	if _, err := e.dst.Write(e.buf); err != nil {
+		return err
+	}
+
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// endFrame ends the current frame if one has been started.
+func (e *zstdEncoder) endFrame() error {
+	if !e.inFrame {
+		return nil
+	}
+
+	e.inFrame = false
+	if e.store {
+		return e.writeRawBlock(true)
+	}
+
+	return e.enc.Close()
+}
+
+func (e *zstdEncoder) SetStore(store bool) error {
+	if e.store == store {
+		return nil
+	}
+
+	err := e.endFrame()
+	e.store = store
+	return err
+}
+
+func (e *zstdEncoder) Close() error {
+	if !e.wrote {
+		// an empty stream still needs one frame to be a valid zstd file.
+		e.wrote = true
+		if err := e.writePreamble(); err != nil {
+			return err
+		}
+
+		e.enc.Reset(e.dst)
+		return e.enc.Close()
+	}
+
+	return e.endFrame()
+}
+
+func (e *zstdEncoder) writePreamble() error {
+	if e.preamble == nil {
+		return nil
+	}
+
+	_, err := e.dst.Write(e.preamble)
+	e.preamble = nil
+	return err
+}
+
+// zstdSkippableFrameMagic is the magic number of the skippable frame that embeds the dictionary.
+//
+// See https://datatracker.ietf.org/doc/html/rfc8878#name-skippable-frames.
+const zstdSkippableFrameMagic = 0x184d2a50
+
+// zstdDictionaryMarker starts the user data of the skippable frame to distinguish it from other skippable frames.
+var zstdDictionaryMarker = []byte("XY3D")
+
+// zstdDictionaryFrame returns the skippable frame that embeds the given dictionary.
+func zstdDictionaryFrame(d []byte) []byte {
+	frame := make([]byte, 8, 8+len(zstdDictionaryMarker)+len(d))
+	binary.LittleEndian.PutUint32(frame[0:4], zstdSkippableFrameMagic)
+	binary.LittleEndian.PutUint32(frame[4:8], uint32(len(zstdDictionaryMarker)+len(d)))
+	frame = append(frame, zstdDictionaryMarker...)
+	return append(frame, d...)
+}
+
+// readZstdDictionaryFrame reads and returns the dictionary embedded at the start of the stream.
+//
+// Returns nil without consuming anything if the stream does not start with an embedded dictionary.
+func readZstdDictionaryFrame(br *bufio.Reader) ([]byte, error) {
+	header, err := br.Peek(8 + len(zstdDictionaryMarker))
+	if err != nil || binary.LittleEndian.Uint32(header[0:4]) != zstdSkippableFrameMagic || !bytes.Equal(header[8:], zstdDictionaryMarker) {
+		// if there's an error peeking, let zstd.Decoder report it.
+		return nil, nil
+	}
+
+	frame := make([]byte, 8+int(binary.LittleEndian.Uint32(header[4:8])))
+	if _, err = io.ReadFull(br, frame); err != nil {
+		return nil, fmt.Errorf("read embedded zstd dictionary error: %w", err)
+	}
+
+	return frame[8+len(zstdDictionaryMarker):], nil
+}
+
+// ExtractZstdDictionary returns the dictionary embedded at the start of the zstd stream read from src.
+//
+// Returns nil if the stream does not have an embedded dictionary.
+func ExtractZstdDictionary(src io.Reader) ([]byte, error) {
+	return readZstdDictionaryFrame(bufio.NewReader(src))
+}
+
+// TrainZstdDictionary trains a zstd dictionary from the given samples.
+//
+// The samples should be representative of the files to be compressed, such as the contents of many small files of
+// the same type. maxSize is the maximum size of the dictionary; the zero value defaults to 112640 bytes, the same
+// default as the zstd CLI.
+func TrainZstdDictionary(samples [][]byte, maxSize int) ([]byte, error) {
+	if maxSize <= 0 {
+		maxSize = 112640
+	}
+
+	return dict.BuildZstdDict(samples, dict.Options{
+		MaxDictSize: maxSize,
+		HashBytes:   6,
+		ZstdLevel:   zstd.SpeedBestCompression,
+	})
+}
+
+// ZstdDictionaryID returns the ID of the given zstd dictionary.
+func ZstdDictionaryID(d []byte) (uint32, error) {
+	info, err := zstd.InspectDictionary(d)
+	if err != nil {
+		return 0, err
+	}
+
+	return info.ID(), nil
+}
@@ -10,6 +10,7 @@ import (
 
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/archive"
 	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
 )
@@ -23,9 +24,49 @@ type CompressOptions struct {
 
 	// MaxConcurrency customises the concurrency level.
 	//
-	// Applicable only for compression libraries that support it (e.g. zstd). The zero value indicates no specific
+	// Applicable only for compression libraries that support it (gzip and zstd). The zero value indicates no specific
 	// setting and the encoder should use default.
 	MaxConcurrency int
+
+	// StorePolicy decides which files are stored in the archive without compression.
+	//
+	// Applicable only when creating archives (e.g. zip, tar.gz, tar.zst) from directories or named files. Default to
+	// archive.DefaultStorePolicy. Use archive.NeverStore to compress every file.
+	StorePolicy archive.StorePolicy
+
+	// StoreStats if given will be updated with statistics about the stored and compressed files.
+	//
+	// Use archive.StoreStats.EstimatedTimeSaved to estimate how much time was saved by not compressing the stored
+	// files.
+	StoreStats *archive.StoreStats
+
+	// ZstdDictionary is an optional zstd dictionary to compress with (see TrainDictionary).
+	//
+	// Applicable only to zstd compression. The dictionary is embedded in the archive so that decompressing does not
+	// need it to be given separately. See codec.ZstdCodec.Dictionary.
+	ZstdDictionary []byte
+}
+
+// newArchiver returns the archive.Archiver for CompressOptions.Algorithm with the store settings applied.
+func (opts *CompressOptions) newArchiver() archive.Archiver {
+	comp := NewCompressorFromName(opts.Algorithm)
+	switch a := comp.(type) {
+	case *archive.Zip:
+		a.StorePolicy = opts.StorePolicy
+		a.Stats = opts.StoreStats
+	case *archive.Tar:
+		a.StorePolicy = opts.StorePolicy
+		a.Stats = opts.StoreStats
+		switch c := a.Codec.(type) {
+		case *codec.GzipCodec:
+			c.MaxConcurrency = opts.MaxConcurrency
+		case *codec.ZstdCodec:
+			c.Dictionary = opts.ZstdDictionary
+			c.MaxConcurrency = opts.MaxConcurrency
+		}
+	}
+
+	return comp
 }
 
 // CompressDir compresses the given root directory.
@@ -37,7 +78,10 @@ func CompressDir(ctx context.Context, dir string, dst io.Writer, optFns ...func(
 		fn(opts)
 	}
 
-	comp := NewCompressorFromName(opts.Algorithm)
+	comp := opts.newArchiver()
+	if comp == nil {
+		return fmt.Errorf("unknown compression algorithm: %s", opts.Algorithm)
+	}
 	add, closer, err := comp.Create(dst, filepath.Base(dir))
 	if err != nil {
 		return fmt.Errorf("create %s compressor error: %w", opts.Algorithm, err)
@@ -125,7 +169,10 @@ func Compress(ctx context.Context, src io.Reader, fi os.FileInfo, dst io.Writer,
 		fn(opts)
 	}
 
-	comp := NewCompressorFromName(opts.Algorithm)
+	comp := opts.newArchiver()
+	if comp == nil {
+		return fmt.Errorf("unknown compression algorithm: %s", opts.Algorithm)
+	}
 
 	var bar io.WriteCloser
 	if fi != nil {
@@ -135,8 +182,13 @@ func Compress(ctx context.Context, src io.Reader, fi os.FileInfo, dst io.Writer,
 	}
 	defer bar.Close()
 
-	// if the compressor implements codec.Codec then use that interface directly.
-	if c, ok := comp.(codec.Codec); ok {
+	// if the compressor implements codec.Codec then use that interface directly. archive.Tar embeds codec.Codec so it
+	// is only usable if the codec is given.
+	c, ok := comp.(codec.Codec)
+	if t, isTar := comp.(*archive.Tar); isTar {
+		c, ok = t.Codec, t.Codec != nil
+	}
+	if ok {
 		w, err := c.NewEncoder(dst)
 		if err != nil {
 			return fmt.Errorf("create encoder error: %w", err)
@@ -0,0 +1,95 @@
+package xy3
+
+import (
+	"bytes"
+	"io"
+	"math/rand/v2"
+	"os"
+	"testing"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompress_Gzip(t *testing.T) {
+	// a mix of compressible and random data that spans many BGZF blocks.
+	r := rand.New(rand.NewPCG(1, 2))
+	var data []byte
+	for i := range 40 {
+		chunk := make([]byte, 10000+i*997)
+		if i%2 == 0 {
+			for j := range chunk {
+				chunk[j] = byte('a' + j%26)
+			}
+		} else {
+			for j := range chunk {
+				chunk[j] = byte(r.Uint32())
+			}
+		}
+		data = append(data, chunk...)
+	}
+
+	for _, concurrency := range []int{0, 1, 4} {
+		var buf bytes.Buffer
+		err := Compress(t.Context(), bytes.NewReader(data), nil, &buf, func(opts *CompressOptions) {
+			opts.Algorithm = "gzip"
+			opts.MaxConcurrency = concurrency
+		})
+		assert.NoError(t, err)
+
+		// the stdlib decoder must read all members as one stream.
+		dec, err := codec.GzipCodec{}.NewDecoder(bytes.NewReader(buf.Bytes()))
+		assert.NoError(t, err)
+		actual, err := io.ReadAll(dec)
+		assert.NoError(t, err)
+		assert.Equal(t, data, actual)
+
+		// the index must allow random access to the uncompressed content.
+		idx, err := codec.ReadBGZFIndex(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		assert.NoError(t, err)
+		assert.Greater(t, len(idx), len(data)/codec.BGZFBlockSize)
+		assert.Equal(t, int64(len(data)), idx.UncompressedSize())
+
+		ra := idx.NewReaderAt(bytes.NewReader(buf.Bytes()))
+		for _, off := range []int64{0, 1000, codec.BGZFBlockSize - 10, int64(len(data)) - 100000} {
+			p := make([]byte, 100000)
+			n, err := ra.ReadAt(p, off)
+			assert.NoError(t, err)
+			assert.Equal(t, data[off:off+int64(n)], p)
+		}
+
+		p := make([]byte, 100)
+		n, err := ra.ReadAt(p, int64(len(data))-10)
+		assert.ErrorIs(t, err, io.EOF)
+		assert.Equal(t, data[len(data)-10:], p[:n])
+	}
+}
+
+func TestCompress_GzipEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	err := Compress(t.Context(), bytes.NewReader(nil), nil, &buf, func(opts *CompressOptions) {
+		opts.Algorithm = "gzip"
+	})
+	assert.NoError(t, err)
+
+	dec, err := codec.GzipCodec{}.NewDecoder(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	actual, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Empty(t, actual)
+}
+
+func TestGzipCodec_MultiMember(t *testing.T) {
+	// test.txt.gz was not created as BGZF so it cannot be indexed, but concatenated members must still be decoded.
+	gz, err := os.ReadFile("testdata/test.txt.gz")
+	assert.NoError(t, err)
+
+	_, err = codec.ReadBGZFIndex(bytes.NewReader(gz), int64(len(gz)))
+	assert.ErrorIs(t, err, codec.ErrNotBGZF)
+
+	dec, err := codec.GzipCodec{}.NewDecoder(bytes.NewReader(append(append([]byte(nil), gz...), gz...)))
+	assert.NoError(t, err)
+	actual, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mr. Jock, TV quiz PhD, bags few lynx\nMr. Jock, TV quiz PhD, bags few lynx\n", string(actual))
+}
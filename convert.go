@@ -0,0 +1,103 @@
+package xy3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/archive"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// ConvertOptions customises Convert.
+type ConvertOptions struct {
+	// Algorithm indicates which compression algorithm to use for the new archive.
+	//
+	// Default to DefaultAlgorithmName.
+	Algorithm string
+}
+
+// Convert transcodes the archive read from src into a new archive written to dst without extracting to disk.
+//
+// The given archive.Archiver is used to read from src (see NewDecompressorFromName) while the new archive is created
+// with the compressor from ConvertOptions.Algorithm (see NewCompressorFromName). Every regular file and directory is
+// written to the new archive with the same name, mode, and modification time. Other file types such as symlinks are
+// skipped.
+func Convert(ctx context.Context, src io.Reader, from archive.Archiver, dst io.Writer, optFns ...func(*ConvertOptions)) error {
+	opts := &ConvertOptions{
+		Algorithm: DefaultAlgorithmName,
+	}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	comp := NewCompressorFromName(opts.Algorithm)
+	if comp == nil {
+		return fmt.Errorf("unknown compression algorithm: %s", opts.Algorithm)
+	}
+
+	files, err := from.Open(src)
+	if err != nil {
+		return fmt.Errorf("read archive error: %w", err)
+	}
+
+	add, closer, err := comp.Create(dst, "")
+	if err != nil {
+		return fmt.Errorf("create %s compressor error: %w", opts.Algorithm, err)
+	}
+
+	bar := tspb.DefaultBytes(-1, fmt.Sprintf("converting to %s", opts.Algorithm))
+	defer bar.Close()
+
+	buf := make([]byte, 32*1024)
+
+	for f, err := range files {
+		if err != nil {
+			_ = closer()
+			return fmt.Errorf("read archive error: %w", err)
+		}
+
+		name, fi := f.Name(), f.FileInfo()
+		if isDir := fi.IsDir() || strings.HasSuffix(name, "/"); !isDir && !fi.Mode().IsRegular() {
+			continue
+		} else if isDir {
+			if _, err = add(name, fi); err != nil {
+				_ = closer()
+				return fmt.Errorf(`create archive directory "%s" error: %w`, name, err)
+			}
+
+			continue
+		}
+
+		w, err := add(name, fi)
+		if err != nil {
+			_ = closer()
+			return fmt.Errorf(`create archive file "%s" error: %w`, name, err)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			_, _ = w.Close(), closer()
+			return fmt.Errorf(`open archive file "%s" error: %w`, name, err)
+		}
+
+		if _, err = commons.CopyBufferWithContext(ctx, w, io.TeeReader(r, bar), buf); err != nil {
+			_, _, _ = r.Close(), w.Close(), closer()
+			return fmt.Errorf(`convert archive file "%s" error: %w`, name, err)
+		}
+
+		if err = internal.ChainCloser(w.Close, r.Close)(); err != nil {
+			_ = closer()
+			return fmt.Errorf(`close archive file "%s" error: %w`, name, err)
+		}
+	}
+
+	if err = closer(); err != nil {
+		return fmt.Errorf("complete writing archive error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package xy3
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      string
+		algorithm string
+	}{
+		{
+			name:      "zip to zstd",
+			file:      "testdata/test.zip",
+			algorithm: "zstd",
+		},
+		{
+			name:      "7z to zip",
+			file:      "testdata/test.7z",
+			algorithm: "zip",
+		},
+		{
+			name:      "rar to gzip",
+			file:      "testdata/test.rar",
+			algorithm: "gzip",
+		},
+		{
+			name:      "tar.xz to zstd",
+			file:      "testdata/test.tar.xz",
+			algorithm: "zstd",
+		},
+	}
+
+	// test.txt
+	expected := "Mr. Jock, TV quiz PhD, bags few lynx\n"
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := os.Open(tt.file)
+			assert.NoError(t, err)
+			defer src.Close()
+
+			var buf bytes.Buffer
+			err = Convert(t.Context(), src, NewDecompressorFromName(tt.file), &buf, func(opts *ConvertOptions) {
+				opts.Algorithm = tt.algorithm
+			})
+			assert.NoError(t, err)
+
+			// the converted archive must contain exactly one file named test.txt.
+			files, err := NewCompressorFromName(tt.algorithm).Open(&buf)
+			assert.NoError(t, err)
+
+			n := 0
+			for f, err := range files {
+				assert.NoError(t, err)
+				assert.Equal(t, "test.txt", f.Name())
+
+				r, err := f.Open()
+				assert.NoError(t, err)
+
+				data, err := io.ReadAll(r)
+				assert.NoError(t, err)
+				assert.Equalf(t, expected, string(data), "expectd=%s, actual=%s", expected, data)
+				n++
+			}
+			assert.Equal(t, 1, n)
+		})
+	}
+}
+
+func TestConvert_PreservesModeAndModTime(t *testing.T) {
+	modTime := time.Date(2021, 3, 4, 5, 6, 8, 0, time.UTC)
+	entries := map[string]os.FileMode{
+		"bin/run.sh":   0755,
+		"docs/note.md": 0600,
+	}
+
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	for name, mode := range entries {
+		fh := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime}
+		fh.SetMode(mode)
+		w, err := zw.CreateHeader(fh)
+		require.NoError(t, err)
+		_, err = w.Write([]byte(name))
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+
+	var dst bytes.Buffer
+	require.NoError(t, Convert(t.Context(), bytes.NewReader(src.Bytes()), NewDecompressorFromName("test.zip"), &dst, func(opts *ConvertOptions) {
+		opts.Algorithm = "zstd"
+	}))
+
+	files, err := NewCompressorFromName("zstd").Open(&dst)
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for f, err := range files {
+		require.NoError(t, err)
+
+		mode, ok := entries[f.Name()]
+		if !ok {
+			continue
+		}
+		seen[f.Name()] = true
+
+		assert.Equalf(t, mode, f.Mode().Perm(), "mode of %s", f.Name())
+		assert.Truef(t, f.FileInfo().ModTime().Equal(modTime), "modification time of %s: %s", f.Name(), f.FileInfo().ModTime())
+	}
+	assert.Len(t, seen, len(entries))
+}
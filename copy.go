@@ -0,0 +1,477 @@
+package xy3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/go-aws-commons/s3writer"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// MaxCopyObjectSize is the largest object that can be copied with a single CopyObject.
+//
+// Larger objects are copied with multipart upload using UploadPartCopy.
+const MaxCopyObjectSize = int64(5 * 1024 * 1024 * 1024)
+
+const (
+	// DefaultCopyPartSize is the default value for CopyOptions.PartSize.
+	DefaultCopyPartSize = int64(512 * 1024 * 1024)
+
+	// DefaultCopyConcurrency is the default value for CopyOptions.Concurrency.
+	DefaultCopyConcurrency = 4
+)
+
+// CopyOptions customises Copy.
+type CopyOptions struct {
+	// ExpectedSourceBucketOwner and ExpectedBucketOwner are the expected owners of the source and destination buckets.
+	ExpectedSourceBucketOwner *string
+	ExpectedBucketOwner       *string
+
+	// SourceSSECustomerKey is the SSE-C key that the source object was encrypted with.
+	SourceSSECustomerKey *internal.SSECustomerKey
+
+	// SSECustomerKey if given encrypts the copy with this SSE-C key.
+	SSECustomerKey *internal.SSECustomerKey
+
+	// ServerSideEncryption, SSEKMSKeyID, and BucketKeyEnabled if given encrypt the copy with SSE-S3 or SSE-KMS.
+	//
+	// If neither these nor SSECustomerKey are given, the copy keeps the SSE-S3 or SSE-KMS settings of the source. A
+	// source that was encrypted with SSE-C is then copied with the default encryption of the destination bucket.
+	ServerSideEncryption types.ServerSideEncryption
+	SSEKMSKeyID          string
+	BucketKeyEnabled     *bool
+
+	// StorageClass if given changes the storage class of the copy. By default, the copy keeps the source's.
+	StorageClass types.StorageClass
+
+	// ChecksumAlgorithm if given changes the S3 additional checksum algorithm of the copy.
+	//
+	// By default, the copy keeps the source's algorithm.
+	ChecksumAlgorithm types.ChecksumAlgorithm
+
+	// Overwrite allows the destination to be replaced if it already exists.
+	//
+	// By default, the copy is made with IfNoneMatch so that an existing object is never replaced. Copying an object
+	// over itself (e.g. to change its storage class) is always allowed.
+	Overwrite bool
+
+	// PartSize is the size of each part when copying objects larger than MaxCopyObjectSize.
+	//
+	// Default to DefaultCopyPartSize. The part size is increased if necessary so that the object can be copied within
+	// s3writer.MaxPartCount parts.
+	PartSize int64
+
+	// Concurrency is the number of parts that are copied at the same time when copying objects larger than
+	// MaxCopyObjectSize.
+	//
+	// Default to DefaultCopyConcurrency.
+	Concurrency int
+}
+
+// copyClient abstracts the S3 APIs that are needed to implement Copy.
+type copyClient interface {
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(context.Context, *s3.CopyObjectInput, ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	GetObjectTagging(context.Context, *s3.GetObjectTaggingInput, ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPartCopy(context.Context, *s3.UploadPartCopyInput, ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// Copy makes a server-side copy of the object of the given manifest to the given bucket and key.
+//
+// The client must be able to read the source and write the destination; it is the destination bucket's client if they
+// are accessed with different credentials. Objects up to MaxCopyObjectSize are copied with CopyObject, and larger ones
+// with multipart upload using UploadPartCopy. Either way, the user metadata including "checksum" and the tags are
+// preserved.
+//
+// The returned manifest keeps the digests and client-side encryption of src since the contents are the same, while the
+// version, ETag, S3 additional checksum, and server-side encryption are those of the copy.
+//
+// Returns ErrObjectNotFound if the source is missing, ErrObjectChanged if the source does not match src, and
+// ErrObjectNotRestored if the source is archived and has not been restored.
+func Copy(ctx context.Context, client *s3.Client, src internal.Manifest, bucket, key string, optFns ...func(*CopyOptions)) (internal.Manifest, error) {
+	opts := &CopyOptions{}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return copyObject(ctx, client, src, bucket, key, opts)
+}
+
+func copyObject(ctx context.Context, client copyClient, src internal.Manifest, bucket, key string, opts *CopyOptions) (man internal.Manifest, err error) {
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket:              aws.String(src.Bucket),
+		Key:                 aws.String(src.Key),
+		VersionId:           src.VersionID,
+		ExpectedBucketOwner: opts.ExpectedSourceBucketOwner,
+		ChecksumMode:        types.ChecksumModeEnabled,
+	}
+	headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = opts.SourceSSECustomerKey.Headers()
+
+	head, err := client.HeadObject(ctx, headObjectInput)
+	if err != nil {
+		var re *awshttp.ResponseError
+		if errors.As(err, &re) && re.HTTPStatusCode() == 404 {
+			return man, fmt.Errorf("head object error: %w", ErrObjectNotFound)
+		}
+
+		return man, fmt.Errorf("head object error: %w", err)
+	}
+
+	size := aws.ToInt64(head.ContentLength)
+	if src.Size != 0 && src.Size != size {
+		return man, fmt.Errorf("size does not match: expect %d, got %d: %w", src.Size, size, ErrObjectChanged)
+	}
+	if etag := aws.ToString(head.ETag); src.ETag != "" && etag != "" && src.ETag != etag {
+		return man, fmt.Errorf("etag does not match: expect %s, got %s: %w", src.ETag, etag, ErrObjectChanged)
+	}
+
+	// CopyObject would fail with InvalidObjectState anyway.
+	if !internal.IsReadable(head) {
+		return man, fmt.Errorf(`object has storage class "%s": %w`, head.StorageClass, ErrObjectNotRestored)
+	}
+
+	p := newCopyPlan(src, bucket, key, head, opts)
+
+	var out copyResult
+	if size <= MaxCopyObjectSize {
+		out, err = p.copyObject(ctx, client)
+	} else {
+		out, err = p.copyMultipart(ctx, client, size)
+	}
+	if err != nil {
+		return man, err
+	}
+
+	man = src
+	man.Bucket, man.Key, man.ExpectedBucketOwner = bucket, key, opts.ExpectedBucketOwner
+	man.Size, man.VersionID, man.ETag = size, out.versionID, out.etag
+	if man.Checksum == "" {
+		man.Checksum = head.Metadata["checksum"]
+	}
+
+	alg, value := out.checksums.Get()
+	man.S3ChecksumAlgorithm, man.S3Checksum = string(alg), value
+
+	man.SSE, man.SSEKMSKeyID, man.SSECustomerKeyMD5 = "", "", ""
+	if opts.SSECustomerKey != nil {
+		man.SSE, man.SSECustomerKeyMD5 = internal.SSECustomer, opts.SSECustomerKey.KeyMD5
+	} else {
+		man.SSE, man.SSEKMSKeyID = string(out.serverSideEncryption), aws.ToString(out.sseKMSKeyID)
+	}
+
+	return man, nil
+}
+
+// copyPlan contains the settings shared by CopyObject and the multipart copy.
+type copyPlan struct {
+	src               internal.Manifest
+	bucket, key       string
+	copySource        string
+	ifMatch           *string
+	ifNoneMatch       *string
+	checksumAlgorithm types.ChecksumAlgorithm
+	head              *s3.HeadObjectOutput
+	opts              *CopyOptions
+
+	serverSideEncryption types.ServerSideEncryption
+	sseKMSKeyID          *string
+	bucketKeyEnabled     *bool
+}
+
+// copyResult is the outcome of either CopyObject or the multipart copy.
+type copyResult struct {
+	versionID            *string
+	etag                 string
+	checksums            internal.S3Checksums
+	serverSideEncryption types.ServerSideEncryption
+	sseKMSKeyID          *string
+}
+
+func newCopyPlan(src internal.Manifest, bucket, key string, head *s3.HeadObjectOutput, opts *CopyOptions) *copyPlan {
+	p := &copyPlan{
+		src:        src,
+		bucket:     bucket,
+		key:        key,
+		copySource: (&url.URL{Path: src.Bucket + "/" + src.Key}).EscapedPath(),
+		// every part must come from the same object.
+		ifMatch: head.ETag,
+		head:    head,
+		opts:    opts,
+	}
+	if src.VersionID != nil {
+		p.copySource += "?versionId=" + url.QueryEscape(*src.VersionID)
+	}
+
+	if !opts.Overwrite && (src.Bucket != bucket || src.Key != key) {
+		p.ifNoneMatch = aws.String("*")
+	}
+
+	p.checksumAlgorithm = opts.ChecksumAlgorithm
+	if p.checksumAlgorithm == "" {
+		p.checksumAlgorithm, _ = internal.S3ChecksumsFromHeadObject(head).Get()
+	}
+
+	switch {
+	case opts.SSECustomerKey != nil:
+	case opts.ServerSideEncryption != "":
+		p.serverSideEncryption, p.bucketKeyEnabled = opts.ServerSideEncryption, opts.BucketKeyEnabled
+		if opts.SSEKMSKeyID != "" {
+			p.sseKMSKeyID = aws.String(opts.SSEKMSKeyID)
+		}
+	case head.SSECustomerAlgorithm == nil:
+		p.serverSideEncryption, p.sseKMSKeyID, p.bucketKeyEnabled = head.ServerSideEncryption, head.SSEKMSKeyId, head.BucketKeyEnabled
+	}
+
+	return p
+}
+
+// storageClass returns the storage class of the copy.
+func (p *copyPlan) storageClass() types.StorageClass {
+	if p.opts.StorageClass != "" {
+		return p.opts.StorageClass
+	}
+
+	return p.head.StorageClass
+}
+
+func (p *copyPlan) copyObject(ctx context.Context, client copyClient) (r copyResult, err error) {
+	input := &s3.CopyObjectInput{
+		Bucket:                    aws.String(p.bucket),
+		Key:                       aws.String(p.key),
+		CopySource:                aws.String(p.copySource),
+		CopySourceIfMatch:         p.ifMatch,
+		IfNoneMatch:               p.ifNoneMatch,
+		ChecksumAlgorithm:         p.checksumAlgorithm,
+		ExpectedBucketOwner:       p.opts.ExpectedBucketOwner,
+		ExpectedSourceBucketOwner: p.opts.ExpectedSourceBucketOwner,
+		StorageClass:              p.storageClass(),
+		ServerSideEncryption:      p.serverSideEncryption,
+		SSEKMSKeyId:               p.sseKMSKeyID,
+		BucketKeyEnabled:          p.bucketKeyEnabled,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = p.opts.SSECustomerKey.Headers()
+	input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = p.opts.SourceSSECustomerKey.Headers()
+
+	output, err := client.CopyObject(ctx, input)
+	if err != nil {
+		return r, fmt.Errorf("copy object error: %w", err)
+	}
+
+	r.versionID, r.serverSideEncryption, r.sseKMSKeyID = output.VersionId, output.ServerSideEncryption, output.SSEKMSKeyId
+	if c := output.CopyObjectResult; c != nil {
+		r.etag = aws.ToString(c.ETag)
+		r.checksums = internal.S3Checksums{
+			ChecksumCRC32:     c.ChecksumCRC32,
+			ChecksumCRC32C:    c.ChecksumCRC32C,
+			ChecksumCRC64NVME: c.ChecksumCRC64NVME,
+			ChecksumSHA1:      c.ChecksumSHA1,
+			ChecksumSHA256:    c.ChecksumSHA256,
+		}
+	}
+
+	return r, nil
+}
+
+// copyMultipart copies the object with multipart upload using UploadPartCopy.
+//
+// Unlike CopyObject, CreateMultipartUpload does not copy the metadata or tags so they are given from the HeadObject and
+// GetObjectTagging responses. The multipart upload is aborted if any part fails.
+func (p *copyPlan) copyMultipart(ctx context.Context, client copyClient, size int64) (r copyResult, err error) {
+	partSize := p.opts.PartSize
+	if partSize <= 0 {
+		partSize = DefaultCopyPartSize
+	}
+	partSize = max(partSize, s3writer.MinPartSize)
+	if n := (size + s3writer.MaxPartCount - 1) / s3writer.MaxPartCount; n > partSize {
+		// round up to the nearest MiB.
+		partSize = (n + 1<<20 - 1) &^ (1<<20 - 1)
+	}
+	partSize = min(partSize, MaxCopyObjectSize)
+
+	concurrency := p.opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultCopyConcurrency
+	}
+
+	// like createResumableUpload, CRC32 and CRC64NVME use full-object checksums.
+	alg, checksumType := p.checksumAlgorithm, types.ChecksumType("")
+	switch alg {
+	case "":
+		alg, checksumType = types.ChecksumAlgorithmCrc32, types.ChecksumTypeFullObject
+	case types.ChecksumAlgorithmCrc32, types.ChecksumAlgorithmCrc64nvme:
+		checksumType = types.ChecksumTypeFullObject
+	}
+
+	createInput := &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(p.bucket),
+		Key:                  aws.String(p.key),
+		CacheControl:         p.head.CacheControl,
+		ChecksumAlgorithm:    alg,
+		ChecksumType:         checksumType,
+		ContentDisposition:   p.head.ContentDisposition,
+		ContentEncoding:      p.head.ContentEncoding,
+		ContentLanguage:      p.head.ContentLanguage,
+		ContentType:          p.head.ContentType,
+		ExpectedBucketOwner:  p.opts.ExpectedBucketOwner,
+		Metadata:             p.head.Metadata,
+		StorageClass:         p.storageClass(),
+		ServerSideEncryption: p.serverSideEncryption,
+		SSEKMSKeyId:          p.sseKMSKeyID,
+		BucketKeyEnabled:     p.bucketKeyEnabled,
+	}
+	createInput.SSECustomerAlgorithm, createInput.SSECustomerKey, createInput.SSECustomerKeyMD5 = p.opts.SSECustomerKey.Headers()
+
+	getObjectTaggingOutput, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket:              aws.String(p.src.Bucket),
+		Key:                 aws.String(p.src.Key),
+		VersionId:           p.src.VersionID,
+		ExpectedBucketOwner: p.opts.ExpectedSourceBucketOwner,
+	})
+	if err != nil {
+		return r, fmt.Errorf("get object tagging error: %w", err)
+	}
+	if len(getObjectTaggingOutput.TagSet) != 0 {
+		tags := url.Values{}
+		for _, tag := range getObjectTaggingOutput.TagSet {
+			tags.Add(aws.ToString(tag.Key), aws.ToString(tag.Value))
+		}
+		createInput.Tagging = aws.String(tags.Encode())
+	}
+
+	createOutput, err := client.CreateMultipartUpload(ctx, createInput)
+	if err != nil {
+		return r, fmt.Errorf("create multipart upload error: %w", err)
+	}
+	uploadID := createOutput.UploadId
+
+	defer func() {
+		if err != nil {
+			// the abort must be attempted even if ctx has been cancelled.
+			_, _ = client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+				Bucket:              aws.String(p.bucket),
+				Key:                 aws.String(p.key),
+				UploadId:            uploadID,
+				ExpectedBucketOwner: p.opts.ExpectedBucketOwner,
+			})
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	var (
+		partCount = int32((size + partSize - 1) / partSize)
+		parts     = make([]types.CompletedPart, 0, partCount)
+		mu        sync.Mutex
+		wg        sync.WaitGroup
+		sem       = make(chan struct{}, concurrency)
+	)
+
+	for partNumber := int32(1); partNumber <= partCount && ctx.Err() == nil; partNumber++ {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		start := int64(partNumber-1) * partSize
+		end := min(start+partSize, size) - 1
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			input := &s3.UploadPartCopyInput{
+				Bucket:                    aws.String(p.bucket),
+				Key:                       aws.String(p.key),
+				UploadId:                  uploadID,
+				PartNumber:                aws.Int32(partNumber),
+				CopySource:                aws.String(p.copySource),
+				CopySourceIfMatch:         p.ifMatch,
+				CopySourceRange:           aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+				ExpectedBucketOwner:       p.opts.ExpectedBucketOwner,
+				ExpectedSourceBucketOwner: p.opts.ExpectedSourceBucketOwner,
+			}
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = p.opts.SSECustomerKey.Headers()
+			input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = p.opts.SourceSSECustomerKey.Headers()
+
+			output, err := client.UploadPartCopy(ctx, input)
+			if err != nil {
+				cancel(fmt.Errorf("copy part %d error: %w", partNumber, err))
+				return
+			}
+
+			part := types.CompletedPart{PartNumber: aws.Int32(partNumber)}
+			if c := output.CopyPartResult; c != nil {
+				part.ETag = c.ETag
+				part.ChecksumCRC32, part.ChecksumCRC32C, part.ChecksumCRC64NVME = c.ChecksumCRC32, c.ChecksumCRC32C, c.ChecksumCRC64NVME
+				part.ChecksumSHA1, part.ChecksumSHA256 = c.ChecksumSHA1, c.ChecksumSHA256
+			}
+
+			mu.Lock()
+			parts = append(parts, part)
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if err = context.Cause(ctx); err != nil {
+		return r, err
+	}
+
+	slices.SortFunc(parts, func(a, b types.CompletedPart) int {
+		return int(aws.ToInt32(a.PartNumber) - aws.ToInt32(b.PartNumber))
+	})
+
+	completeInput := &s3.CompleteMultipartUploadInput{
+		Bucket:              aws.String(p.bucket),
+		Key:                 aws.String(p.key),
+		UploadId:            uploadID,
+		IfNoneMatch:         p.ifNoneMatch,
+		ExpectedBucketOwner: p.opts.ExpectedBucketOwner,
+		MultipartUpload:     &types.CompletedMultipartUpload{Parts: parts},
+	}
+	completeInput.SSECustomerAlgorithm, completeInput.SSECustomerKey, completeInput.SSECustomerKeyMD5 = p.opts.SSECustomerKey.Headers()
+
+	// the full-object checksum of the source can be validated against the copy if they use the same algorithm.
+	if checksumType == types.ChecksumTypeFullObject {
+		if srcAlg, value := internal.S3ChecksumsFromHeadObject(p.head).Get(); srcAlg == alg && p.head.ChecksumType == types.ChecksumTypeFullObject {
+			checksums := internal.NewS3Checksums(alg, value)
+			completeInput.ChecksumCRC32, completeInput.ChecksumCRC32C, completeInput.ChecksumCRC64NVME = checksums.ChecksumCRC32, checksums.ChecksumCRC32C, checksums.ChecksumCRC64NVME
+			completeInput.ChecksumType = types.ChecksumTypeFullObject
+			completeInput.MpuObjectSize = aws.Int64(size)
+		}
+	}
+
+	output, err := client.CompleteMultipartUpload(ctx, completeInput)
+	if err != nil {
+		return r, fmt.Errorf("complete multipart upload error: %w", err)
+	}
+
+	r.versionID, r.etag = output.VersionId, aws.ToString(output.ETag)
+	r.serverSideEncryption, r.sseKMSKeyID = output.ServerSideEncryption, output.SSEKMSKeyId
+	r.checksums = internal.S3Checksums{
+		ChecksumCRC32:     output.ChecksumCRC32,
+		ChecksumCRC32C:    output.ChecksumCRC32C,
+		ChecksumCRC64NVME: output.ChecksumCRC64NVME,
+		ChecksumSHA1:      output.ChecksumSHA1,
+		ChecksumSHA256:    output.ChecksumSHA256,
+	}
+
+	return r, nil
+}
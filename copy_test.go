@@ -0,0 +1,177 @@
+package xy3
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeCopyClient records the copy requests of an object that only exists as its HeadObject response and tags.
+type fakeCopyClient struct {
+	s3test.Client
+	tags []types.Tag
+
+	mu             sync.Mutex
+	copyObject     *s3.CopyObjectInput
+	createUpload   *s3.CreateMultipartUploadInput
+	partCopies     []*s3.UploadPartCopyInput
+	completeUpload *s3.CompleteMultipartUploadInput
+	aborted        bool
+}
+
+func (c *fakeCopyClient) CopyObject(_ context.Context, input *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	c.copyObject = input
+	return &s3.CopyObjectOutput{
+		VersionId:            aws.String("v2"),
+		ServerSideEncryption: input.ServerSideEncryption,
+		CopyObjectResult:     &types.CopyObjectResult{ETag: aws.String(`"copy"`), ChecksumSHA256: aws.String("sha256")},
+	}, nil
+}
+
+func (c *fakeCopyClient) GetObjectTagging(_ context.Context, _ *s3.GetObjectTaggingInput, _ ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	return &s3.GetObjectTaggingOutput{TagSet: c.tags}, nil
+}
+
+func (c *fakeCopyClient) CreateMultipartUpload(_ context.Context, input *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.createUpload = input
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil
+}
+
+func (c *fakeCopyClient) UploadPartCopy(_ context.Context, input *s3.UploadPartCopyInput, _ ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.partCopies = append(c.partCopies, input)
+	return &s3.UploadPartCopyOutput{CopyPartResult: &types.CopyPartResult{ETag: aws.String(fmt.Sprintf(`"part-%d"`, aws.ToInt32(input.PartNumber)))}}, nil
+}
+
+func (c *fakeCopyClient) CompleteMultipartUpload(_ context.Context, input *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	c.completeUpload = input
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"multipart-3"`), ChecksumCRC32: aws.String("crc32")}, nil
+}
+
+func (c *fakeCopyClient) AbortMultipartUpload(_ context.Context, _ *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestCopy(t *testing.T) {
+	head := &s3.HeadObjectOutput{
+		ContentLength:        aws.Int64(1024),
+		ETag:                 aws.String(`"source"`),
+		Metadata:             map[string]string{"checksum": "sha256-abc"},
+		ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String("key"),
+	}
+	client := &fakeCopyClient{Client: s3test.Client{Objects: map[string]*s3.HeadObjectOutput{"dir/a b.txt": head}}}
+	src := internal.Manifest{
+		Bucket:     "src",
+		Key:        "dir/a b.txt",
+		Size:       1024,
+		Checksum:   "sha256-abc",
+		Checksums:  []string{"blake3-def"},
+		VersionID:  aws.String("v1"),
+		ETag:       `"source"`,
+		Encryption: &internal.Encryption{Scheme: "age"},
+	}
+
+	man, err := copyObject(context.Background(), client, src, "dst", "prefix/a b.txt", &CopyOptions{StorageClass: types.StorageClassStandardIa})
+	require.NoError(t, err)
+
+	input := client.copyObject
+	require.NotNil(t, input)
+	assert.Equal(t, "src/dir/a%20b.txt?versionId=v1", aws.ToString(input.CopySource))
+	assert.Equal(t, `"source"`, aws.ToString(input.CopySourceIfMatch))
+	assert.Equal(t, "*", aws.ToString(input.IfNoneMatch))
+	assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+	assert.Equal(t, types.ServerSideEncryptionAwsKms, input.ServerSideEncryption)
+	assert.Equal(t, "key", aws.ToString(input.SSEKMSKeyId))
+
+	assert.Equal(t, internal.Manifest{
+		Bucket:              "dst",
+		Key:                 "prefix/a b.txt",
+		Size:                1024,
+		Checksum:            "sha256-abc",
+		Checksums:           []string{"blake3-def"},
+		VersionID:           aws.String("v2"),
+		ETag:                `"copy"`,
+		S3ChecksumAlgorithm: "SHA256",
+		S3Checksum:          "sha256",
+		SSE:                 "aws:kms",
+		Encryption:          &internal.Encryption{Scheme: "age"},
+	}, man)
+
+	// copying over itself does not need IfNoneMatch.
+	_, err = copyObject(context.Background(), client, src, "src", "dir/a b.txt", &CopyOptions{StorageClass: types.StorageClassGlacier})
+	require.NoError(t, err)
+	assert.Nil(t, client.copyObject.IfNoneMatch)
+
+	changed := src
+	changed.ETag = `"other"`
+	_, err = copyObject(context.Background(), client, changed, "dst", "key", &CopyOptions{})
+	assert.ErrorIs(t, err, ErrObjectChanged)
+
+	head.StorageClass = types.StorageClassDeepArchive
+	_, err = copyObject(context.Background(), client, src, "dst", "key", &CopyOptions{})
+	assert.ErrorIs(t, err, ErrObjectNotRestored)
+}
+
+func TestCopy_Multipart(t *testing.T) {
+	size := MaxCopyObjectSize + 1
+	client := &fakeCopyClient{Client: s3test.Client{Objects: map[string]*s3.HeadObjectOutput{"key": {
+		ContentLength: aws.Int64(size),
+		ETag:          aws.String(`"source-2"`),
+		ContentType:   aws.String("application/zstd"),
+		Metadata:      map[string]string{"checksum": "sha256-abc"},
+	}}}, tags: []types.Tag{
+		{Key: aws.String("project"), Value: aws.String("a b")},
+		{Key: aws.String("owner"), Value: aws.String("me")},
+	}}
+	src := internal.Manifest{Bucket: "src", Key: "key"}
+
+	man, err := copyObject(context.Background(), client, src, "dst", "key", &CopyOptions{PartSize: 2 * 1024 * 1024 * 1024, Overwrite: true})
+	require.NoError(t, err)
+	assert.Nil(t, client.copyObject)
+	assert.False(t, client.aborted)
+
+	// the metadata must be given to CreateMultipartUpload explicitly.
+	require.NotNil(t, client.createUpload)
+	assert.Equal(t, map[string]string{"checksum": "sha256-abc"}, client.createUpload.Metadata)
+	assert.Equal(t, "application/zstd", aws.ToString(client.createUpload.ContentType))
+	assert.Equal(t, types.ChecksumAlgorithmCrc32, client.createUpload.ChecksumAlgorithm)
+
+	// so must the tags.
+	assert.Equal(t, "owner=me&project=a+b", aws.ToString(client.createUpload.Tagging))
+
+	ranges := make(map[int32]string)
+	for _, input := range client.partCopies {
+		ranges[aws.ToInt32(input.PartNumber)] = aws.ToString(input.CopySourceRange)
+		assert.Equal(t, `"source-2"`, aws.ToString(input.CopySourceIfMatch))
+	}
+	assert.Equal(t, map[int32]string{
+		1: "bytes=0-2147483647",
+		2: "bytes=2147483648-4294967295",
+		3: fmt.Sprintf("bytes=4294967296-%d", size-1),
+	}, ranges)
+
+	require.NotNil(t, client.completeUpload)
+	assert.Nil(t, client.completeUpload.IfNoneMatch)
+	for i, p := range client.completeUpload.MultipartUpload.Parts {
+		assert.Equal(t, int32(i+1), aws.ToInt32(p.PartNumber))
+		assert.Equal(t, fmt.Sprintf(`"part-%d"`, i+1), aws.ToString(p.ETag))
+	}
+
+	assert.Equal(t, size, man.Size)
+	assert.Equal(t, "sha256-abc", man.Checksum)
+	assert.Equal(t, `"multipart-3"`, man.ETag)
+	assert.Equal(t, "CRC32", man.S3ChecksumAlgorithm)
+}
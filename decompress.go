@@ -2,8 +2,10 @@ package xy3
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -19,8 +21,28 @@ import (
 type DecompressOptions struct {
 	// NoExtract if true will only decompress archives without extracting their contents.
 	NoExtract bool
+
+	// Recursive if true will also extract the archives found among the extracted files.
+	//
+	// Nested archives are recognised either by their names (see NewDecompressorFromName) or by sniffing their contents
+	// (see archive.Detect). Each nested archive is extracted in place into a new directory next to it using the same
+	// naming and root-unwrapping rules as the top-level archive. Archives recognised by their names are then deleted,
+	// while files that are recognised only by sniffing are always left intact whether they can be extracted or not
+	// (e.g. a gzip file that does not contain a tar archive). Documents and packages that happen to be zip containers
+	// such as .docx, .xlsx, .odt, .epub, .jar, or .apk are never extracted.
+	//
+	// Has no effect if NoExtract is true.
+	Recursive bool
+
+	// MaxDepth limits how many levels of nested archives are extracted if Recursive is true.
+	//
+	// Default to DefaultMaxDepth.
+	MaxDepth int
 }
 
+// DefaultMaxDepth is the default value for DecompressOptions.MaxDepth.
+const DefaultMaxDepth = 5
+
 // Decompress decompresses and optionally extracts the named file or archive to the given parent directory.
 //
 // If the file specified by "name" is an archive, the returned "target" string will be the name of the directory
@@ -36,7 +58,22 @@ func Decompress(ctx context.Context, name, dir string, optFns ...func(*Decompres
 		return decompress(ctx, name, dir)
 	}
 
-	return extract(ctx, name, dir)
+	// use the file's base name to detect a decompressor.
+	arc := NewDecompressorFromName(filepath.Base(name))
+	if arc == nil {
+		return "", fmt.Errorf(`no supported decompression algorithm for file "%s"`, filepath.Base(name))
+	}
+
+	if target, err = extract(ctx, name, dir, arc); err != nil || !opts.Recursive {
+		return
+	}
+
+	maxDepth := opts.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxDepth
+	}
+
+	return target, extractNested(ctx, target, maxDepth)
 }
 
 func decompress(ctx context.Context, name, dir string) (string, error) {
@@ -87,13 +124,7 @@ func decompress(ctx context.Context, name, dir string) (string, error) {
 	return dst.Name(), nil
 }
 
-func extract(ctx context.Context, name, dir string) (string, error) {
-	// use the file's base name to detect a decompressor.
-	arc := NewDecompressorFromName(filepath.Base(name))
-	if arc == nil {
-		return "", fmt.Errorf(`no supported decompression algorithm for file "%s"`, filepath.Base(name))
-	}
-
+func extract(ctx context.Context, name, dir string, arc archive.Archiver) (string, error) {
 	// decompress and extract contents into a unique directory.
 	stem, _ := commons.StemExt(strings.TrimSuffix(name, arc.ArchiveExt()))
 	target, err := commons.MkExclDir(dir, stem, 0755)
@@ -180,6 +211,90 @@ func extract(ctx context.Context, name, dir string) (string, error) {
 	return target, nil
 }
 
+// zipContainerExts are the extensions of file formats that are zip archives but are meant to be used as-is.
+var zipContainerExts = map[string]bool{
+	".docx": true, ".docm": true, ".dotx": true, ".xlsx": true, ".xlsm": true, ".xltx": true, ".pptx": true, ".pptm": true,
+	".potx": true, ".vsdx": true, ".odt": true, ".ods": true, ".odp": true, ".odg": true, ".ott": true, ".epub": true,
+	".jar": true, ".war": true, ".ear": true, ".aar": true, ".apk": true, ".aab": true, ".ipa": true, ".xpi": true,
+	".whl": true, ".nupkg": true, ".vsix": true, ".kmz": true, ".3mf": true, ".usdz": true,
+}
+
+// extractNested finds the nested archives in the given directory to extract in place, up to the given depth.
+func extractNested(ctx context.Context, dir string, depth int) error {
+	if depth <= 0 {
+		return nil
+	}
+
+	type nestedArchive struct {
+		name    string
+		arc     archive.Archiver
+		sniffed bool
+	}
+
+	// find all nested archives first so that the walk does not see the newly extracted files.
+	archives := make([]nestedArchive, 0)
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		if arc := NewDecompressorFromName(d.Name()); arc != nil {
+			archives = append(archives, nestedArchive{name: path, arc: arc})
+			return nil
+		}
+
+		if zipContainerExts[strings.ToLower(filepath.Ext(d.Name()))] {
+			return nil
+		}
+
+		f, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf(`open file "%s" error: %w`, path, err)
+		}
+		defer f.Close()
+
+		if arc, err := archive.Detect(f); err == nil {
+			archives = append(archives, nestedArchive{name: path, arc: arc, sniffed: true})
+		}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf(`find nested archives in "%s" error: %w`, dir, err)
+	}
+
+	for _, a := range archives {
+		target, err := extract(ctx, a.name, filepath.Dir(a.name), a.arc)
+		if err != nil {
+			if a.sniffed && !errors.Is(err, context.Canceled) {
+				continue
+			}
+
+			return fmt.Errorf(`extract nested archive "%s" error: %w`, a.name, err)
+		}
+
+		// the name does not say that the file is an archive so it may still be useful as-is.
+		if !a.sniffed {
+			if err = os.Remove(a.name); err != nil {
+				return fmt.Errorf(`delete nested archive "%s" error: %w`, a.name, err)
+			}
+		}
+
+		if err = extractNested(ctx, target, depth-1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // findRootDir inspects the named archive and return the root dir (if exits).
 //
 // And since we're already looking through all the files to find root dir, let's tally up the count and total
@@ -0,0 +1,115 @@
+package xy3
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nguyengg/xy3/archive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress_Recursive(t *testing.T) {
+	// test.txt
+	expected := "Mr. Jock, TV quiz PhD, bags few lynx\n"
+
+	tests := []struct {
+		name     string
+		maxDepth int
+		// exists and notExists are relative to the extracted directory.
+		exists    map[string]string
+		notExists []string
+	}{
+		{
+			name: "default depth",
+			exists: map[string]string{
+				"inner/test/test.txt": expected,
+				"deep/test/test.txt":  expected,
+			},
+			notExists: []string{"inner/test.tar.gz", "deep.zip", "deep/test.tar.gz"},
+		},
+		{
+			name:     "max depth 1",
+			maxDepth: 1,
+			exists: map[string]string{
+				"inner/test/test.txt": expected,
+			},
+			notExists: []string{"inner/test.tar.gz", "deep.zip", "deep/test/test.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+
+			// deep.zip contains test.tar.gz which needs two levels of recursion to be extracted.
+			deep := filepath.Join(dir, "deep.zip")
+			createZip(t, deep, map[string]string{"test.tar.gz": "testdata/test.tar.gz"})
+
+			// report.docx is a zip container that must never be extracted.
+			docx := filepath.Join(dir, "report.docx")
+			createZip(t, docx, map[string]string{"word/document.xml": "testdata/test.txt"})
+
+			// data.bin is a gzip file that does not contain a tar archive so it must be left intact, while payload.bin is
+			// a zip archive that is only recognised by sniffing so it must be extracted but also left intact.
+			outer := filepath.Join(dir, "outer.zip")
+			createZip(t, outer, map[string]string{
+				"inner/test.tar.gz": "testdata/test.tar.gz",
+				"deep.zip":          deep,
+				"data.bin":          "testdata/test.txt.gz",
+				"report.docx":       docx,
+				"payload.bin":       deep,
+			})
+
+			target, err := Decompress(t.Context(), outer, dir, func(opts *DecompressOptions) {
+				opts.Recursive = true
+				opts.MaxDepth = tt.maxDepth
+			})
+			assert.NoError(t, err)
+
+			for name, content := range tt.exists {
+				data, err := os.ReadFile(filepath.Join(target, name))
+				assert.NoError(t, err)
+				assert.Equal(t, content, string(data))
+			}
+
+			for _, name := range tt.notExists {
+				assert.NoFileExists(t, filepath.Join(target, name))
+			}
+
+			assert.FileExists(t, filepath.Join(target, "data.bin"))
+			assert.FileExists(t, filepath.Join(target, "payload.bin"))
+			assert.FileExists(t, filepath.Join(target, "report.docx"))
+			assert.NoDirExists(t, filepath.Join(target, "report"))
+			assert.NoDirExists(t, filepath.Join(target, "word"))
+		})
+	}
+}
+
+// createZip creates a zip archive at name whose files' contents are copied from the given local files.
+func createZip(t *testing.T, name string, files map[string]string) {
+	f, err := os.Create(name)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	add, closer, err := archive.Zip{}.Create(f, "")
+	assert.NoError(t, err)
+
+	for path, src := range files {
+		r, err := os.Open(src)
+		assert.NoError(t, err)
+
+		fi, err := r.Stat()
+		assert.NoError(t, err)
+
+		w, err := add(path, fi)
+		assert.NoError(t, err)
+
+		_, err = io.Copy(w, r)
+		assert.NoError(t, err)
+		_, _ = w.Close(), r.Close()
+	}
+
+	assert.NoError(t, closer())
+}
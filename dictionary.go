@@ -0,0 +1,126 @@
+package xy3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// TrainDictionaryOptions customises TrainDictionary.
+type TrainDictionaryOptions struct {
+	// MaxSamples is the maximum number of files to sample.
+	//
+	// If the directory has more files than MaxSamples, the samples are picked evenly across all files (in lexical
+	// order). Default to 10000.
+	MaxSamples int
+
+	// MaxSampleSize is the maximum number of bytes to read from each sampled file.
+	//
+	// Default to 128 KiB.
+	MaxSampleSize int
+
+	// MaxDictSize is the maximum size of the dictionary.
+	//
+	// Default to 112640 bytes, the same default as the zstd CLI.
+	MaxDictSize int
+}
+
+// TrainDictionary trains a zstd dictionary from a sample of the regular files in the given directory.
+//
+// Dictionaries are most effective for directories with many small files of the same type (e.g. JSON logs). The
+// returned dictionary can be passed to CompressOptions.ZstdDictionary.
+func TrainDictionary(ctx context.Context, dir string, optFns ...func(*TrainDictionaryOptions)) ([]byte, error) {
+	opts := &TrainDictionaryOptions{
+		MaxSamples:    10000,
+		MaxSampleSize: 128 * 1024,
+		MaxDictSize:   112640,
+	}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	names := make([]string, 0)
+	if err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case d.Type().IsRegular():
+			names = append(names, path)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf(`walk dir "%s" error: %w`, dir, err)
+	}
+
+	if len(names) == 0 {
+		return nil, fmt.Errorf(`no files to sample in "%s"`, dir)
+	}
+
+	n := min(len(names), opts.MaxSamples)
+	samples := make([][]byte, 0, n)
+	buf := make([]byte, opts.MaxSampleSize)
+	for i := range n {
+		name := names[i*len(names)/n]
+
+		data, err := readSample(name, buf)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(data) != 0 {
+			samples = append(samples, data)
+		}
+	}
+
+	d, err := codec.TrainZstdDictionary(samples, opts.MaxDictSize)
+	if err != nil {
+		return nil, fmt.Errorf("train zstd dictionary error: %w", err)
+	}
+
+	return d, nil
+}
+
+// TryTrainDictionary is a variant of TrainDictionary that logs the ID of the trained dictionary instead of failing.
+//
+// The logger attached to ctx is used if there is one. Errors are logged, in which case nil and 0 are returned so that
+// the directory can be compressed without dictionary.
+func TryTrainDictionary(ctx context.Context, dir string, optFns ...func(*TrainDictionaryOptions)) (dict []byte, id uint32) {
+	logger := internal.Logger(ctx)
+
+	dict, err := TrainDictionary(ctx, dir, optFns...)
+	if err == nil {
+		id, err = codec.ZstdDictionaryID(dict)
+	}
+	if err != nil {
+		logger.Printf("train zstd dictionary error, will compress without dictionary: %v", err)
+		return nil, 0
+	}
+
+	logger.Printf("trained zstd dictionary (id=%d, size=%d)", id, len(dict))
+	return dict, id
+}
+
+// readSample reads up to len(buf) bytes from the named file, returning a copy of the bytes read.
+func readSample(name string, buf []byte) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+	defer f.Close()
+
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf(`read file "%s" error: %w`, name, err)
+	}
+
+	return append([]byte(nil), buf[:n]...), nil
+}
@@ -0,0 +1,71 @@
+package xy3
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nguyengg/xy3/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrainDictionary(t *testing.T) {
+	ctx := t.Context()
+
+	// many small JSON files that look alike.
+	dir := filepath.Join(t.TempDir(), "logs")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	for i := range 500 {
+		data := fmt.Sprintf(`{"timestamp":"2024-01-01T00:00:%02dZ","level":"info","requestId":"%08x","message":"request #%d completed","latencyMs":%d}`, i%60, i*7919, i, i%250)
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%04d.json", i)), []byte(data), 0644))
+	}
+
+	d, err := TrainDictionary(ctx, dir, func(opts *TrainDictionaryOptions) {
+		opts.MaxDictSize = 4096
+	})
+	assert.NoError(t, err)
+
+	id, err := codec.ZstdDictionaryID(d)
+	assert.NoError(t, err)
+	assert.NotZero(t, id)
+
+	var buf bytes.Buffer
+	err = CompressDir(ctx, dir, &buf, func(opts *CompressOptions) {
+		opts.Algorithm = "zstd"
+		opts.ZstdDictionary = d
+	})
+	assert.NoError(t, err)
+
+	// the dictionary must be embedded in the archive.
+	embedded, err := codec.ExtractZstdDictionary(bytes.NewReader(buf.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, d, embedded)
+
+	// Decompress must be able to find and use the embedded dictionary on its own.
+	archiveName := filepath.Join(t.TempDir(), "logs.tar.zst")
+	assert.NoError(t, os.WriteFile(archiveName, buf.Bytes(), 0644))
+
+	target, err := Decompress(ctx, archiveName, t.TempDir())
+	assert.NoError(t, err)
+
+	entries, err := os.ReadDir(target)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 500)
+
+	for _, name := range []string{"0000.json", "0123.json", "0499.json"} {
+		expected, err := os.ReadFile(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		actual, err := os.ReadFile(filepath.Join(target, name))
+		assert.NoError(t, err)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestTryTrainDictionary_NoFiles(t *testing.T) {
+	// a directory without files cannot be sampled, so the caller should compress without dictionary.
+	d, id := TryTrainDictionary(t.Context(), t.TempDir())
+	assert.Nil(t, d)
+	assert.Zero(t, id)
+}
@@ -0,0 +1,308 @@
+package xy3
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/xy3/archive"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/zipper"
+)
+
+// DiffEntry describes a regular file from a directory or an archive to be compared with Diff.
+type DiffEntry struct {
+	// Name is the slash-separated path of the file relative to the directory or the root of the archive.
+	Name string `json:"name"`
+
+	// Size is the uncompressed size of the file.
+	Size int64 `json:"size"`
+
+	// ModTime is the modification time of the file.
+	ModTime time.Time `json:"modTime"`
+
+	// CRC32 is the IEEE CRC-32 checksum of the file's content.
+	//
+	// CRC32 may be nil for files from a directory listing since they are only computed by Diff when needed.
+	CRC32 *uint32 `json:"crc32,omitempty"`
+
+	// open is used to compute CRC32 lazily.
+	open func() (io.ReadCloser, error)
+}
+
+// DiffChange describes a file that exists in both listings but has been modified.
+type DiffChange struct {
+	// Name is the slash-separated path of the file.
+	Name string `json:"name"`
+
+	// From is the file from the first listing.
+	From DiffEntry `json:"from"`
+
+	// To is the file from the second listing.
+	To DiffEntry `json:"to"`
+
+	// Reasons lists the properties that are different; possible values are "size", "crc32", and "modTime".
+	Reasons []string `json:"reasons"`
+}
+
+// DiffResult is the result of Diff.
+//
+// All slices are sorted by name.
+type DiffResult struct {
+	// Added contains the files that exist only in the second listing.
+	Added []DiffEntry `json:"added"`
+
+	// Removed contains the files that exist only in the first listing.
+	Removed []DiffEntry `json:"removed"`
+
+	// Modified contains the files that exist in both listings but are different.
+	Modified []DiffChange `json:"modified"`
+}
+
+// Empty returns true if there is no difference.
+func (r *DiffResult) Empty() bool {
+	return len(r.Added) == 0 && len(r.Removed) == 0 && len(r.Modified) == 0
+}
+
+// DiffOptions customises Diff.
+type DiffOptions struct {
+	// CompareModTime if true will also report files whose modification times are different as modified.
+	//
+	// Because zip stores modification time in MS-DOS format with 2-second precision, modification times that are
+	// within 2 seconds of each other are considered equal.
+	CompareModTime bool
+}
+
+// Diff compares two listings from ListDir, ListArchive, or ListZip.
+//
+// Files with the same name are compared by size first. Only if their sizes are equal will their CRC32 checksums be
+// compared, which may require reading the files from a directory listing to compute.
+func Diff(ctx context.Context, from, to []DiffEntry, optFns ...func(*DiffOptions)) (*DiffResult, error) {
+	opts := &DiffOptions{}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	toByName := make(map[string]DiffEntry, len(to))
+	for _, e := range to {
+		toByName[e.Name] = e
+	}
+
+	res := &DiffResult{
+		Added:    make([]DiffEntry, 0),
+		Removed:  make([]DiffEntry, 0),
+		Modified: make([]DiffChange, 0),
+	}
+
+	for _, a := range from {
+		b, ok := toByName[a.Name]
+		if !ok {
+			res.Removed = append(res.Removed, a)
+			continue
+		}
+		delete(toByName, a.Name)
+
+		reasons := make([]string, 0)
+		if a.Size != b.Size {
+			reasons = append(reasons, "size")
+		} else {
+			for _, e := range []*DiffEntry{&a, &b} {
+				if err := e.computeCRC32(ctx); err != nil {
+					return nil, err
+				}
+			}
+
+			if a.CRC32 != nil && b.CRC32 != nil && *a.CRC32 != *b.CRC32 {
+				reasons = append(reasons, "crc32")
+			}
+		}
+
+		if opts.CompareModTime && a.ModTime.Sub(b.ModTime).Abs() > 2*time.Second {
+			reasons = append(reasons, "modTime")
+		}
+
+		if len(reasons) != 0 {
+			res.Modified = append(res.Modified, DiffChange{Name: a.Name, From: a, To: b, Reasons: reasons})
+		}
+	}
+
+	for _, b := range toByName {
+		res.Added = append(res.Added, b)
+	}
+
+	byName := func(a, b DiffEntry) int { return cmp.Compare(a.Name, b.Name) }
+	slices.SortFunc(res.Added, byName)
+	slices.SortFunc(res.Removed, byName)
+	slices.SortFunc(res.Modified, func(a, b DiffChange) int { return cmp.Compare(a.Name, b.Name) })
+
+	return res, nil
+}
+
+func (e *DiffEntry) computeCRC32(ctx context.Context) error {
+	if e.CRC32 != nil || e.open == nil {
+		return nil
+	}
+
+	r, err := e.open()
+	if err != nil {
+		return fmt.Errorf(`open file "%s" error: %w`, e.Name, err)
+	}
+	defer r.Close()
+
+	h := crc32.NewIEEE()
+	if _, err = commons.CopyBufferWithContext(ctx, h, r, nil); err != nil {
+		return fmt.Errorf(`compute crc32 of file "%s" error: %w`, e.Name, err)
+	}
+
+	v := h.Sum32()
+	e.CRC32 = &v
+	return nil
+}
+
+// ListDir lists the regular files in the given directory for use with Diff.
+//
+// The CRC32 checksums of the files are not computed until Diff needs them.
+func ListDir(ctx context.Context, dir string) ([]DiffEntry, error) {
+	entries := make([]DiffEntry, 0)
+
+	if err := zipper.WalkRegularFiles(ctx, dir, func(path string, d fs.DirEntry) error {
+		fi, err := d.Info()
+		if err != nil {
+			return fmt.Errorf(`describe file "%s" error: %w`, path, err)
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf(`compute relative path of file "%s" error: %w`, path, err)
+		}
+
+		entries = append(entries, DiffEntry{
+			Name:    filepath.ToSlash(rel),
+			Size:    fi.Size(),
+			ModTime: fi.ModTime(),
+			open: func() (io.ReadCloser, error) {
+				return os.Open(path)
+			},
+		})
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// ListArchive lists the regular files in the archive read from src for use with Diff.
+//
+// Because most archive formats can only be read sequentially, the content of every file is read to compute its CRC32
+// checksum. Use ListZip for zip archives that support random access instead. If the archive has a single common root
+// directory, the root directory is removed from the names the same way extracting the archive would.
+func ListArchive(ctx context.Context, src io.Reader, from archive.Archiver) ([]DiffEntry, error) {
+	files, err := from.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("read archive error: %w", err)
+	}
+
+	entries := make([]DiffEntry, 0)
+	buf := make([]byte, 32*1024)
+
+	for f, err := range files {
+		if err != nil {
+			return nil, fmt.Errorf("read archive error: %w", err)
+		}
+
+		name, fi := f.Name(), f.FileInfo()
+		if fi.IsDir() || strings.HasSuffix(name, "/") || !fi.Mode().IsRegular() {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, fmt.Errorf(`open archive file "%s" error: %w`, name, err)
+		}
+
+		h := crc32.NewIEEE()
+		n, err := commons.CopyBufferWithContext(ctx, h, r, buf)
+		_ = r.Close()
+		if err != nil {
+			return nil, fmt.Errorf(`read archive file "%s" error: %w`, name, err)
+		}
+
+		v := h.Sum32()
+		entries = append(entries, DiffEntry{
+			Name:    name,
+			Size:    n,
+			ModTime: fi.ModTime(),
+			CRC32:   &v,
+		})
+	}
+
+	return unwrapRoot(entries), nil
+}
+
+// ListZip lists the regular files in the zip archive read from src by scanning only its central directory.
+//
+// Unlike ListArchive, the content of the files are never read since the central directory already contains their
+// uncompressed sizes and CRC32 checksums. This makes ListZip suitable for listing remote zip archives with
+// s3reader.Reader. If the archive has a single common root directory, the root directory is removed from the names the
+// same way extracting the archive would.
+func ListZip(src io.ReadSeeker, size int64) ([]DiffEntry, error) {
+	cd, err := zipper.NewCDScanner(src, size)
+	if err != nil {
+		return nil, fmt.Errorf("scan central directory error: %w", err)
+	}
+
+	entries := make([]DiffEntry, 0, cd.RecordCount())
+	for fh := range cd.All() {
+		if fh.FileInfo().IsDir() || strings.HasSuffix(fh.Name, "/") {
+			continue
+		}
+
+		v := fh.CRC32
+		entries = append(entries, DiffEntry{
+			Name:    fh.Name,
+			Size:    int64(fh.UncompressedSize64),
+			ModTime: fh.Modified,
+			CRC32:   &v,
+		})
+	}
+	if err = cd.Err(); err != nil {
+		return nil, fmt.Errorf("scan central directory error: %w", err)
+	}
+
+	return unwrapRoot(entries), nil
+}
+
+// unwrapRoot removes the common root directory (if exists) from the names of the entries.
+func unwrapRoot(entries []DiffEntry) []DiffEntry {
+	rootFinder := internal.NewZipRootDirFinder()
+
+	var (
+		rootDir internal.RootDir
+		ok      bool
+	)
+	for _, e := range entries {
+		if rootDir, ok = rootFinder(e.Name); !ok {
+			return entries
+		}
+	}
+
+	if rootDir == "" {
+		return entries
+	}
+
+	for i := range entries {
+		entries[i].Name = strings.TrimLeft(strings.TrimPrefix(entries[i].Name, string(rootDir)), `/\`)
+	}
+
+	return entries
+}
@@ -0,0 +1,76 @@
+package xy3
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := t.Context()
+
+	// all test archives contain a single test.txt with the same content as testdata/test.txt.
+	list := func(t *testing.T, name string) []DiffEntry {
+		src, err := os.Open(name)
+		assert.NoError(t, err)
+		defer src.Close()
+
+		if filepath.Ext(name) == ".zip" {
+			fi, err := src.Stat()
+			assert.NoError(t, err)
+
+			entries, err := ListZip(src, fi.Size())
+			assert.NoError(t, err)
+			return entries
+		}
+
+		entries, err := ListArchive(ctx, src, NewDecompressorFromName(name))
+		assert.NoError(t, err)
+		return entries
+	}
+
+	t.Run("archives are equal", func(t *testing.T) {
+		zipEntries := list(t, "testdata/test.zip")
+		for _, name := range []string{"testdata/test.7z", "testdata/test.rar", "testdata/test.tar.gz", "testdata/test.tar.xz", "testdata/test.tar.zst"} {
+			res, err := Diff(ctx, zipEntries, list(t, name))
+			assert.NoError(t, err)
+			assert.Truef(t, res.Empty(), "%s: %#v", name, res)
+		}
+	})
+
+	t.Run("directory against archive", func(t *testing.T) {
+		dir := t.TempDir()
+
+		data, err := os.ReadFile("testdata/test.txt")
+		assert.NoError(t, err)
+
+		// same size but different content will require computing CRC32.
+		data[0] = 'm'
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "test.txt"), data, 0644))
+		assert.NoError(t, os.MkdirAll(filepath.Join(dir, "path"), 0755))
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "path", "b.txt"), []byte("hello, world!"), 0644))
+
+		dirEntries, err := ListDir(ctx, dir)
+		assert.NoError(t, err)
+
+		res, err := Diff(ctx, list(t, "testdata/test.zip"), dirEntries)
+		assert.NoError(t, err)
+
+		assert.Len(t, res.Added, 1)
+		assert.Equal(t, "path/b.txt", res.Added[0].Name)
+		assert.Empty(t, res.Removed)
+		assert.Len(t, res.Modified, 1)
+		assert.Equal(t, "test.txt", res.Modified[0].Name)
+		assert.Equal(t, []string{"crc32"}, res.Modified[0].Reasons)
+
+		// reversing the order swaps added and removed.
+		res, err = Diff(ctx, dirEntries, list(t, "testdata/test.7z"))
+		assert.NoError(t, err)
+		assert.Empty(t, res.Added)
+		assert.Len(t, res.Removed, 1)
+		assert.Equal(t, "path/b.txt", res.Removed[0].Name)
+		assert.Len(t, res.Modified, 1)
+	})
+}
@@ -9,9 +9,11 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/s3reader"
-	"github.com/nguyengg/go-aws-commons/sri"
 	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
 )
 
@@ -35,36 +37,113 @@ type DownloadOptions struct {
 	// By default, if the S3 object has metadata attribute named "checksum", its value will be used.
 	// ExpectedChecksum will override this.
 	ExpectedChecksum string
+
+	// ExpectedChecksums are the additional digests to verify against (see internal.Manifest.Checksums).
+	//
+	// Every digest whose algorithm is supported must match.
+	ExpectedChecksums []string
+
+	// DisableS3Checksum disables verifying the S3 additional checksum (e.g. SHA256, CRC32C, CRC64NVME).
+	//
+	// By default, the object is requested with ChecksumMode enabled, and if the object has an additional checksum,
+	// the downloaded contents are verified against it as well as the "checksum" metadata.
+	DisableS3Checksum bool
+
+	// Decrypter if given decodes the contents on the fly before they are written to dst (e.g. codec.AgeCodec).
+	//
+	// The checksum is still verified against the encrypted contents as downloaded.
+	Decrypter codec.Codec
+
+	// Concurrency if greater than 1 enables the parallel mode that downloads this many byte ranges of PartSize
+	// concurrently and writes each range with io.WriterAt to its offset in the preallocated file.
+	//
+	// The checksums are computed by an in-order hashing stage that reads the ranges back from the file as soon as the
+	// ranges before them have been written. See Download and DownloadFile for when the parallel mode is available.
+	Concurrency int
+
+	// PartSize is the size of each byte range in parallel mode.
+	//
+	// Default to DefaultDownloadPartSize.
+	PartSize int64
+
+	// MaxRetries is the number of times a byte range that fails is retried in parallel mode before giving up.
+	//
+	// Default to DefaultDownloadMaxRetries. Set to a negative value to disable retries.
+	MaxRetries int
 }
 
+const (
+	// DefaultDownloadPartSize is the default value for DownloadOptions.PartSize.
+	DefaultDownloadPartSize = int64(8 * 1024 * 1024)
+
+	// DefaultDownloadMaxRetries is the default value for DownloadOptions.MaxRetries.
+	DefaultDownloadMaxRetries = 3
+)
+
 // Download downloads the S3 object specified by its bucket and key, and writes the contents to the given io.Writer.
 //
-// If the checksum mismatches, ErrChecksumMismatch will be returned.
+// If DownloadOptions.Concurrency is greater than 1 and dst is an *os.File (or implements both io.ReaderAt and
+// io.WriterAt), the parallel mode is used: the contents are written starting at offset 0 of dst regardless of its
+// current position, and dst is truncated to the object's size first if it has a Truncate method.
+//
+// If the object is archived (e.g. GLACIER or DEEP_ARCHIVE) and has not been restored, ErrObjectNotRestored will be
+// returned before any byte is written. If the checksum mismatches, ErrChecksumMismatch will be returned.
 func Download(ctx context.Context, client *s3.Client, bucket, key string, dst io.Writer, optFns ...func(*DownloadOptions)) error {
 	opts := &DownloadOptions{}
 	for _, fn := range optFns {
 		fn(opts)
 	}
 
-	// headObject to see if there's a checksum to be used. the response's size is also used.
-	headObjectInput := &s3.HeadObjectInput{Bucket: &bucket, Key: &key}
-	if opts.HeadObjectInputOptions != nil {
-		opts.HeadObjectInputOptions(headObjectInput)
+	if f, ok := dst.(readerWriterAt); ok && opts.Concurrency > 1 && opts.Decrypter == nil {
+		return downloadParallel(ctx, client, bucket, key, f, opts, nil)
 	}
-	headObjectResult, err := client.HeadObject(ctx, headObjectInput)
+
+	return download(ctx, client, bucket, key, dst, opts, nil)
+}
+
+// resumeFunc is called by download with the HeadObject response to determine how many bytes have already been
+// downloaded.
+//
+// The returned io.Reader provides those existing bytes so that they can be hashed again; dst must be ready to receive
+// the bytes after offset.
+type resumeFunc func(headObjectResult *s3.HeadObjectOutput) (existing io.Reader, offset int64, err error)
+
+// download implements the sequential mode of Download and DownloadFile.
+//
+// If resume is non-nil, only the bytes after the offset returned by resume are downloaded.
+func download(ctx context.Context, client s3reader.GetAndHeadObjectClient, bucket, key string, dst io.Writer, opts *DownloadOptions, resume resumeFunc) error {
+	p, err := newDownloadPlan(ctx, client, bucket, key, opts)
 	if err != nil {
-		return fmt.Errorf("head object error: %w", err)
+		return err
 	}
 
-	getObjectInput := &s3.GetObjectInput{Bucket: &bucket, Key: &key}
-	if opts.GetObjectInputOptions != nil {
-		opts.GetObjectInputOptions(getObjectInput)
+	var (
+		size     = aws.ToInt64(p.headObjectResult.ContentLength)
+		existing io.Reader
+		offset   int64
+	)
+	if resume != nil {
+		if existing, offset, err = resume(p.headObjectResult); err != nil {
+			return err
+		}
 	}
+
+	// when resuming, the remaining bytes must come from the same object as the existing bytes. s3reader always reads
+	// from the first byte so the ranges are shifted by offset instead of seeking.
+	var getObjectClient s3reader.GetObjectClient = client
+	if offset > 0 {
+		if p.getObjectInput.IfMatch == nil {
+			p.getObjectInput.IfMatch = p.headObjectResult.ETag
+		}
+
+		getObjectClient = &rangeOffsetClient{GetObjectClient: client, offset: offset}
+	}
+
 	r, err := s3reader.NewReaderWithSize(
 		ctx,
-		client,
-		getObjectInput,
-		aws.ToInt64(headObjectResult.ContentLength),
+		getObjectClient,
+		p.getObjectInput,
+		size-offset,
 		func(s3readerOpts *s3reader.Options) {
 			if opts.S3ReaderOptions != nil {
 				opts.S3ReaderOptions(s3readerOpts)
@@ -74,36 +153,177 @@ func Download(ctx context.Context, client *s3.Client, bucket, key string, dst io
 		return fmt.Errorf("create s3 reader error: %w", err)
 	}
 
-	bar := tspb.DefaultBytes(aws.ToInt64(headObjectResult.ContentLength), fmt.Sprintf(`downloading "%s"`, internal.TruncateRightWithSuffix(path.Base(key), 15, "...")))
+	bar := tspb.DefaultBytes(size, fmt.Sprintf(`downloading "%s"`, internal.TruncateRightWithSuffix(path.Base(key), 15, "...")))
 	defer bar.Close()
 
+	// the existing bytes are hashed again so that the checksums still cover the whole object.
+	hs := append([]io.Writer{bar}, p.hashers()...)
+	if existing != nil {
+		if _, err = commons.CopyBufferWithContext(ctx, io.MultiWriter(hs...), existing, nil); err != nil {
+			_ = r.Close()
+			return fmt.Errorf("read partial file error: %w", err)
+		}
+	}
+
+	// if decrypting, the downloaded contents are piped to the decrypter which writes to dst instead.
 	var (
-		checksum = headObjectResult.Metadata["checksum"]
-		verifier sri.Verifier
+		out  = dst
+		pw   *io.PipeWriter
+		done chan error
 	)
+	if opts.Decrypter != nil {
+		var pr *io.PipeReader
+		pr, pw = io.Pipe()
+		done = make(chan error, 1)
+		out = pw
+
+		go func() {
+			dec, err := opts.Decrypter.NewDecoder(pr)
+			if err == nil {
+				_, err = io.Copy(dst, dec)
+				_ = dec.Close()
+			}
+
+			_ = pr.CloseWithError(err)
+			done <- err
+		}()
+	}
+
+	_, err = r.WriteTo(io.MultiWriter(append([]io.Writer{out}, hs...)...))
+
+	if pw != nil {
+		_ = pw.CloseWithError(err)
+		if decErr := <-done; decErr != nil && err == nil {
+			err = fmt.Errorf("decrypt error: %w", decErr)
+		}
+	}
+
+	if _ = r.Close(); err != nil {
+		return fmt.Errorf("download error: %w", err)
+	}
+
+	return p.verify()
+}
+
+// downloadPlan is the result of the initial HeadObject request that is shared by both download modes.
+type downloadPlan struct {
+	headObjectResult *s3.HeadObjectOutput
+	getObjectInput   *s3.GetObjectInput
+	verifier         *internal.MultiVerifier
+	s3verifier       *internal.S3ChecksumVerifier
+}
+
+// newDownloadPlan makes the HeadObject request to find the object's size and checksums.
+func newDownloadPlan(ctx context.Context, client s3reader.GetAndHeadObjectClient, bucket, key string, opts *DownloadOptions) (*downloadPlan, error) {
+	var checksumMode types.ChecksumMode
+	if !opts.DisableS3Checksum {
+		checksumMode = types.ChecksumModeEnabled
+	}
+
+	// headObject to see if there's a checksum to be used. the response's size is also used.
+	headObjectInput := &s3.HeadObjectInput{Bucket: &bucket, Key: &key, ChecksumMode: checksumMode}
+	if opts.HeadObjectInputOptions != nil {
+		opts.HeadObjectInputOptions(headObjectInput)
+	}
+	headObjectResult, err := client.HeadObject(ctx, headObjectInput)
+	if err != nil {
+		return nil, fmt.Errorf("head object error: %w", err)
+	}
+
+	// GetObject would fail with InvalidObjectState anyway.
+	if !internal.IsReadable(headObjectResult) {
+		return nil, fmt.Errorf(`object has storage class "%s": %w`, headObjectResult.StorageClass, ErrObjectNotRestored)
+	}
+
+	p := &downloadPlan{headObjectResult: headObjectResult}
+
+	if !opts.DisableS3Checksum {
+		if p.s3verifier, err = newS3ChecksumVerifier(ctx, client, headObjectInput, headObjectResult); err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := headObjectResult.Metadata["checksum"]
 	if opts.ExpectedChecksum != "" {
 		checksum = opts.ExpectedChecksum
 	}
-	if checksum != "" {
-		verifier, _ = sri.NewVerifier(checksum)
+	p.verifier = internal.NewMultiVerifier(append([]string{checksum}, opts.ExpectedChecksums...)...)
+
+	p.getObjectInput = &s3.GetObjectInput{Bucket: &bucket, Key: &key, ChecksumMode: checksumMode}
+	if opts.GetObjectInputOptions != nil {
+		opts.GetObjectInputOptions(p.getObjectInput)
+	}
+
+	return p, nil
+}
+
+// hashers returns the verifiers that the downloaded contents must be written to in order.
+func (p *downloadPlan) hashers() (ws []io.Writer) {
+	if p.verifier != nil {
+		ws = append(ws, p.verifier)
 	}
-	if verifier != nil {
-		_, err = r.WriteTo(io.MultiWriter(dst, bar, verifier))
-	} else {
-		_, err = r.WriteTo(io.MultiWriter(dst, bar))
+	if p.s3verifier != nil {
+		ws = append(ws, p.s3verifier)
 	}
 
-	if _ = r.Close(); err != nil {
-		return fmt.Errorf("download error: %w", err)
+	return
+}
+
+// verify returns ErrChecksumMismatch if any verifier fails.
+func (p *downloadPlan) verify() error {
+	if p.verifier != nil {
+		if expected, actual, ok := p.verifier.SumAndVerify(); !ok {
+			return &ErrChecksumMismatch{Expected: expected, Actual: actual}
+		}
 	}
 
-	if verifier != nil && !verifier.SumAndVerify(nil) {
-		return &ErrChecksumMismatch{Expected: checksum, Actual: verifier.SumToString(nil)}
+	if p.s3verifier != nil {
+		if actual, ok := p.s3verifier.SumAndVerify(); !ok {
+			alg, expected := internal.S3ChecksumsFromHeadObject(p.headObjectResult).Get()
+			return &ErrChecksumMismatch{
+				Expected: internal.FormatS3Checksum(alg, expected),
+				Actual:   internal.FormatS3Checksum(alg, actual),
+			}
+		}
 	}
 
 	return nil
 }
 
+// newS3ChecksumVerifier returns a verifier for the S3 additional checksum in the HeadObject response.
+//
+// Returns nil if the object has no additional checksum. If the checksum is a composite checksum of a multipart upload,
+// another HeadObject is made to find the part size; nil is also returned if the parts are not of the same size, since
+// the boundaries of the parts cannot be determined from the size of the first part alone.
+func newS3ChecksumVerifier(ctx context.Context, client s3reader.GetAndHeadObjectClient, input *s3.HeadObjectInput, output *s3.HeadObjectOutput) (*internal.S3ChecksumVerifier, error) {
+	alg, value := internal.S3ChecksumsFromHeadObject(output).Get()
+	if value == "" {
+		return nil, nil
+	}
+
+	_, parts, err := internal.SplitS3Checksum(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var partSize int64
+	if parts > 0 {
+		partInput := *input
+		partInput.PartNumber = aws.Int32(1)
+		partOutput, err := client.HeadObject(ctx, &partInput)
+		if err != nil {
+			return nil, fmt.Errorf("head object part 1 error: %w", err)
+		}
+
+		size := aws.ToInt64(output.ContentLength)
+		if partSize = aws.ToInt64(partOutput.ContentLength); partSize <= 0 || size <= int64(parts-1)*partSize || size > int64(parts)*partSize {
+			return nil, nil
+		}
+	}
+
+	return internal.NewS3ChecksumVerifier(alg, value, partSize), nil
+}
+
 // WithExpectedBucketOwner modifies the download options to include the given expected bucket owner.
 //
 // For convenience, if the expectedBucketOwner argument is nil, the method does nothing. If
@@ -134,6 +354,68 @@ func WithExpectedBucketOwner(expectedBucketOwner *string) func(*DownloadOptions)
 	}
 }
 
+// WithSSECustomerKey modifies the download options to include the given SSE-C customer-provided key.
+//
+// The key is the base64-encoded 256-bit key while keyMD5 is the base64-encoded MD5 digest of the key. For convenience,
+// if the key argument is empty, the method does nothing. Like WithExpectedBucketOwner, existing
+// DownloadOptions.HeadObjectInputOptions and DownloadOptions.GetObjectInputOptions are run first.
+func WithSSECustomerKey(key, keyMD5 string) func(*DownloadOptions) {
+	if key == "" {
+		return func(_ *DownloadOptions) {
+		}
+	}
+
+	return func(opts *DownloadOptions) {
+		hfn := opts.HeadObjectInputOptions
+		opts.HeadObjectInputOptions = func(input *s3.HeadObjectInput) {
+			if hfn != nil {
+				hfn(input)
+			}
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = aws.String("AES256"), &key, &keyMD5
+		}
+
+		gfn := opts.GetObjectInputOptions
+		opts.GetObjectInputOptions = func(input *s3.GetObjectInput) {
+			if gfn != nil {
+				gfn(input)
+			}
+			input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = aws.String("AES256"), &key, &keyMD5
+		}
+	}
+}
+
+// WithVersionID modifies the download options to download the given version of the object.
+//
+// For convenience, if the versionID argument is nil, the method does nothing. Like WithExpectedBucketOwner, existing
+// DownloadOptions.HeadObjectInputOptions and DownloadOptions.GetObjectInputOptions are run first.
+func WithVersionID(versionID *string) func(*DownloadOptions) {
+	if versionID == nil {
+		return func(_ *DownloadOptions) {
+		}
+	}
+
+	return func(opts *DownloadOptions) {
+		hfn := opts.HeadObjectInputOptions
+		opts.HeadObjectInputOptions = func(input *s3.HeadObjectInput) {
+			if hfn != nil {
+				hfn(input)
+			}
+			input.VersionId = versionID
+		}
+
+		gfn := opts.GetObjectInputOptions
+		opts.GetObjectInputOptions = func(input *s3.GetObjectInput) {
+			if gfn != nil {
+				gfn(input)
+			}
+			input.VersionId = versionID
+		}
+	}
+}
+
+// ErrObjectNotRestored is returned by Download if the object is archived and must be restored with RestoreObject first.
+var ErrObjectNotRestored = errors.New("object is archived and has not been restored")
+
 // ErrChecksumMismatch is returned by Download if object integrity verification fails.
 type ErrChecksumMismatch struct {
 	// Expected is the expected checksum available from S3's checksum metadata or from DownloadOptions.ExpectedChecksum.
@@ -0,0 +1,113 @@
+package xy3
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/nguyengg/xy3/codec"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgeCodec(t *testing.T) {
+	// test.txt.age was encrypted to the identity in age-identity.txt with the age CLI format.
+	f, err := os.Open("testdata/age-identity.txt")
+	assert.NoError(t, err)
+	identities, err := age.ParseIdentities(f)
+	_ = f.Close()
+	assert.NoError(t, err)
+
+	data, err := os.ReadFile("testdata/test.txt.age")
+	assert.NoError(t, err)
+
+	dec, err := codec.AgeCodec{Identities: identities}.NewDecoder(bytes.NewReader(data))
+	assert.NoError(t, err)
+	actual, err := io.ReadAll(dec)
+	assert.NoError(t, err)
+	assert.Equal(t, "Mr. Jock, TV quiz PhD, bags few lynx\n", string(actual))
+
+	recipient := identities[0].(*age.X25519Identity).Recipient()
+	assert.Equal(t, "x25519:", codec.AgeFingerprint(recipient)[:7])
+	assert.Len(t, codec.AgeFingerprint(recipient), 7+16)
+
+	tests := []struct {
+		name       string
+		codec      codec.Codec
+		recipients func() []age.Recipient
+		identities func() []age.Identity
+		ext        string
+	}{
+		{
+			name:       "x25519",
+			recipients: func() []age.Recipient { return []age.Recipient{recipient} },
+			identities: func() []age.Identity { return identities },
+			ext:        ".age",
+		},
+		{
+			name:       "x25519 with zstd",
+			codec:      &codec.ZstdCodec{},
+			recipients: func() []age.Recipient { return []age.Recipient{recipient} },
+			identities: func() []age.Identity { return identities },
+			ext:        ".zst.age",
+		},
+		{
+			name:  "scrypt with gzip",
+			codec: &codec.GzipCodec{},
+			recipients: func() []age.Recipient {
+				r, err := age.NewScryptRecipient("hunter2")
+				assert.NoError(t, err)
+				r.SetWorkFactor(10)
+				return []age.Recipient{r}
+			},
+			identities: func() []age.Identity {
+				id, err := age.NewScryptIdentity("hunter2")
+				assert.NoError(t, err)
+				return []age.Identity{id}
+			},
+			ext: ".gz.age",
+		},
+	}
+
+	expected := []byte(strings.Repeat("hello, world! ", 10000))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := codec.AgeCodec{Codec: tt.codec, Recipients: tt.recipients(), Identities: tt.identities()}
+			assert.Equal(t, tt.ext, c.Ext())
+
+			var buf bytes.Buffer
+			enc, err := c.NewEncoder(&buf)
+			assert.NoError(t, err)
+
+			// the inner encoder's ability to store must be kept.
+			if tt.codec != nil {
+				se, ok := enc.(codec.StoreEncoder)
+				assert.True(t, ok)
+				assert.NoError(t, se.SetStore(true))
+			}
+
+			_, err = enc.Write(expected)
+			assert.NoError(t, err)
+			assert.NoError(t, enc.Close())
+
+			// the ciphertext must not contain the plaintext.
+			assert.False(t, bytes.Contains(buf.Bytes(), []byte("hello, world!")))
+
+			dec, err := c.NewDecoder(&buf)
+			assert.NoError(t, err)
+			actual, err := io.ReadAll(dec)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, actual)
+		})
+	}
+
+	// decrypting without a matching identity must fail.
+	other, err := age.GenerateX25519Identity()
+	assert.NoError(t, err)
+	_, err = codec.AgeCodec{Identities: []age.Identity{other}}.NewDecoder(bytes.NewReader(data))
+	var noMatch *age.NoIdentityMatchError
+	assert.ErrorAs(t, err, &noMatch)
+}
@@ -1,7 +1,11 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/xy3"
 	"github.com/nguyengg/xy3/internal/cmd/download"
 	"github.com/nguyengg/xy3/internal/cmd/upload"
 )
@@ -9,9 +13,20 @@ import (
 type Xy3 struct {
 	Compress Compress         `command:"compress" alias:"c" description:"compress files"`
 	Extract  Extract          `command:"extract" alias:"x" description:"extract archives"`
+	Convert  Convert          `command:"convert" description:"convert archives to another format without extracting to disk"`
+	Diff     Diff             `command:"diff" description:"compare the contents of directories and archives"`
+	Ls       Ls               `command:"ls" description:"list S3 objects and whether they have local .s3 files"`
 	Download download.Command `command:"download" alias:"down" description:"download from S3"`
+	Pull     download.Pull    `command:"pull" description:"download every object under an S3 prefix to a local directory, skipping unchanged files"`
 	Upload   upload.Command   `command:"upload" alias:"up" description:"upload files to S3"`
+	Sync     Sync             `command:"sync" description:"upload the files of a directory as individual S3 objects, skipping unchanged ones"`
 	Remove   Remove           `command:"remove" alias:"rm" description:"remove both local and S3 files"`
+	Copy     Copy             `command:"cp" description:"copy S3 objects to another bucket or prefix without downloading them"`
+	Move     Move             `command:"mv" description:"move S3 objects to another bucket or prefix without downloading them"`
+	Verify   Verify           `command:"verify" description:"check that S3 objects still match their .s3 files"`
+	Versions Versions         `command:"versions" description:"list, restore, and create manifests for versions of S3 objects"`
+	Restore  Restore          `command:"restore" description:"restore archived S3 objects (GLACIER or DEEP_ARCHIVE) so that they can be downloaded"`
+	Share    Share            `command:"share" description:"create presigned URLs to download or upload S3 objects without AWS credentials"`
 }
 
 func NewParser() (*flags.Parser, error) {
@@ -24,3 +39,12 @@ func NewParser() (*flags.Parser, error) {
 
 	return p, nil
 }
+
+// validateAlgorithm returns an error if the given algorithm name is not accepted by xy3.NewCompressorFromName.
+func validateAlgorithm(name string) error {
+	if xy3.NewCompressorFromName(name) == nil {
+		return fmt.Errorf(`unknown algorithm "%s"; must be one of: %s`, name, strings.Join(xy3.CompressorNames(), ", "))
+	}
+
+	return nil
+}
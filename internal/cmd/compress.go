@@ -9,18 +9,24 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/jessevdk/go-flags"
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/archive"
 	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/zipper"
 )
 
 type Compress struct {
-	Algorithm      string `short:"a" long:"algorithm" choice:"zstd" choice:"zip" choice:"gzip" choice:"xz" default:"zstd"`
+	Algorithm      string `short:"a" long:"algorithm" default:"zstd" description:"the compression algorithm such as zstd, gzip, xz, zip, or tar"`
 	Delete         bool   `long:"delete" description:"if specified, delete the original files or directories that were successfully compressed and uploaded."`
 	MaxConcurrency int    `short:"P" long:"max-concurrency"`
+	Store          string `long:"store" choice:"auto" choice:"never" choice:"always" default:"auto" description:"whether files are stored in the archive without compression; auto stores files that are already compressed such as images, videos, and archives"`
+	TrainDict      bool   `long:"train-dict" description:"if specified, train a zstd dictionary from a sample of each directory's files to compress with; the dictionary is embedded in the archive. Useful for directories with many small files of the same type"`
+	Append         string `long:"append" value-name:"ARCHIVE" description:"if specified, add the files/directories to this existing zip archive (replacing files with the same names) instead of creating new archives"`
 	Args           struct {
 		Files []flags.Filename `positional-arg-name:"file" description:"the files/directories to be compressed" required:"yes"`
 	} `positional-args:"yes"`
@@ -34,16 +40,31 @@ func (c *Compress) Execute(args []string) (err error) {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
+	if c.Append != "" {
+		return c.append(ctx)
+	}
+
+	if err = validateAlgorithm(c.Algorithm); err != nil {
+		return err
+	}
+
+	if _, ok := codec.New(c.Algorithm).(*codec.ZstdCodec); c.TrainDict && !ok {
+		return fmt.Errorf("--train-dict requires zstd algorithm")
+	}
+
 	success := 0
 	failures := make([]error, 0)
 	n := len(c.Args.Files)
+	stats := &archive.StoreStats{}
 	for i, file := range c.Args.Files {
 		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, file))
 		logger := internal.MustLogger(ctx)
 		logger.Printf("start compressing")
 
-		if err = c.compress(ctx, string(file)); err == nil {
+		fileStats := archive.StoreStats{}
+		if err = c.compress(ctx, string(file), &fileStats); err == nil {
 			logger.Printf("done compressing")
+			stats.Add(fileStats)
 			success++
 			continue
 		}
@@ -57,6 +78,7 @@ func (c *Compress) Execute(args []string) (err error) {
 	}
 
 	log.Printf("successfully compressed %d/%d files", success, n)
+	logStoreStats(stats)
 	if len(failures) != 0 {
 		for _, err = range failures {
 			log.Print(err)
@@ -65,7 +87,26 @@ func (c *Compress) Execute(args []string) (err error) {
 	return nil
 }
 
-func (c *Compress) compress(ctx context.Context, name string) error {
+// logStoreStats logs the summary of files that were stored without compression, if any.
+func logStoreStats(stats *archive.StoreStats) {
+	if stats.StoredFiles != 0 {
+		log.Printf("stored %d files (%d bytes) without compression, saving an estimated %s", stats.StoredFiles, stats.StoredBytes, stats.EstimatedTimeSaved().Round(time.Millisecond))
+	}
+}
+
+// storePolicy returns the archive.StorePolicy from the --store flag.
+func (c *Compress) storePolicy() archive.StorePolicy {
+	switch c.Store {
+	case "never":
+		return archive.NeverStore
+	case "always":
+		return archive.AlwaysStore
+	default:
+		return archive.DefaultStorePolicy
+	}
+}
+
+func (c *Compress) compress(ctx context.Context, name string, stats *archive.StoreStats) error {
 	logger := internal.MustLogger(ctx)
 	comp := xy3.NewCompressorFromName(c.Algorithm)
 	ext := comp.ArchiveExt()
@@ -76,6 +117,11 @@ func (c *Compress) compress(ctx context.Context, name string) error {
 		return fmt.Errorf(`stat file "%s" error: %w`, name, err)
 
 	case fi.IsDir():
+		var dict []byte
+		if c.TrainDict {
+			dict, _ = xy3.TryTrainDictionary(ctx, name)
+		}
+
 		dst, err := commons.OpenExclFile(".", filepath.Base(name), ext, 0666)
 		if err != nil {
 			return fmt.Errorf("create archive error: %w", err)
@@ -95,6 +141,9 @@ func (c *Compress) compress(ctx context.Context, name string) error {
 			if c.MaxConcurrency > 0 {
 				opts.MaxConcurrency = c.MaxConcurrency
 			}
+			opts.StorePolicy = c.storePolicy()
+			opts.StoreStats = stats
+			opts.ZstdDictionary = dict
 		}); err != nil {
 			_, _ = dst.Close(), os.Remove(dst.Name())
 			return fmt.Errorf(`compress directory "%s" error: %w`, name, err)
@@ -106,8 +155,13 @@ func (c *Compress) compress(ctx context.Context, name string) error {
 		}
 
 	default:
-		// if the compressor implements codec.Codec then use that extension since this is a single file.
-		if cd, ok := comp.(codec.Codec); ok {
+		// if the compressor implements codec.Codec then use that extension since this is a single file. archive.Tar
+		// embeds codec.Codec which is nil for uncompressed tar.
+		cd, ok := comp.(codec.Codec)
+		if t, isTar := comp.(*archive.Tar); isTar {
+			cd, ok = t.Codec, t.Codec != nil
+		}
+		if ok {
 			ext = cd.Ext()
 		}
 
@@ -139,6 +193,8 @@ func (c *Compress) compress(ctx context.Context, name string) error {
 			if c.MaxConcurrency > 0 {
 				opts.MaxConcurrency = c.MaxConcurrency
 			}
+			opts.StorePolicy = c.storePolicy()
+			opts.StoreStats = stats
 		}); err != nil {
 			_, _ = dst.Close(), os.Remove(dst.Name())
 			return fmt.Errorf(`compress file "%s" error: %w`, name, err)
@@ -153,3 +209,45 @@ func (c *Compress) compress(ctx context.Context, name string) error {
 	success = true
 	return nil
 }
+
+// append adds all files/directories to the existing zip archive in one pass so that the archive is only updated once.
+func (c *Compress) append(ctx context.Context) error {
+	if !strings.EqualFold(filepath.Ext(c.Append), ".zip") {
+		return fmt.Errorf(`--append only supports zip archives, got "%s"`, c.Append)
+	}
+
+	names := make([]string, len(c.Args.Files))
+	for i, file := range c.Args.Files {
+		names[i] = string(file)
+	}
+
+	ctx = internal.WithPrefixLogger(ctx, internal.Prefix(1, 1, flags.Filename(c.Append)))
+	logger := internal.MustLogger(ctx)
+	logger.Printf("start appending %d files", len(names))
+
+	stats := &archive.StoreStats{}
+	if err := zipper.Update(ctx, c.Append, names, func(opts *zipper.AppendOptions) {
+		opts.StorePolicy = c.storePolicy()
+		opts.StoreStats = stats
+	}); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		logger.Printf("append error: %v", err)
+		return nil
+	}
+
+	logger.Printf("done appending")
+	logStoreStats(stats)
+
+	if c.Delete {
+		for _, name := range names {
+			if err := os.RemoveAll(name); err != nil {
+				logger.Printf(`delete "%s" error: %v`, name, err)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jessevdk/go-flags"
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/go-aws-commons/s3writer"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Convert struct {
+	Profile          string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL      string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Algorithm        string `short:"a" long:"algorithm" default:"zstd" description:"the compression algorithm such as zstd, gzip, xz, zip, or tar"`
+	Delete           bool   `long:"delete" description:"if specified, delete the original archives (or S3 objects for manifests) that were successfully converted; S3 objects are only converted if they match their manifests"`
+	MaxBytesInSecond int64  `long:"throttle" description:"limits the number of bytes that are downloaded and uploaded per second for manifests; the zero-value indicates no limit."`
+	Args             struct {
+		Files []flags.Filename `positional-arg-name:"file" description:"the local archives, or the local .s3 files of archives in S3, to be converted" required:"yes"`
+	} `positional-args:"yes"`
+
+	// client if non-nil is used instead of the bucket's client, which lets tests substitute a fake endpoint.
+	client *s3.Client
+}
+
+func (c *Convert) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.MaxBytesInSecond < 0 {
+		return fmt.Errorf("--throttle must be non-negative")
+	}
+
+	if err = validateAlgorithm(c.Algorithm); err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	success := 0
+	failures := make([]error, 0)
+	n := len(c.Args.Files)
+	for i, file := range c.Args.Files {
+		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, file))
+		logger := internal.MustLogger(ctx)
+		logger.Printf("start converting")
+
+		name := string(file)
+		if strings.HasSuffix(name, ".s3") {
+			err = c.convertManifest(ctx, name)
+		} else {
+			err = c.convertFile(ctx, name)
+		}
+		if err == nil {
+			logger.Printf("done converting")
+			success++
+			continue
+		}
+
+		if errors.Is(err, context.Canceled) {
+			break
+		}
+
+		logger.Printf("convert error: %v", err)
+		failures = append(failures, fmt.Errorf(`convert "%s" error: %v`, file, err))
+	}
+
+	log.Printf("successfully converted %d/%d files", success, n)
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+func (c *Convert) convertFile(ctx context.Context, name string) error {
+	logger := internal.MustLogger(ctx)
+
+	from := xy3.NewDecompressorFromName(filepath.Base(name))
+	if from == nil {
+		return fmt.Errorf(`no supported decompression algorithm for file "%s"`, filepath.Base(name))
+	}
+
+	to := xy3.NewCompressorFromName(c.Algorithm)
+	if from.ArchiveExt() == to.ArchiveExt() {
+		return fmt.Errorf(`file "%s" is already a %s archive`, filepath.Base(name), to.ArchiveExt())
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+	defer src.Close()
+
+	dst, err := commons.OpenExclFile(".", strings.TrimSuffix(filepath.Base(name), from.ArchiveExt()), to.ArchiveExt(), 0666)
+	if err != nil {
+		return fmt.Errorf("create archive error: %w", err)
+	}
+	defer dst.Close()
+
+	if err = xy3.Convert(ctx, src, from, dst, func(opts *xy3.ConvertOptions) {
+		opts.Algorithm = c.Algorithm
+	}); err != nil {
+		_, _ = dst.Close(), os.Remove(dst.Name())
+		return err
+	}
+
+	if err = dst.Close(); err != nil {
+		_ = os.Remove(dst.Name())
+		return fmt.Errorf(`complete converting file "%s" error: %w`, name, err)
+	}
+
+	logger.Printf(`wrote to "%s"`, dst.Name())
+
+	if c.Delete {
+		_ = src.Close()
+		if err = os.Remove(name); err != nil {
+			logger.Printf(`delete file "%s" error: %v`, name, err)
+		}
+	}
+
+	return nil
+}
+
+// convertManifest streams the archive from S3, converts it, and uploads the new archive to S3 in one pass.
+//
+// The local manifest is rewritten (and renamed to match the new archive's extension) to point to the new object.
+func (c *Convert) convertManifest(ctx context.Context, name string) error {
+	logger := internal.MustLogger(ctx)
+
+	man, err := internal.LoadManifestFromFile(name)
+	if err != nil {
+		return fmt.Errorf("read manifest error: %w", err)
+	}
+
+	// encrypted objects would need to be downloaded and decrypted in full first.
+	if man.Encryption != nil {
+		return fmt.Errorf("%s-encrypted objects are not supported; download them first", man.Encryption.Scheme)
+	}
+
+	from := xy3.NewDecompressorFromName(path.Base(man.Key))
+	if from == nil {
+		return fmt.Errorf(`no supported decompression algorithm for S3 object "%s"`, path.Base(man.Key))
+	}
+
+	to := xy3.NewCompressorFromName(c.Algorithm)
+	if from.ArchiveExt() == to.ArchiveExt() {
+		return fmt.Errorf(`S3 object "%s" is already a %s archive`, path.Base(man.Key), to.ArchiveExt())
+	}
+
+	cfg := config.ForBucket(man.Bucket)
+	expectedBucketOwner := internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner)
+
+	// the original object is read with the key it was encrypted with, while the new object is encrypted with the
+	// bucket's current settings.
+	getSSEKey, err := cfg.SSE.CustomerKeyForManifest(man)
+	if err != nil {
+		return err
+	}
+	putSSEKey, err := cfg.SSE.CustomerKey()
+	if err != nil {
+		return err
+	}
+
+	client := c.client
+	if client == nil {
+		if client, err = config.NewS3ClientForBucket(ctx, man.Bucket, func(opts *s3.Options) {
+			opts.DisableLogOutputChecksumValidationSkipped = true
+		}); err != nil {
+			return fmt.Errorf("create s3 client error: %w", err)
+		}
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: expectedBucketOwner,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = getSSEKey.Headers()
+
+	r, err := s3reader.New(ctx, client, input, func(opts *s3reader.Options) {
+		opts.MaxBytesInSecond = c.MaxBytesInSecond
+	})
+	if err != nil {
+		return fmt.Errorf("create s3 reader error: %w", err)
+	}
+	defer r.Close()
+
+	key := strings.TrimSuffix(man.Key, from.ArchiveExt()) + to.ArchiveExt()
+	logger.Printf(`converting to "s3://%s/%s"`, man.Bucket, key)
+
+	// one goroutine converts the archive into the pipe while the main goroutine uploads from the pipe. The original
+	// object is verified against the manifest before the pipe is closed so that a corrupt or changed object fails the
+	// upload instead of replacing the original.
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		vr := &verifyingReader{r: r, verifier: internal.NewMultiVerifier(append([]string{man.Checksum}, man.Checksums...)...)}
+		err := xy3.Convert(ctx, vr, from, pw, func(opts *xy3.ConvertOptions) {
+			opts.Algorithm = c.Algorithm
+		})
+		if err == nil {
+			err = vr.verify(man.Size)
+		}
+		_ = pw.CloseWithError(err)
+		done <- err
+	}()
+
+	checksumAlgorithm, err := internal.ParseS3ChecksumAlgorithm(string(cfg.ChecksumAlgorithm))
+	if err != nil {
+		return err
+	}
+	digests, err := internal.ParseDigestAlgorithms(cfg.Digests)
+	if err != nil {
+		return err
+	}
+
+	newMan, err := xy3.Upload(ctx, client, pr, man.Bucket, key, func(opts *xy3.UploadOptions) {
+		opts.ChecksumAlgorithm = checksumAlgorithm
+		opts.Digests = digests
+		opts.S3WriterOptions = func(opts *s3writer.Options) {
+			opts.MaxBytesInSecond = c.MaxBytesInSecond
+		}
+
+		opts.PutObjectInputOptions = func(input *s3.PutObjectInput) {
+			input.ContentType = aws.String(to.ContentType())
+			input.ExpectedBucketOwner = expectedBucketOwner
+			input.StorageClass = cfg.StorageClass
+			cfg.SSE.ApplyToPutObject(input, putSSEKey)
+		}
+	})
+	_ = pr.CloseWithError(err)
+	if convertErr := <-done; convertErr != nil {
+		return fmt.Errorf("convert error: %w", convertErr)
+	}
+	if err != nil {
+		return fmt.Errorf("upload error: %w", err)
+	}
+
+	newMan.ExpectedBucketOwner = man.ExpectedBucketOwner
+
+	// write the updated manifest to a new file first so that the original manifest is intact should this fail.
+	stem, ext := commons.StemExt(path.Base(key))
+	mf, err := commons.OpenExclFile(filepath.Dir(name), stem, ext+".s3", 0666)
+	if err != nil {
+		_ = newMan.SaveTo(os.Stdout)
+		return fmt.Errorf("create manifest file error: %w", err)
+	}
+
+	if err, _ = newMan.SaveTo(mf), mf.Close(); err != nil {
+		_ = newMan.SaveTo(os.Stdout)
+		return fmt.Errorf("write manifest error: %w", err)
+	}
+
+	if err = os.Remove(name); err != nil {
+		logger.Printf(`delete original manifest "%s" error: %v`, name, err)
+	}
+
+	logger.Printf(`updated manifest "%s"`, mf.Name())
+
+	if !c.Delete {
+		logger.Printf(`original S3 object "s3://%s/%s" was kept`, man.Bucket, man.Key)
+		return nil
+	}
+
+	if _, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: expectedBucketOwner,
+	}); err != nil {
+		logger.Printf(`delete original S3 object "s3://%s/%s" error: %v`, man.Bucket, man.Key, err)
+	}
+
+	return nil
+}
+
+// verifyingReader hashes and counts the bytes read from r.
+//
+// ReadAt and Size pass through to r so that zip and 7z archives can still be opened from their central directory. The
+// contents that were only read with ReadAt are not hashed; verify hashes them with a separate sequential read instead.
+type verifyingReader struct {
+	r interface {
+		io.Reader
+		io.ReaderAt
+		Size() int64
+	}
+	verifier *internal.MultiVerifier
+	size     int64
+}
+
+func (v *verifyingReader) Read(p []byte) (n int, err error) {
+	n, err = v.r.Read(p)
+	v.size += int64(n)
+	if v.verifier != nil {
+		_, _ = v.verifier.Write(p[:n])
+	}
+
+	return n, err
+}
+
+func (v *verifyingReader) ReadAt(p []byte, off int64) (int, error) {
+	return v.r.ReadAt(p, off)
+}
+
+func (v *verifyingReader) Size() int64 {
+	return v.r.Size()
+}
+
+// verify reads the rest of r, then returns an error if the contents do not match the expected size (if non-zero) or
+// digests.
+func (v *verifyingReader) verify(size int64) error {
+	if _, err := io.Copy(io.Discard, v); err != nil {
+		return fmt.Errorf("read original error: %w", err)
+	}
+
+	if size != 0 && v.size != size {
+		return fmt.Errorf("size does not match: expect %d, got %d", size, v.size)
+	}
+
+	if v.verifier != nil {
+		if expected, actual, ok := v.verifier.SumAndVerify(); !ok {
+			return &xy3.ErrChecksumMismatch{Expected: expected, Actual: actual}
+		}
+	}
+
+	return nil
+}
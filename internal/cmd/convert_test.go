@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	sum := sha256.Sum256([]byte("hello, world!"))
+	checksum := "sha256-" + base64.RawStdEncoding.EncodeToString(sum[:])
+
+	// the rest of the contents that were not read are still verified.
+	vr := &verifyingReader{r: strings.NewReader("hello, world!"), verifier: internal.NewMultiVerifier(checksum)}
+	_, err := io.ReadFull(vr, make([]byte, 5))
+	require.NoError(t, err)
+	assert.NoError(t, vr.verify(13))
+
+	vr = &verifyingReader{r: strings.NewReader("hello, world!"), verifier: internal.NewMultiVerifier(checksum)}
+	assert.EqualError(t, vr.verify(14), "size does not match: expect 14, got 13")
+
+	vr = &verifyingReader{r: strings.NewReader("hello, WORLD!"), verifier: internal.NewMultiVerifier(checksum)}
+	_, ok := xy3.IsErrChecksumMismatch(vr.verify(13))
+	assert.True(t, ok)
+
+	// manifests without size or checksum have nothing to verify.
+	vr = &verifyingReader{r: strings.NewReader("hello, WORLD!"), verifier: internal.NewMultiVerifier("")}
+	assert.NoError(t, vr.verify(0))
+}
+
+func TestConvert_Manifest(t *testing.T) {
+	for _, name := range []string{"test.zip", "test.7z"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "..", "testdata", name))
+			require.NoError(t, err)
+			sum := sha256.Sum256(data)
+
+			server := &fakeObjectServer{objects: map[string][]byte{"/bucket/" + name: data}}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			dir := t.TempDir()
+			f, err := os.Create(filepath.Join(dir, name+".s3"))
+			require.NoError(t, err)
+			man := internal.Manifest{Bucket: "bucket", Key: name, Size: int64(len(data)), Checksum: "sha256-" + base64.RawStdEncoding.EncodeToString(sum[:])}
+			require.NoError(t, man.SaveTo(f))
+			require.NoError(t, f.Close())
+
+			c := &Convert{Algorithm: "zstd", client: s3.New(s3.Options{
+				BaseEndpoint: aws.String(ts.URL),
+				Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+				Region:       "us-east-1",
+				UsePathStyle: true,
+			})}
+			require.NoError(t, c.convertManifest(internal.WithPrefixLogger(t.Context(), ""), f.Name()))
+
+			// the new manifest replaces the original one, which is kept in S3 without --delete.
+			assert.NoFileExists(t, f.Name())
+			newMan, err := internal.LoadManifestFromFile(filepath.Join(dir, "test.tar.zst.s3"))
+			require.NoError(t, err)
+			assert.Equal(t, "test.tar.zst", newMan.Key)
+			assert.Contains(t, server.objects, "/bucket/"+name)
+
+			files, err := xy3.NewDecompressorFromName(newMan.Key).Open(bytes.NewReader(server.objects["/bucket/test.tar.zst"]))
+			require.NoError(t, err)
+			contents := make(map[string]string)
+			for f, err := range files {
+				require.NoError(t, err)
+				if f.FileInfo().IsDir() {
+					continue
+				}
+
+				r, err := f.Open()
+				require.NoError(t, err)
+				b, err := io.ReadAll(r)
+				require.NoError(t, err)
+				contents[f.Name()] = string(b)
+			}
+			assert.Equal(t, map[string]string{"test.txt": "Mr. Jock, TV quiz PhD, bags few lynx\n"}, contents)
+		})
+	}
+}
+
+func TestConvert_ManifestMismatch(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "..", "testdata", "test.zip"))
+	require.NoError(t, err)
+
+	server := &fakeObjectServer{objects: map[string][]byte{"/bucket/test.zip": data}}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dir := t.TempDir()
+	f, err := os.Create(filepath.Join(dir, "test.zip.s3"))
+	require.NoError(t, err)
+	man := internal.Manifest{Bucket: "bucket", Key: "test.zip", Size: int64(len(data)), Checksum: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"}
+	require.NoError(t, man.SaveTo(f))
+	require.NoError(t, f.Close())
+
+	// the contents that were only read from the central directory are still verified before the upload completes.
+	c := &Convert{Algorithm: "zstd", client: s3.New(s3.Options{
+		BaseEndpoint: aws.String(ts.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		Region:       "us-east-1",
+		UsePathStyle: true,
+	})}
+	_, ok := xy3.IsErrChecksumMismatch(c.convertManifest(internal.WithPrefixLogger(t.Context(), ""), f.Name()))
+	assert.True(t, ok)
+	assert.FileExists(t, f.Name())
+	assert.NotContains(t, server.objects, "/bucket/test.tar.zst")
+}
+
+// fakeObjectServer serves HeadObject, ranged GetObject, and PutObject from objects keyed by path-style URL path.
+type fakeObjectServer struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *fakeObjectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodHead, http.MethodGet:
+		data, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("ETag", `"etag"`)
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+			return
+		}
+
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			start, end = 0, len(data)-1
+		}
+		end = min(end, len(data)-1)
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[start : end+1])
+
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		s.objects[r.URL.Path] = data
+		w.Header().Set("ETag", `"etag"`)
+
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
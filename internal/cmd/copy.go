@@ -0,0 +1,268 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jessevdk/go-flags"
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Copy struct {
+	Profile      string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL  string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	StorageClass string `long:"storage-class" description:"the storage class of the copies such as STANDARD_IA or GLACIER; by default, the copies keep the storage class of the originals"`
+	SSE          string `long:"sse" choice:"AES256" choice:"aws:kms" choice:"aws:kms:dsse" description:"the server-side encryption of the copies; takes precedence over .xy3 setting of the destination bucket, which takes precedence over the encryption of the originals"`
+	SSEKMSKeyID  string `long:"sse-kms-key-id" description:"the KMS key to encrypt the copies with if --sse is aws:kms or aws:kms:dsse"`
+	Force        bool   `long:"force" description:"if specified, replace existing objects at the destination"`
+	Concurrency  int    `long:"concurrency" default:"4" description:"the number of parts that are copied at the same time for objects larger than 5 GiB"`
+	Args         struct {
+		Files []string `positional-arg-name:"file" description:"the local .s3 files or S3 URIs in format s3://bucket/key to copy, followed by the destination in format s3://bucket/prefix" required:"2"`
+	} `positional-args:"yes"`
+
+	// move is true for Move.
+	move bool
+}
+
+// Move is Copy that also deletes the original objects.
+type Move struct {
+	Copy
+}
+
+func (c *Move) Execute(args []string) error {
+	c.move = true
+	return c.Copy.Execute(args)
+}
+
+// copyTarget is the destination of Copy.
+type copyTarget struct {
+	bucket, prefix string
+	cfg            config.BucketConfig
+	sseKey         *internal.SSECustomerKey
+	client         *s3.Client
+}
+
+func (c *Copy) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("--concurrency must be positive")
+	}
+
+	if c.StorageClass != "" && !slices.Contains(types.StorageClass("").Values(), types.StorageClass(c.StorageClass)) {
+		return fmt.Errorf(`unknown storage class "%s"`, c.StorageClass)
+	}
+
+	if c.SSEKMSKeyID != "" && !strings.HasPrefix(c.SSE, "aws:kms") {
+		return fmt.Errorf("--sse-kms-key-id requires --sse aws:kms or aws:kms:dsse")
+	}
+
+	files, dst := c.Args.Files[:len(c.Args.Files)-1], c.Args.Files[len(c.Args.Files)-1]
+
+	t := &copyTarget{}
+	if t.bucket, t.prefix, err = internal.ParseS3URI(dst); err != nil {
+		return fmt.Errorf(`invalid destination "%s": %w`, dst, err)
+	}
+	if t.prefix != "" && !strings.HasSuffix(t.prefix, "/") {
+		t.prefix += "/"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	t.cfg = config.ForBucket(t.bucket)
+	if c.SSE == "" {
+		if t.sseKey, err = t.cfg.SSE.CustomerKey(); err != nil {
+			return err
+		}
+	}
+
+	if t.client, err = config.NewS3ClientForBucket(ctx, t.bucket); err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	verb, past := "copy", "copied"
+	if c.move {
+		verb, past = "move", "moved"
+	}
+
+	success := 0
+	failures := make([]error, 0)
+	n := len(files)
+
+	for i, file := range files {
+		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, flags.Filename(file)))
+
+		if err = c.copy(ctx, t, file); err == nil {
+			success++
+			continue
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		internal.MustLogger(ctx).Printf("%s error: %v", verb, err)
+		failures = append(failures, fmt.Errorf(`%s "%s" error: %v`, verb, file, err))
+	}
+
+	log.Printf("successfully %s %d/%d files", past, success, n)
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// copy copies or moves the object of a single .s3 file or S3 URI, then writes its manifest.
+//
+// Moving a .s3 file or copying an object over itself updates the .s3 file, while copying a .s3 file creates a new one
+// next to it. S3 URIs have their new .s3 files created in the current directory.
+func (c *Copy) copy(ctx context.Context, t *copyTarget, name string) (err error) {
+	logger := internal.MustLogger(ctx)
+
+	var (
+		src          internal.Manifest
+		manifestName string
+		srcSSEKey    *internal.SSECustomerKey
+	)
+
+	if strings.HasPrefix(name, "s3://") {
+		if src.Bucket, src.Key, err = internal.ParseS3URI(name); err != nil {
+			return fmt.Errorf(`invalid s3 URI "%s": %w`, name, err)
+		}
+		if src.Key == "" || strings.HasSuffix(src.Key, "/") {
+			return fmt.Errorf(`s3 URI "%s" has no key`, name)
+		}
+	} else {
+		if src, err = internal.LoadManifestFromFile(name); err != nil {
+			return fmt.Errorf("read manifest error: %w", err)
+		}
+		manifestName = name
+	}
+
+	srcCfg := config.ForBucket(src.Bucket)
+	if manifestName == "" {
+		srcSSEKey, err = srcCfg.SSE.CustomerKey()
+	} else {
+		srcSSEKey, err = srcCfg.SSE.CustomerKeyForManifest(src)
+	}
+	if err != nil {
+		return err
+	}
+
+	key := t.prefix + path.Base(src.Key)
+	inPlace := src.Bucket == t.bucket && src.Key == key
+
+	if inPlace && c.StorageClass == "" && c.SSE == "" {
+		return fmt.Errorf(`"s3://%s/%s" can only be copied over itself with --storage-class or --sse`, src.Bucket, src.Key)
+	}
+
+	logger.Printf(`copying "s3://%s/%s" to "s3://%s/%s"`, src.Bucket, src.Key, t.bucket, key)
+
+	man, err := xy3.Copy(ctx, t.client, src, t.bucket, key, func(opts *xy3.CopyOptions) {
+		opts.ExpectedSourceBucketOwner = internal.FirstNonNilPtr(src.ExpectedBucketOwner, srcCfg.ExpectedBucketOwner)
+		opts.ExpectedBucketOwner = t.cfg.ExpectedBucketOwner
+		opts.SourceSSECustomerKey = srcSSEKey
+		opts.StorageClass = types.StorageClass(c.StorageClass)
+		opts.Overwrite = c.Force
+		opts.Concurrency = c.Concurrency
+
+		switch {
+		case c.SSE != "":
+			opts.ServerSideEncryption, opts.SSEKMSKeyID = types.ServerSideEncryption(c.SSE), c.SSEKMSKeyID
+		case t.sseKey != nil:
+			opts.SSECustomerKey = t.sseKey
+		default:
+			opts.ServerSideEncryption, opts.SSEKMSKeyID, opts.BucketKeyEnabled = t.cfg.SSE.ServerSideEncryption, t.cfg.SSE.KMSKeyID, t.cfg.SSE.BucketKeyEnabled
+		}
+	})
+	if err != nil {
+		if errors.Is(err, xy3.ErrObjectNotRestored) {
+			logger.Printf(`use "xy3 restore" to restore the object first`)
+		}
+
+		return err
+	}
+
+	if err = writeCopyManifest(ctx, man, manifestName, c.move || inPlace); err != nil {
+		return err
+	}
+
+	if !c.move || inPlace {
+		return nil
+	}
+
+	// like remove, the manifest's version is deleted if there is one.
+	srcClient, err := config.NewS3ClientForBucket(ctx, src.Bucket)
+	if err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	if _, err = srcClient.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket:              aws.String(src.Bucket),
+		Key:                 aws.String(src.Key),
+		VersionId:           src.VersionID,
+		ExpectedBucketOwner: internal.FirstNonNilPtr(src.ExpectedBucketOwner, srcCfg.ExpectedBucketOwner),
+	}); err != nil {
+		return fmt.Errorf(`delete original "s3://%s/%s" error: %w`, src.Bucket, src.Key, err)
+	}
+
+	logger.Printf(`deleted original "s3://%s/%s"`, src.Bucket, src.Key)
+	return nil
+}
+
+// writeCopyManifest writes the manifest of the copy, replacing the given .s3 file if replace is true.
+func writeCopyManifest(ctx context.Context, man internal.Manifest, manifestName string, replace bool) error {
+	logger := internal.MustLogger(ctx)
+
+	var (
+		f   *os.File
+		err error
+	)
+	if manifestName != "" && replace {
+		f, err = os.OpenFile(manifestName, os.O_WRONLY|os.O_TRUNC, 0666)
+	} else {
+		dir := "."
+		if manifestName != "" {
+			dir = filepath.Dir(manifestName)
+		}
+
+		stem, ext := commons.StemExt(path.Base(man.Key))
+		f, err = commons.OpenExclFile(dir, stem, ext+".s3", 0666)
+	}
+	if err != nil {
+		_ = man.SaveTo(os.Stdout)
+		return fmt.Errorf("open manifest file error: %w", err)
+	}
+
+	name := f.Name()
+	if err, _ = man.SaveTo(f), f.Close(); err != nil {
+		_ = man.SaveTo(os.Stdout)
+		return fmt.Errorf(`write manifest to "%s" error: %w`, name, err)
+	}
+
+	logger.Printf(`wrote "%s" for "s3://%s/%s"`, name, man.Bucket, man.Key)
+	return nil
+}
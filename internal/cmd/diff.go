@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Diff struct {
+	Profile        string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL    string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	JSON           bool   `long:"json" description:"if specified, print the differences as JSON to stdout"`
+	CompareModTime bool   `long:"mtime" description:"if specified, files with different modification times are also reported as modified"`
+	Args           struct {
+		From flags.Filename `positional-arg-name:"from" description:"the local directory, local archive, or local .s3 file of an archive in S3 to compare from" required:"yes"`
+		To   flags.Filename `positional-arg-name:"to" description:"the local directory, local archive, or local .s3 file of an archive in S3 to compare to" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *Diff) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	from, err := c.list(ctx, string(c.Args.From))
+	if err != nil {
+		return fmt.Errorf(`list "%s" error: %w`, c.Args.From, err)
+	}
+
+	to, err := c.list(ctx, string(c.Args.To))
+	if err != nil {
+		return fmt.Errorf(`list "%s" error: %w`, c.Args.To, err)
+	}
+
+	res, err := xy3.Diff(ctx, from, to, func(opts *xy3.DiffOptions) {
+		opts.CompareModTime = c.CompareModTime
+	})
+	if err != nil {
+		return fmt.Errorf("diff error: %w", err)
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(res)
+	}
+
+	for _, e := range res.Removed {
+		fmt.Printf("- %s\n", e.Name)
+	}
+	for _, e := range res.Added {
+		fmt.Printf("+ %s\n", e.Name)
+	}
+	for _, e := range res.Modified {
+		fmt.Printf("M %s (%s)\n", e.Name, strings.Join(e.Reasons, ", "))
+	}
+
+	log.Printf("%d added, %d removed, %d modified", len(res.Added), len(res.Removed), len(res.Modified))
+	return nil
+}
+
+// list returns the listing of the given directory, archive, or manifest.
+func (c *Diff) list(ctx context.Context, name string) ([]xy3.DiffEntry, error) {
+	if strings.HasSuffix(name, ".s3") {
+		return c.listManifest(ctx, name)
+	}
+
+	fi, err := os.Stat(name)
+	if err != nil {
+		return nil, fmt.Errorf(`stat file "%s" error: %w`, name, err)
+	}
+
+	if fi.IsDir() {
+		return xy3.ListDir(ctx, name)
+	}
+
+	src, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+	defer src.Close()
+
+	return listArchive(ctx, src, fi.Size(), filepath.Base(name))
+}
+
+// listManifest lists the archive in S3 pointed to by the given manifest.
+//
+// Only the central directory is downloaded for zip archives; other archives must be downloaded in full.
+func (c *Diff) listManifest(ctx context.Context, name string) ([]xy3.DiffEntry, error) {
+	man, err := internal.LoadManifestFromFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest error: %w", err)
+	}
+
+	// encrypted objects would need to be downloaded and decrypted in full first.
+	if man.Encryption != nil {
+		return nil, fmt.Errorf("%s-encrypted objects are not supported; download them first", man.Encryption.Scheme)
+	}
+
+	client, err := config.NewS3ClientForBucket(ctx, man.Bucket, func(opts *s3.Options) {
+		opts.DisableLogOutputChecksumValidationSkipped = true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	cfg := config.ForBucket(man.Bucket)
+	sseKey, err := cfg.SSE.CustomerKeyForManifest(man)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner),
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = sseKey.Headers()
+
+	r, err := s3reader.New(ctx, client, input)
+	if err != nil {
+		return nil, fmt.Errorf("create s3 reader error: %w", err)
+	}
+	defer r.Close()
+
+	return listArchive(ctx, r, r.Size(), path.Base(man.Key))
+}
+
+// listArchive uses xy3.ListZip for zip archives, and xy3.ListArchive for other archives.
+//
+// The given src must be either an *os.File or an s3reader.Reader.
+func listArchive(ctx context.Context, src io.ReadSeeker, size int64, name string) ([]xy3.DiffEntry, error) {
+	arc := xy3.NewDecompressorFromName(name)
+	if arc == nil {
+		return nil, fmt.Errorf(`no supported decompression algorithm for file "%s"`, name)
+	}
+
+	switch arc.ArchiveExt() {
+	case ".zip":
+		return xy3.ListZip(src, size)
+	case ".7z":
+		// 7z needs random access so src must not be wrapped.
+		return xy3.ListArchive(ctx, src, arc)
+	}
+
+	bar := tspb.DefaultBytes(size, fmt.Sprintf(`listing "%s"`, internal.TruncateRightWithSuffix(name, 15, "...")))
+	defer bar.Close()
+
+	return xy3.ListArchive(ctx, io.TeeReader(src, bar), arc)
+}
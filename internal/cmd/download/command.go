@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/jessevdk/go-flags"
@@ -16,10 +17,18 @@ import (
 )
 
 type Command struct {
-	Profile           string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
-	DownloadManifests bool   `long:"manifests" description:"if specified, the positional arguments must be come S3 locations in format s3://bucket/prefix (optional prefix) in order to download manifests of files found in those S3 location"`
-	NoExtract         bool   `long:"no-extract" description:"if specified, the downloaded archives will not be automatically decompressed and extracted if it's an archive"`
-	MaxBytesInSecond  int64  `long:"throttle" description:"limits the number of bytes that are downloaded per second; the zero-value indicates no limit."`
+	Profile           string        `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL       string        `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	DownloadManifests bool          `long:"manifests" description:"if specified, the positional arguments must be come S3 locations in format s3://bucket/prefix (optional prefix) in order to download manifests of files found in those S3 location"`
+	NoExtract         bool          `long:"no-extract" description:"if specified, the downloaded archives will not be automatically decompressed and extracted if it's an archive"`
+	Recursive         bool          `short:"r" long:"recursive" description:"if specified, archives found among the extracted files will also be extracted in place"`
+	MaxDepth          int           `long:"max-depth" default:"5" description:"limits how many levels of nested archives are extracted with --recursive"`
+	MaxBytesInSecond  int64         `long:"throttle" description:"limits the number of bytes that are downloaded per second; the zero-value indicates no limit."`
+	Concurrency       int           `long:"concurrency" description:"if greater than 1, download this many byte ranges in parallel and write them directly to their offsets in the file"`
+	PartSize          int64         `long:"part-size" description:"the size in bytes of each byte range downloaded in parallel (with --concurrency); the zero-value uses the default of 8 MiB"`
+	MaxRetries        int           `long:"max-retries" description:"the number of times a byte range that fails is retried (with --concurrency); the zero-value uses the default of 3, negative disables retries"`
+	WaitForRestore    bool          `long:"wait-for-restore" description:"if specified, archived objects (GLACIER or DEEP_ARCHIVE) whose restore is in progress are waited on until they can be downloaded; see xy3 restore"`
+	PollInterval      time.Duration `long:"poll-interval" default:"5m" description:"how often the restore status is checked (with --wait-for-restore)"`
 	Args              struct {
 		Files []flags.Filename `positional-arg-name:"file" description:"the local files each containing a single S3 URI; or S3 URI in format s3://bucket/key to download directly from S3; or S3 locations in format s3://bucket/prefix to download manifests (with --manifests)"`
 	} `positional-args:"yes"`
@@ -34,10 +43,18 @@ func (c *Command) Execute(args []string) (err error) {
 		return fmt.Errorf("--throttle must be non-negative")
 	}
 
+	if c.PartSize < 0 {
+		return fmt.Errorf("--part-size must be non-negative")
+	}
+
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive")
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
-	if _, err = config.LoadProfile(ctx, c.Profile); err != nil {
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
 		return err
 	}
 
@@ -109,3 +126,24 @@ func (c *Command) createClient(ctx context.Context, bucket string) (cfg config.B
 
 	return
 }
+
+// waitForRestore blocks until the archived object can be downloaded if --wait-for-restore is specified.
+func (c *Command) waitForRestore(ctx context.Context, client *s3.Client, input *s3.HeadObjectInput) error {
+	if !c.WaitForRestore {
+		return nil
+	}
+
+	logger := internal.MustLogger(ctx)
+
+	if _, err := internal.WaitForRestore(ctx, client, input, c.PollInterval, func(_ *s3.HeadObjectOutput) {
+		logger.Printf("restore is in progress; checking again in %s", c.PollInterval)
+	}); err != nil {
+		if errors.Is(err, internal.ErrRestoreNotRequested) {
+			return fmt.Errorf("%w; run xy3 restore first", err)
+		}
+
+		return fmt.Errorf("wait for restore error: %w", err)
+	}
+
+	return nil
+}
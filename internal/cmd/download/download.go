@@ -2,13 +2,19 @@ package download
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/s3reader"
 	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
 )
 
 func (c *Command) downloadFromManifest(ctx context.Context, manifestName string) error {
@@ -24,43 +30,81 @@ func (c *Command) downloadFromManifest(ctx context.Context, manifestName string)
 		return err
 	}
 
-	// attempt to create the local file that will store the downloaded artifact.
-	// if we fail to download the file successfully, clean up by deleting the local file.
-	stem, ext := commons.StemExt(man.Key)
-	f, err := commons.OpenExclFile(".", stem, ext, 0666)
+	sseKey, err := cfg.SSE.CustomerKeyForManifest(man)
 	if err != nil {
-		return fmt.Errorf("create file error: %w", err)
+		return err
 	}
-	defer f.Close()
 
-	name := f.Name()
+	// encrypted objects are decrypted on the fly so the local file doesn't have the ".age" extension.
+	key := man.Key
+	var decrypter codec.Codec
+	if man.Encryption != nil {
+		if decrypter, err = newDecrypter(cfg, man.Encryption.Scheme); err != nil {
+			return err
+		}
+
+		key = strings.TrimSuffix(key, decrypter.Ext())
+	}
 
-	err = xy3.Download(
+	expectedBucketOwner := internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner)
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: expectedBucketOwner,
+	}
+	headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+	if err = c.waitForRestore(ctx, client, headObjectInput); err != nil {
+		return err
+	}
+
+	// the artifact is downloaded to a partial file that is kept on failure so that the next attempt can resume.
+	name, err := localName(key)
+	if err != nil {
+		return err
+	}
+
+	err = xy3.DownloadFile(
 		ctx,
 		client,
 		man.Bucket,
 		man.Key,
-		f,
-		xy3.WithExpectedBucketOwner(internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner)),
+		name,
+		xy3.WithExpectedBucketOwner(expectedBucketOwner),
+		xy3.WithVersionID(man.VersionID),
+		withSSECustomerKey(sseKey),
 		func(opts *xy3.DownloadOptions) {
 			opts.S3ReaderOptions = func(opts *s3reader.Options) {
 				opts.MaxBytesInSecond = c.MaxBytesInSecond
 			}
 
 			opts.ExpectedChecksum = man.Checksum
+			opts.ExpectedChecksums = man.Checksums
+			opts.Decrypter = decrypter
+			opts.Concurrency, opts.PartSize, opts.MaxRetries = c.Concurrency, c.PartSize, c.MaxRetries
 		})
 	if err != nil {
+		if errors.Is(err, xy3.ErrObjectNotRestored) {
+			return fmt.Errorf("%w; run xy3 restore first, then download again with --wait-for-restore", err)
+		}
+
 		if _, ok := xy3.IsErrChecksumMismatch(err); !ok {
-			_, _ = f.Close(), os.Remove(name)
+			if _, statErr := os.Stat(name + xy3.PartialExt); statErr == nil {
+				logger.Printf(`kept partial file "%s"; run the same command again to resume`, name+xy3.PartialExt)
+			}
+
 			return err
 		}
 
 		logger.Print(err)
 	}
 
+	// the restore, if any, is no longer pending.
+	_ = os.Remove(manifestName + internal.RestoreStateExt)
+
 	if !c.NoExtract {
 		if err = c.extract(ctx, name); err == nil {
-			_, _ = f.Close(), os.Remove(name)
+			_ = os.Remove(name)
 		}
 	}
 
@@ -80,32 +124,65 @@ func (c *Command) downloadFromS3(ctx context.Context, s3Uri string) error {
 		return err
 	}
 
-	// attempt to create the local file that will store the downloaded artifact.
-	// if we fail to download the file successfully, clean up by deleting the local file.
-	stem, ext := commons.StemExt(key)
-	f, err := commons.OpenExclFile(".", stem, ext, 0666)
+	// without a manifest, the SSE-C key is used if the bucket has one.
+	sseKey, err := cfg.SSE.CustomerKey()
 	if err != nil {
-		return fmt.Errorf("create file error: %w", err)
+		return err
+	}
+
+	// without a manifest, objects with the ".age" extension are decrypted only if there are identities to do so.
+	var decrypter codec.Codec
+	if strings.HasSuffix(key, ".age") && cfg.Age.CanDecrypt() {
+		if decrypter, err = newDecrypter(cfg, codec.AgeScheme); err != nil {
+			return err
+		}
 	}
-	defer f.Close()
 
-	name := f.Name()
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: cfg.ExpectedBucketOwner,
+	}
+	headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+	if err = c.waitForRestore(ctx, client, headObjectInput); err != nil {
+		return err
+	}
 
-	err = xy3.Download(
+	// the artifact is downloaded to a partial file that is kept on failure so that the next attempt can resume.
+	name := key
+	if decrypter != nil {
+		name = strings.TrimSuffix(key, decrypter.Ext())
+	}
+	if name, err = localName(name); err != nil {
+		return err
+	}
+
+	err = xy3.DownloadFile(
 		ctx,
 		client,
 		bucket,
 		key,
-		f,
+		name,
 		xy3.WithExpectedBucketOwner(cfg.ExpectedBucketOwner),
+		withSSECustomerKey(sseKey),
 		func(opts *xy3.DownloadOptions) {
 			opts.S3ReaderOptions = func(opts *s3reader.Options) {
 				opts.MaxBytesInSecond = c.MaxBytesInSecond
 			}
+
+			opts.Decrypter = decrypter
+			opts.Concurrency, opts.PartSize, opts.MaxRetries = c.Concurrency, c.PartSize, c.MaxRetries
 		})
 	if err != nil {
+		if errors.Is(err, xy3.ErrObjectNotRestored) {
+			return fmt.Errorf("%w; run xy3 restore first, then download again with --wait-for-restore", err)
+		}
+
 		if _, ok := xy3.IsErrChecksumMismatch(err); !ok {
-			_, _ = f.Close(), os.Remove(name)
+			if _, statErr := os.Stat(name + xy3.PartialExt); statErr == nil {
+				logger.Printf(`kept partial file "%s"; run the same command again to resume`, name+xy3.PartialExt)
+			}
+
 			return err
 		}
 
@@ -114,19 +191,43 @@ func (c *Command) downloadFromS3(ctx context.Context, s3Uri string) error {
 
 	if !c.NoExtract {
 		if err = c.extract(ctx, name); err == nil {
-			_, _ = f.Close(), os.Remove(name)
+			_ = os.Remove(name)
 		}
 	}
 
 	return err
 }
 
+// localName returns the name of the local file to download the given key to.
+//
+// The name is the first of "stem.ext", "stem-1.ext", "stem-2.ext", etc. that does not exist in the current directory.
+// Because a failed download only leaves behind the partial file, the same name is returned on retry so that the
+// download can resume.
+func localName(key string) (string, error) {
+	stem, ext := commons.StemExt(key)
+	name := stem + ext
+	for i := 0; ; {
+		switch _, err := os.Stat(name); {
+		case errors.Is(err, os.ErrNotExist):
+			return name, nil
+		case err == nil:
+			i++
+			name = fmt.Sprintf("%s-%d%s", stem, i, ext)
+		default:
+			return "", fmt.Errorf(`stat file "%s" error: %w`, name, err)
+		}
+	}
+}
+
 func (c *Command) extract(ctx context.Context, name string) (err error) {
 	logger := internal.MustLogger(ctx)
 
 	// if file is eligible for auto-extract then proceed to do so.
 	if cd := xy3.NewDecompressorFromName(name); cd != nil {
-		if _, err = xy3.Decompress(ctx, name, "."); err == nil {
+		if _, err = xy3.Decompress(ctx, name, ".", func(opts *xy3.DecompressOptions) {
+			opts.Recursive = c.Recursive
+			opts.MaxDepth = c.MaxDepth
+		}); err == nil {
 			logger.Printf(`deleting temporary archive "%s"`, name)
 			_ = os.Remove(name)
 		}
@@ -134,3 +235,31 @@ func (c *Command) extract(ctx context.Context, name string) (err error) {
 
 	return err
 }
+
+// newDecrypter returns the codec.Codec to decrypt objects encrypted with the given scheme.
+func newDecrypter(cfg config.BucketConfig, scheme string) (codec.Codec, error) {
+	if scheme != codec.AgeScheme {
+		return nil, fmt.Errorf(`unknown encryption scheme "%s"`, scheme)
+	}
+
+	if !cfg.Age.CanDecrypt() {
+		return nil, fmt.Errorf("object is encrypted with age but the bucket has no age-identity-file or age-passphrase-env setting")
+	}
+
+	identities, err := cfg.Age.ParseIdentities()
+	if err != nil {
+		return nil, err
+	}
+
+	return codec.AgeCodec{Identities: identities}, nil
+}
+
+// withSSECustomerKey calls xy3.WithSSECustomerKey if the key is non-nil.
+func withSSECustomerKey(key *internal.SSECustomerKey) func(*xy3.DownloadOptions) {
+	if key == nil {
+		return func(_ *xy3.DownloadOptions) {
+		}
+	}
+
+	return xy3.WithSSECustomerKey(key.Key, key.KeyMD5)
+}
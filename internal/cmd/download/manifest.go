@@ -10,6 +10,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/nguyengg/xy3/internal"
 )
 
@@ -24,6 +25,12 @@ func (c *Command) downloadManifests(ctx context.Context, s3Location string) (n i
 		return 0, err
 	}
 
+	// objects encrypted with SSE-C can only be described with the key.
+	sseKey, err := cfg.SSE.CustomerKey()
+	if err != nil {
+		return 0, err
+	}
+
 	var prefix *string
 	if key != "" {
 		prefix = &key
@@ -40,22 +47,20 @@ func (c *Command) downloadManifests(ctx context.Context, s3Location string) (n i
 		}
 
 		for _, obj := range page.Contents {
-			headObjectResult, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+			headObjectInput := &s3.HeadObjectInput{
 				Bucket:              aws.String(bucket),
 				Key:                 obj.Key,
 				ExpectedBucketOwner: cfg.ExpectedBucketOwner,
-			})
+				ChecksumMode:        types.ChecksumModeEnabled,
+			}
+			headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+
+			headObjectResult, err := client.HeadObject(ctx, headObjectInput)
 			if err != nil {
 				return n, fmt.Errorf(`get metadata about "%s" error: %w`, aws.ToString(obj.Key), err)
 			}
 
-			m := internal.Manifest{
-				Bucket:              bucket,
-				Key:                 aws.ToString(obj.Key),
-				Size:                aws.ToInt64(obj.Size),
-				ExpectedBucketOwner: cfg.ExpectedBucketOwner,
-				Checksum:            headObjectResult.Metadata["checksum"],
-			}
+			m := internal.NewManifestFromHeadObject(bucket, aws.ToString(obj.Key), cfg.ExpectedBucketOwner, headObjectResult)
 
 			f, err := os.OpenFile(path.Base(m.Key)+".s3", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 			if err != nil {
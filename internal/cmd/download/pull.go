@@ -0,0 +1,416 @@
+package download
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/codec"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+// Pull mirrors an S3 prefix to a local directory.
+type Pull struct {
+	Profile          string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL      string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Concurrency      int    `long:"concurrency" default:"4" description:"the number of objects that are downloaded at the same time"`
+	MaxBytesInSecond int64  `long:"throttle" description:"limits the number of bytes that are downloaded per second across all concurrent downloads; the zero-value indicates no limit."`
+	Extract          bool   `long:"extract" description:"if specified, the downloaded archives are extracted in place and then deleted, leaving their .s3 files so that they are not downloaded again"`
+	Recursive        bool   `short:"r" long:"recursive" description:"if specified with --extract, archives found among the extracted files will also be extracted in place"`
+	MaxDepth         int    `long:"max-depth" default:"5" description:"limits how many levels of nested archives are extracted with --recursive"`
+	Args             struct {
+		S3Location string         `positional-arg-name:"s3location" description:"the S3 bucket and prefix in format s3://bucket/prefix to download the objects from" required:"yes"`
+		Dir        flags.Filename `positional-arg-name:"dir" description:"the local directory to recreate the key hierarchy in" required:"yes"`
+	} `positional-args:"yes"`
+
+	bucket, prefix string
+	cfg            config.BucketConfig
+	sseKey         *internal.SSECustomerKey
+	client         *s3.Client
+
+	// api is client for everything other than downloads, which lets tests substitute a fake.
+	api pullClient
+}
+
+// pullClient abstracts the S3 APIs that Pull uses other than downloads.
+type pullClient interface {
+	s3.ListObjectsV2APIClient
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+func (c *Pull) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.MaxBytesInSecond < 0 {
+		return fmt.Errorf("--throttle must be non-negative")
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("--concurrency must be positive")
+	}
+
+	if c.bucket, c.prefix, err = internal.ParseS3URI(c.Args.S3Location); err != nil {
+		return fmt.Errorf(`invalid s3 location "%s": %w`, c.Args.S3Location, err)
+	}
+	if c.prefix != "" && !strings.HasSuffix(c.prefix, "/") {
+		c.prefix += "/"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	c.cfg = config.ForBucket(c.bucket)
+	if c.sseKey, err = c.cfg.SSE.CustomerKey(); err != nil {
+		return err
+	}
+
+	c.client, err = config.NewS3ClientForBucket(ctx, c.bucket, func(opts *s3.Options) {
+		opts.DisableLogOutputChecksumValidationSkipped = true
+	})
+	if err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+	c.api = c.client
+
+	var keys []string
+	for paginator := s3.NewListObjectsV2Paginator(c.api, &s3.ListObjectsV2Input{
+		Bucket:              aws.String(c.bucket),
+		Prefix:              aws.String(c.prefix),
+		ExpectedBucketOwner: c.cfg.ExpectedBucketOwner,
+	}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list objects error: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			// "directory" placeholders have no contents to download.
+			if key := aws.ToString(obj.Key); !strings.HasSuffix(key, "/") {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	var (
+		downloaded, skipped int
+		failures            = make([]error, 0)
+		mu                  sync.Mutex
+		wg                  sync.WaitGroup
+		sem                 = make(chan struct{}, c.Concurrency)
+		n                   = len(keys)
+	)
+
+	for i, key := range keys {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, flags.Filename(key)))
+			logger := internal.MustLogger(ctx)
+
+			skip, err := c.pull(ctx, key)
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err != nil:
+				logger.Printf("pull error: %v", err)
+				failures = append(failures, fmt.Errorf(`pull "s3://%s/%s" error: %v`, c.bucket, key, err))
+			case skip:
+				skipped++
+			default:
+				downloaded++
+			}
+		}()
+	}
+
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	log.Printf("%d objects downloaded, %d unchanged, %d failed", downloaded, skipped, len(failures))
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// pull downloads the object to its place in the local directory unless it is unchanged.
+//
+// Plaintext objects are unchanged if the local file already has the same checksum. Decrypted objects and extracted
+// archives cannot be compared that way, so the .s3 file written next to them records which object they came from.
+func (c *Pull) pull(ctx context.Context, key string) (skip bool, err error) {
+	logger := internal.MustLogger(ctx)
+
+	// objects with the ".age" extension are decrypted only if there are identities to do so, like download.
+	var (
+		decrypter codec.Codec
+		ext       string
+	)
+	if strings.HasSuffix(key, ".age") && c.cfg.Age.CanDecrypt() {
+		if decrypter, err = newDecrypter(c.cfg, codec.AgeScheme); err != nil {
+			return false, err
+		}
+
+		ext = decrypter.Ext()
+	}
+
+	name, err := pullName(string(c.Args.Dir), c.prefix, key, ext)
+	if err != nil {
+		return false, err
+	}
+
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: c.cfg.ExpectedBucketOwner,
+		ChecksumMode:        types.ChecksumModeEnabled,
+	}
+	headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = c.sseKey.Headers()
+
+	headObjectResult, err := c.api.HeadObject(ctx, headObjectInput)
+	if err != nil {
+		return false, fmt.Errorf("head object error: %w", err)
+	}
+
+	// the checksum of encrypted objects is of the encrypted contents, and extracted archives are deleted.
+	extract := c.Extract && xy3.NewDecompressorFromName(name) != nil
+	if decrypter != nil || extract {
+		if skip, err = samePull(name, extract, c.bucket, key, headObjectResult.ETag); err != nil || skip {
+			return skip, err
+		}
+	} else if skip, err = sameChecksum(name, aws.ToInt64(headObjectResult.ContentLength), headObjectResult.Metadata["checksum"]); err != nil || skip {
+		return skip, err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return false, fmt.Errorf(`create directory "%s" error: %w`, filepath.Dir(name), err)
+	}
+
+	err = xy3.DownloadFile(
+		ctx,
+		c.client,
+		c.bucket,
+		key,
+		name,
+		xy3.WithExpectedBucketOwner(c.cfg.ExpectedBucketOwner),
+		withSSECustomerKey(c.sseKey),
+		func(opts *xy3.DownloadOptions) {
+			// the throttle is shared evenly among the concurrent downloads.
+			if c.MaxBytesInSecond > 0 {
+				opts.S3ReaderOptions = func(opts *s3reader.Options) {
+					opts.MaxBytesInSecond = max(c.MaxBytesInSecond/int64(c.Concurrency), 1)
+				}
+			}
+
+			opts.Decrypter = decrypter
+		})
+	if err != nil {
+		if _, ok := xy3.IsErrChecksumMismatch(err); !ok {
+			return false, err
+		}
+
+		logger.Print(err)
+	}
+
+	// the modification time recorded by sync takes precedence over the object's.
+	mtime := aws.ToTime(headObjectResult.LastModified)
+	if v, ok := headObjectResult.Metadata["mtime"]; ok {
+		if t, parseErr := time.Parse(time.RFC3339Nano, v); parseErr == nil {
+			mtime = t
+		}
+	}
+	if chtimesErr := os.Chtimes(name, time.Time{}, mtime); chtimesErr != nil {
+		logger.Printf(`change modify time of "%s" error: %v`, name, chtimesErr)
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	var extracted string
+	if extract {
+		// the contents of an earlier version would otherwise be left next to the new version's.
+		if err = removeExtracted(ctx, name); err != nil {
+			return false, err
+		}
+
+		target, err := xy3.Decompress(ctx, name, filepath.Dir(name), func(opts *xy3.DecompressOptions) {
+			opts.Recursive = c.Recursive
+			opts.MaxDepth = c.MaxDepth
+		})
+		if err != nil {
+			return false, err
+		}
+
+		if extracted, err = filepath.Rel(filepath.Dir(name), target); err != nil {
+			return false, fmt.Errorf(`find relative path of "%s" error: %w`, target, err)
+		}
+
+		logger.Printf(`deleting temporary archive "%s"`, name)
+		_ = os.Remove(name)
+	}
+
+	if decrypter != nil || extract {
+		man := internal.NewManifestFromHeadObject(c.bucket, key, c.cfg.ExpectedBucketOwner, headObjectResult)
+		man.Extracted = filepath.ToSlash(extracted)
+		if err = writePullManifest(name, man); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// pullName returns the path inside dir that the object with the given key is downloaded to, without the extension of
+// its decrypter if any.
+//
+// Returns an error if the key relative to the prefix does not map to a path inside dir.
+func pullName(dir, prefix, key, ext string) (string, error) {
+	rel := strings.TrimPrefix(key, prefix)
+	if !filepath.IsLocal(filepath.FromSlash(rel)) {
+		return "", fmt.Errorf(`key "%s" does not map to a path inside the directory`, key)
+	}
+
+	if ext != "" {
+		if rel = strings.TrimSuffix(rel, ext); !filepath.IsLocal(filepath.FromSlash(rel)) {
+			return "", fmt.Errorf(`key "%s" does not map to a path inside the directory`, key)
+		}
+	}
+
+	return filepath.Join(dir, filepath.FromSlash(rel)), nil
+}
+
+// samePull returns true if the .s3 file written by an earlier pull of the object still has the same ETag, and the local
+// file still exists unless it was an extracted archive.
+func samePull(name string, extracted bool, bucket, key string, etag *string) (bool, error) {
+	man, err := internal.LoadManifestFromFile(name + ".s3")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, err
+	case man.Bucket != bucket || man.Key != key || man.ETag == "" || man.ETag != aws.ToString(etag):
+		return false, nil
+	case extracted:
+		return true, nil
+	}
+
+	switch fi, err := os.Stat(name); {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf(`stat file "%s" error: %w`, name, err)
+	default:
+		return !fi.IsDir(), nil
+	}
+}
+
+// removeExtracted removes the file or directory that an earlier pull extracted the named archive to, as recorded by its
+// .s3 file.
+//
+// Extracted paths that are not inside the archive's directory are ignored.
+func removeExtracted(ctx context.Context, name string) error {
+	man, err := internal.LoadManifestFromFile(name + ".s3")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	case man.Extracted == "" || !filepath.IsLocal(filepath.FromSlash(man.Extracted)):
+		return nil
+	}
+
+	target := filepath.Join(filepath.Dir(name), filepath.FromSlash(man.Extracted))
+	internal.MustLogger(ctx).Printf(`deleting "%s" extracted from an earlier version`, target)
+	if err = os.RemoveAll(target); err != nil {
+		return fmt.Errorf(`delete "%s" error: %w`, target, err)
+	}
+
+	return nil
+}
+
+// writePullManifest writes the .s3 file of the object next to the decrypted file or extracted archive.
+func writePullManifest(name string, man internal.Manifest) error {
+	f, err := os.OpenFile(name+".s3", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("create manifest file error: %w", err)
+	}
+
+	if err, _ = man.SaveTo(f), f.Close(); err != nil {
+		return fmt.Errorf(`write manifest to "%s" error: %w`, f.Name(), err)
+	}
+
+	return nil
+}
+
+// sameChecksum returns true if the local file exists with the given size and checksum.
+func sameChecksum(name string, size int64, checksum string) (bool, error) {
+	fi, err := os.Stat(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return false, nil
+	case err != nil:
+		return false, fmt.Errorf(`stat file "%s" error: %w`, name, err)
+	case fi.IsDir():
+		return false, fmt.Errorf(`"%s" is a directory`, name)
+	case fi.Size() != size || checksum == "":
+		return false, nil
+	}
+
+	verifier := internal.NewMultiVerifier(checksum)
+	if verifier == nil {
+		return false, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return false, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(verifier, f); err != nil {
+		return false, fmt.Errorf(`hash file "%s" error: %w`, name, err)
+	}
+
+	_, _, ok := verifier.SumAndVerify()
+	return ok, nil
+}
@@ -0,0 +1,249 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func checksumOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256-" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+func TestSameChecksum(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hello, world!")
+	name := filepath.Join(dir, "a.txt")
+	require.NoError(t, os.WriteFile(name, data, 0644))
+
+	tests := []struct {
+		name     string
+		file     string
+		size     int64
+		checksum string
+		want     bool
+		wantErr  bool
+	}{
+		{name: "same", file: name, size: int64(len(data)), checksum: checksumOf(data), want: true},
+		{name: "missing file", file: filepath.Join(dir, "b.txt"), size: int64(len(data)), checksum: checksumOf(data)},
+		{name: "size changed", file: name, size: 1, checksum: checksumOf(data)},
+		{name: "no checksum", file: name, size: int64(len(data))},
+		{name: "unknown checksum", file: name, size: int64(len(data)), checksum: "md5-abc"},
+		{name: "content changed", file: name, size: int64(len(data)), checksum: checksumOf([]byte("hello, WORLD!"))},
+		{name: "directory", file: dir, size: int64(len(data)), checksum: checksumOf(data), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := sameChecksum(tt.file, tt.size, tt.checksum)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPullName(t *testing.T) {
+	dir := filepath.Join("out", "dir")
+
+	tests := []struct {
+		name    string
+		key     string
+		ext     string
+		want    string
+		wantErr bool
+	}{
+		{name: "nested", key: "prefix/a/b.txt", want: filepath.Join(dir, "a", "b.txt")},
+		{name: "decrypted", key: "prefix/a/b.txt.age", ext: ".age", want: filepath.Join(dir, "a", "b.txt")},
+		{name: "parent", key: "prefix/../b.txt", wantErr: true},
+		{name: "nested parent", key: "prefix/a/../../b.txt", wantErr: true},
+		{name: "absolute", key: "prefix//etc/passwd", wantErr: true},
+		{name: "only extension", key: "prefix/.age", ext: ".age", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := pullName(dir, "prefix/", tt.key, tt.ext)
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "does not map to a path inside the directory")
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSamePull(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "a.txt")
+	require.NoError(t, writePullManifest(name, internal.Manifest{Bucket: "bucket", Key: "prefix/a.txt.age", ETag: `"etag"`}))
+
+	// the decrypted file must still exist.
+	got, err := samePull(name, false, "bucket", "prefix/a.txt.age", aws.String(`"etag"`))
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	require.NoError(t, os.WriteFile(name, []byte("hello, world!"), 0644))
+	got, err = samePull(name, false, "bucket", "prefix/a.txt.age", aws.String(`"etag"`))
+	require.NoError(t, err)
+	assert.True(t, got)
+
+	// a replaced object has a different ETag.
+	got, err = samePull(name, false, "bucket", "prefix/a.txt.age", aws.String(`"new"`))
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	got, err = samePull(name, false, "other", "prefix/a.txt.age", aws.String(`"etag"`))
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	// extracted archives are deleted so only the manifest matters.
+	got, err = samePull(filepath.Join(dir, "b.zip"), true, "bucket", "prefix/b.zip", aws.String(`"etag"`))
+	require.NoError(t, err)
+	assert.False(t, got)
+
+	require.NoError(t, writePullManifest(filepath.Join(dir, "b.zip"), internal.Manifest{Bucket: "bucket", Key: "prefix/b.zip", ETag: `"etag"`}))
+	got, err = samePull(filepath.Join(dir, "b.zip"), true, "bucket", "prefix/b.zip", aws.String(`"etag"`))
+	require.NoError(t, err)
+	assert.True(t, got)
+}
+
+func TestPull_Skip(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("hello, world!")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "a"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a", "b.txt"), data, 0644))
+	require.NoError(t, writePullManifest(filepath.Join(dir, "c.zip"), internal.Manifest{Bucket: "bucket", Key: "prefix/c.zip", ETag: `"etag"`}))
+
+	client := &s3test.Client{Objects: map[string]*s3.HeadObjectOutput{
+		"prefix/a/b.txt": {
+			ContentLength: aws.Int64(int64(len(data))),
+			ETag:          aws.String(`"etag"`),
+			Metadata:      map[string]string{"checksum": checksumOf(data)},
+		},
+		"prefix/c.zip": {
+			ContentLength: aws.Int64(1024),
+			ETag:          aws.String(`"etag"`),
+		},
+	}}
+
+	c := &Pull{Extract: true, bucket: "bucket", prefix: "prefix/", api: client}
+	c.Args.Dir = flags.Filename(dir)
+	ctx := internal.WithPrefixLogger(t.Context(), "test")
+
+	// a plaintext file with the same checksum.
+	skip, err := c.pull(ctx, "prefix/a/b.txt")
+	require.NoError(t, err)
+	assert.True(t, skip)
+
+	// an archive that was extracted by an earlier pull.
+	skip, err = c.pull(ctx, "prefix/c.zip")
+	require.NoError(t, err)
+	assert.True(t, skip)
+
+	// keys outside the directory are rejected before any request.
+	_, err = c.pull(ctx, "prefix/../d.txt")
+	assert.ErrorContains(t, err, "does not map to a path inside the directory")
+	assert.Equal(t, []string{"prefix/a/b.txt", "prefix/c.zip"}, client.HeadKeys())
+}
+
+func TestPull_ExtractReplaced(t *testing.T) {
+	dir := t.TempDir()
+
+	// the archive is served for downloads, while its ETag comes from the HeadObject fake.
+	var data []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int
+		if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); err != nil {
+			start, end = 0, len(data)-1
+		}
+		end = min(end, len(data)-1)
+
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(data)))
+		w.Header().Set("Content-Length", strconv.Itoa(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[start : end+1])
+	}))
+	defer ts.Close()
+
+	client := &s3test.Client{Objects: map[string]*s3.HeadObjectOutput{}}
+	c := &Pull{
+		Extract: true,
+		bucket:  "bucket",
+		prefix:  "prefix/",
+		client: s3.New(s3.Options{
+			BaseEndpoint: aws.String(ts.URL),
+			Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+			Region:       "us-east-1",
+			UsePathStyle: true,
+		}),
+		api: client,
+	}
+	c.Args.Dir = flags.Filename(dir)
+	ctx := internal.WithPrefixLogger(t.Context(), "test")
+
+	for _, v := range []struct{ etag, file string }{{`"v1"`, "a.txt"}, {`"v2"`, "b.txt"}} {
+		data = newZip(t, v.file, "hello, world!")
+		client.Objects["prefix/c.zip"] = &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(data))), ETag: aws.String(v.etag)}
+
+		skip, err := c.pull(ctx, "prefix/c.zip")
+		require.NoError(t, err)
+		assert.False(t, skip)
+
+		// the new version replaces the directory extracted from the old one.
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		assert.Equal(t, []string{"c", "c.zip.s3"}, names)
+
+		entries, err = os.ReadDir(filepath.Join(dir, "c"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, v.file, entries[0].Name())
+
+		man, err := internal.LoadManifestFromFile(filepath.Join(dir, "c.zip.s3"))
+		require.NoError(t, err)
+		assert.Equal(t, v.etag, man.ETag)
+		assert.Equal(t, "c", man.Extracted)
+	}
+}
+
+// newZip returns a zip archive with a single file of the given name and contents.
+func newZip(t *testing.T, name, contents string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	f, err := w.Create(name)
+	require.NoError(t, err)
+	_, err = f.Write([]byte(contents))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	return buf.Bytes()
+}
@@ -15,7 +15,6 @@ import (
 	"github.com/krolaw/zipstream"
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/s3reader"
-	"github.com/nguyengg/go-aws-commons/sri"
 	"github.com/nguyengg/go-aws-commons/tspb"
 	"github.com/nguyengg/xy3/internal"
 	"github.com/nguyengg/xy3/zipper"
@@ -35,6 +34,7 @@ func (c *Command) canStream(ctx context.Context, man internal.Manifest) (headers
 	r, err := s3reader.New(ctx, client, &s3.GetObjectInput{
 		Bucket:              aws.String(man.Bucket),
 		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
 		ExpectedBucketOwner: expectedBucketOwner,
 	})
 	if err != nil {
@@ -88,7 +88,7 @@ func (c *Command) stream(ctx context.Context, man internal.Manifest) (bool, erro
 		return false, err
 	}
 
-	verifier, _ := sri.NewVerifier(man.Checksum)
+	verifier := internal.NewMultiVerifier(append([]string{man.Checksum}, man.Checksums...)...)
 
 	// attempt to create the local directory that will store the extracted files.
 	// if we fail to download the file complete, clean up by deleting the directory.
@@ -128,6 +128,7 @@ func (c *Command) stream(ctx context.Context, man internal.Manifest) (bool, erro
 		r, err := s3reader.New(ctx, client, &s3.GetObjectInput{
 			Bucket:              aws.String(man.Bucket),
 			Key:                 aws.String(man.Key),
+			VersionId:           man.VersionID,
 			ExpectedBucketOwner: expectedBucketOwner,
 		}, func(opts *s3reader.Options) {
 			opts.MaxBytesInSecond = c.MaxBytesInSecond
@@ -204,10 +205,10 @@ func (c *Command) stream(ctx context.Context, man internal.Manifest) (bool, erro
 		return true, nil
 	}
 
-	if verifier.SumAndVerify(nil) {
+	if expected, actual, ok := verifier.SumAndVerify(); ok {
 		logger.Printf("done downloading; checksum matches")
 	} else {
-		logger.Printf("done downloading; checksum does not match: expect %s, got %s", man.Checksum, verifier.SumToString(nil))
+		logger.Printf("done downloading; checksum does not match: expect %s, got %s", expected, actual)
 	}
 
 	return true, nil
@@ -76,6 +76,7 @@ func (c *Command) streamV2(ctx context.Context, man internal.Manifest) (bool, er
 	r, err := s3reader.New(ctx, client, &s3.GetObjectInput{
 		Bucket:              aws.String(man.Bucket),
 		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
 		ExpectedBucketOwner: expectedBucketOwner,
 	})
 	if err != nil {
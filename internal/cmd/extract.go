@@ -16,6 +16,8 @@ import (
 
 type Extract struct {
 	DecompressOnly bool `long:"decompress-only" description:"if specified, the compressed archives will only be decompressed without extracting"`
+	Recursive      bool `short:"r" long:"recursive" description:"if specified, archives found among the extracted files will also be extracted in place"`
+	MaxDepth       int  `long:"max-depth" description:"limits how many levels of nested archives are extracted with --recursive" default:"5"`
 	Args           struct {
 		Files []flags.Filename `positional-arg-name:"file" description:"the local files to be extracted" required:"yes"`
 	} `positional-args:"yes"`
@@ -39,6 +41,8 @@ func (c *Extract) Execute(args []string) (err error) {
 
 		if _, err = xy3.Decompress(ctx, string(file), ".", func(opts *xy3.DecompressOptions) {
 			opts.NoExtract = c.DecompressOnly
+			opts.Recursive = c.Recursive
+			opts.MaxDepth = c.MaxDepth
 		}); err == nil {
 			logger.Printf("done decompresing")
 			success++
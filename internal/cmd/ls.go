@@ -0,0 +1,280 @@
+package cmd
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/dustin/go-humanize"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Ls struct {
+	Profile     string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Recursive   bool   `short:"r" long:"recursive" description:"if specified, list every object under the prefix instead of grouping them into directories by \"/\""`
+	Head        bool   `long:"head" description:"if specified, get the checksum metadata of objects without a local manifest with HeadObject"`
+	JSON        bool   `long:"json" description:"if specified, print the listing as JSON to stdout"`
+	Dir         string `long:"dir" default:"." description:"the local directory whose .s3 files (including those in subdirectories) are matched against the listed objects"`
+	Args        struct {
+		Locations []string `positional-arg-name:"s3location" description:"S3 locations in format s3://bucket/prefix (optional prefix)" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+// lsClient abstracts the S3 APIs that Ls uses, which lets tests substitute a fake.
+type lsClient interface {
+	s3.ListObjectsV2APIClient
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// lsResult is the listing of a single S3 location.
+type lsResult struct {
+	Bucket   string     `json:"bucket"`
+	Prefix   string     `json:"prefix"`
+	Prefixes []string   `json:"prefixes,omitempty"`
+	Objects  []lsObject `json:"objects"`
+}
+
+// lsObject is an object in lsResult.
+type lsObject struct {
+	Key               string    `json:"key"`
+	Size              int64     `json:"size"`
+	LastModified      time.Time `json:"lastModified"`
+	StorageClass      string    `json:"storageClass,omitempty"`
+	ETag              string    `json:"etag,omitempty"`
+	ChecksumAlgorithm string    `json:"checksumAlgorithm,omitempty"`
+	Checksum          string    `json:"checksum,omitempty"`
+
+	// Manifests are the local .s3 files that match the object, while StaleManifests point to an older version of it.
+	//
+	// See localManifest.matches: ETags are compared first, with size as the fallback for manifests without ETag.
+	Manifests      []string `json:"manifests,omitempty"`
+	StaleManifests []string `json:"staleManifests,omitempty"`
+}
+
+func (c *Ls) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	manifests, err := findLocalManifests(c.Dir)
+	if err != nil {
+		return err
+	}
+
+	results := make([]lsResult, 0, len(c.Args.Locations))
+	for _, s3Location := range c.Args.Locations {
+		res, err := c.list(ctx, s3Location, manifests)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			return fmt.Errorf(`list "%s" error: %w`, s3Location, err)
+		}
+
+		results = append(results, res)
+	}
+
+	return c.write(os.Stdout, results)
+}
+
+// write prints the listings to w as JSON if --json, or as a table otherwise.
+func (c *Ls) write(w io.Writer, results []lsResult) error {
+	if c.JSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, res := range results {
+		for _, p := range res.Prefixes {
+			_, _ = fmt.Fprintf(tw, "\t\tPRE\t\t\t%s\n", p)
+		}
+
+		for _, o := range res.Objects {
+			status := ""
+			switch {
+			case len(o.Manifests) != 0:
+				status = "manifest"
+			case len(o.StaleManifests) != 0:
+				status = "stale manifest"
+			}
+
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+				o.LastModified.Local().Format(time.DateTime),
+				humanize.IBytes(uint64(o.Size)),
+				o.StorageClass,
+				cmp.Or(o.Checksum, strings.ToLower(o.ChecksumAlgorithm)),
+				status,
+				o.Key)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// list lists the objects and, unless --recursive, the common prefixes under the S3 location.
+func (c *Ls) list(ctx context.Context, s3Location string, manifests map[string][]localManifest) (res lsResult, err error) {
+	if res.Bucket, res.Prefix, err = internal.ParseS3URI(s3Location); err != nil {
+		return res, fmt.Errorf(`invalid s3 location "%s": %w`, s3Location, err)
+	}
+
+	client, err := config.NewS3ClientForBucket(ctx, res.Bucket)
+	if err != nil {
+		return res, fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	return c.listObjects(ctx, client, res, manifests)
+}
+
+// listObjects fills in res, whose Bucket and Prefix must already be set, with the listing from client.
+func (c *Ls) listObjects(ctx context.Context, client lsClient, res lsResult, manifests map[string][]localManifest) (lsResult, error) {
+	cfg := config.ForBucket(res.Bucket)
+
+	// objects encrypted with SSE-C can only be described with the key.
+	sseKey, err := cfg.SSE.CustomerKey()
+	if err != nil {
+		return res, err
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:              aws.String(res.Bucket),
+		ExpectedBucketOwner: cfg.ExpectedBucketOwner,
+	}
+	if res.Prefix != "" {
+		input.Prefix = aws.String(res.Prefix)
+	}
+	if !c.Recursive {
+		input.Delimiter = aws.String("/")
+	}
+
+	res.Objects = make([]lsObject, 0)
+	for paginator := s3.NewListObjectsV2Paginator(client, input); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return res, fmt.Errorf("list objects error: %w", err)
+		}
+
+		for _, p := range page.CommonPrefixes {
+			res.Prefixes = append(res.Prefixes, aws.ToString(p.Prefix))
+		}
+
+		for _, obj := range page.Contents {
+			o := lsObject{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				LastModified: aws.ToTime(obj.LastModified),
+				StorageClass: string(obj.StorageClass),
+				ETag:         aws.ToString(obj.ETag),
+			}
+			if len(obj.ChecksumAlgorithm) != 0 {
+				o.ChecksumAlgorithm = string(obj.ChecksumAlgorithm[0])
+			}
+
+			for _, m := range manifests[res.Bucket+"/"+o.Key] {
+				if m.matches(o) {
+					o.Manifests = append(o.Manifests, m.name)
+					o.Checksum = cmp.Or(o.Checksum, m.man.Checksum)
+				} else {
+					o.StaleManifests = append(o.StaleManifests, m.name)
+				}
+			}
+
+			if c.Head && o.Checksum == "" {
+				headObjectInput := &s3.HeadObjectInput{
+					Bucket:              aws.String(res.Bucket),
+					Key:                 obj.Key,
+					ExpectedBucketOwner: cfg.ExpectedBucketOwner,
+				}
+				headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+
+				headObjectResult, err := client.HeadObject(ctx, headObjectInput)
+				if err != nil {
+					return res, fmt.Errorf(`get metadata about "%s" error: %w`, o.Key, err)
+				}
+
+				o.Checksum = headObjectResult.Metadata["checksum"]
+			}
+
+			res.Objects = append(res.Objects, o)
+		}
+	}
+
+	return res, nil
+}
+
+// localManifest is a .s3 file found by findLocalManifests.
+type localManifest struct {
+	name string
+	man  internal.Manifest
+}
+
+// matches returns true if the manifest points to the listed object.
+//
+// The ETag changes whenever the object is replaced so it is compared if the manifest has one. Older manifests without
+// ETag can only be compared by size.
+func (m localManifest) matches(o lsObject) bool {
+	if m.man.ETag != "" && o.ETag != "" {
+		return m.man.ETag == o.ETag
+	}
+
+	return m.man.Size == o.Size
+}
+
+// findLocalManifests returns the .s3 files in the directory tree, keyed by "bucket/key" of their objects.
+//
+// Hidden directories are skipped, as are .s3 files that are not valid manifests.
+func findLocalManifests(root string) (map[string][]localManifest, error) {
+	manifests := make(map[string][]localManifest)
+
+	if err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil:
+			return err
+		case d.IsDir():
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		case filepath.Ext(path) != ".s3":
+			return nil
+		}
+
+		man, err := internal.LoadManifestFromFile(path)
+		if err != nil {
+			log.Printf(`ignoring "%s": %v`, path, err)
+			return nil
+		}
+
+		k := man.Bucket + "/" + man.Key
+		manifests[k] = append(manifests[k], localManifest{name: path, man: man})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf(`find manifests in "%s" error: %w`, root, err)
+	}
+
+	return manifests, nil
+}
@@ -0,0 +1,216 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalManifest_Matches(t *testing.T) {
+	o := lsObject{Key: "key", Size: 5, ETag: `"new"`}
+
+	// a replaced object of the same size does not match.
+	assert.False(t, localManifest{man: internal.Manifest{Size: 5, ETag: `"old"`}}.matches(o))
+	assert.True(t, localManifest{man: internal.Manifest{Size: 5, ETag: `"new"`}}.matches(o))
+
+	// older manifests without ETag fall back to size.
+	assert.True(t, localManifest{man: internal.Manifest{Size: 5}}.matches(o))
+	assert.False(t, localManifest{man: internal.Manifest{Size: 6}}.matches(o))
+}
+
+func TestLs_ListObjects(t *testing.T) {
+	lastModified := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	newHead := func(size int64, etag string) *s3.HeadObjectOutput {
+		return &s3.HeadObjectOutput{
+			ContentLength: aws.Int64(size),
+			ETag:          aws.String(etag),
+			LastModified:  aws.Time(lastModified),
+			Metadata:      map[string]string{"checksum": "sha256-" + etag},
+			StorageClass:  types.StorageClassStandardIa,
+		}
+	}
+	newObject := func(key string, size int64, etag string) lsObject {
+		return lsObject{Key: key, Size: size, LastModified: lastModified, StorageClass: "STANDARD_IA", ETag: etag}
+	}
+
+	// a.txt has a manifest of the same version, while b.txt has a manifest of an older version.
+	dir := t.TempDir()
+	writeManifest(t, filepath.Join(dir, "a.txt.s3"), internal.Manifest{Bucket: "bucket", Key: "prefix/a.txt", ETag: `"a"`, Checksum: "sha256-local"})
+	writeManifest(t, filepath.Join(dir, "b.txt.s3"), internal.Manifest{Bucket: "bucket", Key: "prefix/b.txt", ETag: `"old"`})
+	manifests, err := findLocalManifests(dir)
+	require.NoError(t, err)
+
+	withManifests := func(o lsObject, checksum string, manifests, staleManifests []string) lsObject {
+		o.Checksum, o.Manifests, o.StaleManifests = checksum, manifests, staleManifests
+		return o
+	}
+
+	tests := []struct {
+		name      string
+		ls        Ls
+		want      lsResult
+		wantHeads []string
+	}{
+		{
+			name: "delimiter",
+			want: lsResult{
+				Bucket:   "bucket",
+				Prefix:   "prefix/",
+				Prefixes: []string{"prefix/sub/"},
+				Objects: []lsObject{
+					withManifests(newObject("prefix/a.txt", 1, `"a"`), "sha256-local", []string{filepath.Join(dir, "a.txt.s3")}, nil),
+					withManifests(newObject("prefix/b.txt", 2, `"b"`), "", nil, []string{filepath.Join(dir, "b.txt.s3")}),
+				},
+			},
+		},
+		{
+			name: "recursive",
+			ls:   Ls{Recursive: true},
+			want: lsResult{
+				Bucket: "bucket",
+				Prefix: "prefix/",
+				Objects: []lsObject{
+					withManifests(newObject("prefix/a.txt", 1, `"a"`), "sha256-local", []string{filepath.Join(dir, "a.txt.s3")}, nil),
+					withManifests(newObject("prefix/b.txt", 2, `"b"`), "", nil, []string{filepath.Join(dir, "b.txt.s3")}),
+					newObject("prefix/sub/c.txt", 3, `"c"`),
+					newObject("prefix/sub/d/e.txt", 4, `"e"`),
+				},
+			},
+		},
+		{
+			// only objects without checksum from a matching manifest are described.
+			name: "head",
+			ls:   Ls{Head: true},
+			want: lsResult{
+				Bucket:   "bucket",
+				Prefix:   "prefix/",
+				Prefixes: []string{"prefix/sub/"},
+				Objects: []lsObject{
+					withManifests(newObject("prefix/a.txt", 1, `"a"`), "sha256-local", []string{filepath.Join(dir, "a.txt.s3")}, nil),
+					withManifests(newObject("prefix/b.txt", 2, `"b"`), `sha256-"b"`, nil, []string{filepath.Join(dir, "b.txt.s3")}),
+				},
+			},
+			wantHeads: []string{"prefix/b.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &s3test.Client{Objects: map[string]*s3.HeadObjectOutput{
+				"other/x.txt":        newHead(0, `"x"`),
+				"prefix/a.txt":       newHead(1, `"a"`),
+				"prefix/b.txt":       newHead(2, `"b"`),
+				"prefix/sub/c.txt":   newHead(3, `"c"`),
+				"prefix/sub/d/e.txt": newHead(4, `"e"`),
+			}}
+
+			got, err := tt.ls.listObjects(t.Context(), client, lsResult{Bucket: "bucket", Prefix: "prefix/"}, manifests)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantHeads, client.HeadKeys())
+		})
+	}
+}
+
+func TestFindLocalManifests(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "sub"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".hidden"), 0755))
+
+	// two manifests of the same object in different directories are both found.
+	m := internal.Manifest{Bucket: "bucket", Key: "prefix/a.txt", Size: 1}
+	writeManifest(t, filepath.Join(dir, "a.txt.s3"), m)
+	writeManifest(t, filepath.Join(dir, "sub", "a.txt.s3"), m)
+	writeManifest(t, filepath.Join(dir, "sub", "b.txt.s3"), internal.Manifest{Bucket: "bucket", Key: "prefix/b.txt"})
+
+	// hidden directories, invalid manifests, and files without .s3 extension are skipped.
+	writeManifest(t, filepath.Join(dir, ".hidden", "c.txt.s3"), internal.Manifest{Bucket: "bucket", Key: "prefix/c.txt"})
+	writeManifest(t, filepath.Join(dir, "d.txt.json"), internal.Manifest{Bucket: "bucket", Key: "prefix/d.txt"})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "e.txt.s3"), []byte("not json"), 0644))
+
+	got, err := findLocalManifests(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]localManifest{
+		"bucket/prefix/a.txt": {
+			{name: filepath.Join(dir, "a.txt.s3"), man: m},
+			{name: filepath.Join(dir, "sub", "a.txt.s3"), man: m},
+		},
+		"bucket/prefix/b.txt": {
+			{name: filepath.Join(dir, "sub", "b.txt.s3"), man: internal.Manifest{Bucket: "bucket", Key: "prefix/b.txt"}},
+		},
+	}, got)
+}
+
+func TestLs_WriteJSON(t *testing.T) {
+	results := []lsResult{
+		{
+			Bucket:   "bucket",
+			Prefix:   "prefix/",
+			Prefixes: []string{"prefix/sub/"},
+			Objects: []lsObject{
+				{
+					Key:            "prefix/a.txt",
+					Size:           1,
+					LastModified:   time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+					StorageClass:   "STANDARD",
+					ETag:           `"a"`,
+					Checksum:       "sha256-local",
+					Manifests:      []string{"a.txt.s3"},
+					StaleManifests: []string{"old/a.txt.s3"},
+				},
+			},
+		},
+		{
+			// an empty listing still has an objects array.
+			Bucket:  "bucket",
+			Prefix:  "empty/",
+			Objects: []lsObject{},
+		},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, (&Ls{JSON: true}).write(&buf, results))
+	assert.JSONEq(t, `[
+	{
+		"bucket": "bucket",
+		"prefix": "prefix/",
+		"prefixes": ["prefix/sub/"],
+		"objects": [
+			{
+				"key": "prefix/a.txt",
+				"size": 1,
+				"lastModified": "2026-01-02T03:04:05Z",
+				"storageClass": "STANDARD",
+				"etag": "\"a\"",
+				"checksum": "sha256-local",
+				"manifests": ["a.txt.s3"],
+				"staleManifests": ["old/a.txt.s3"]
+			}
+		]
+	},
+	{
+		"bucket": "bucket",
+		"prefix": "empty/",
+		"objects": []
+	}
+]`, buf.String())
+}
+
+// writeManifest saves the manifest to the named file.
+func writeManifest(t *testing.T, name string, m internal.Manifest) {
+	f, err := os.Create(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	require.NoError(t, m.SaveTo(f))
+}
@@ -20,9 +20,10 @@ import (
 )
 
 type Remove struct {
-	Profile   string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
-	KeepLocal bool   `long:"keep-local" description:"by default, the local files will be deleted upon successfully deleted in S3; specify this to keep the local files intact"`
-	Args      struct {
+	Profile     string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	KeepLocal   bool   `long:"keep-local" description:"by default, the local files will be deleted upon successfully deleted in S3; specify this to keep the local files intact"`
+	Args        struct {
 		Files []flags.Filename `positional-arg-name:"file" description:"the local files each containing a single S3 URI" required:"yes"`
 	} `positional-args:"yes"`
 }
@@ -35,7 +36,7 @@ func (c *Remove) Execute(args []string) (err error) {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
-	if _, err = config.LoadProfile(ctx, c.Profile); err != nil {
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
 		return err
 	}
 
@@ -116,12 +117,20 @@ func (c *Remove) remove(ctx context.Context, name string) error {
 		return fmt.Errorf("create s3 client error: %w", err)
 	}
 
-	// headObject first just in case.
-	if _, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+	// headObject first just in case. objects encrypted with SSE-C need the key even for headObject.
+	headObjectInput := &s3.HeadObjectInput{
 		Bucket:              &man.Bucket,
 		Key:                 &man.Key,
+		VersionId:           man.VersionID,
 		ExpectedBucketOwner: expectedBucketOwner,
-	}); err != nil {
+	}
+	if sseKey, err := cfg.SSE.CustomerKeyForManifest(man); err != nil {
+		logger.Printf("get SSE-C key error: %v", err)
+	} else {
+		headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+	}
+
+	if _, err = client.HeadObject(ctx, headObjectInput); err != nil {
 		if errors.Is(err, context.Canceled) {
 			return err
 		}
@@ -136,11 +145,16 @@ func (c *Remove) remove(ctx context.Context, name string) error {
 		logger.Printf("check s3 object metadata error: %v", err)
 	}
 
-	logger.Printf(`deleting "s3://%s/%s"`, man.Bucket, man.Key)
+	if man.VersionID != nil {
+		logger.Printf(`deleting "s3://%s/%s" version "%s"`, man.Bucket, man.Key, *man.VersionID)
+	} else {
+		logger.Printf(`deleting "s3://%s/%s"`, man.Bucket, man.Key)
+	}
 
 	if _, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket:              aws.String(man.Bucket),
 		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
 		ExpectedBucketOwner: expectedBucketOwner,
 	}); err != nil {
 		if errors.Is(err, context.Canceled) {
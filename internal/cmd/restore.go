@@ -0,0 +1,263 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Restore struct {
+	Profile      string        `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL  string        `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Tier         string        `long:"tier" choice:"Standard" choice:"Bulk" choice:"Expedited" default:"Standard" description:"the retrieval tier; DEEP_ARCHIVE objects do not support Expedited"`
+	Days         int32         `long:"days" default:"7" description:"the number of days the restored copy is available for; ignored for objects in the archive access tiers of S3 Intelligent-Tiering"`
+	Wait         bool          `long:"wait" description:"if specified, block until every restore has completed"`
+	PollInterval time.Duration `long:"poll-interval" default:"5m" description:"how often the restore status is checked (with --wait)"`
+	Args         struct {
+		Files []flags.Filename `positional-arg-name:"file" description:"the local .s3 files whose archived objects are restored; if none are given, every .s3 file with a pending restore in the current directory is checked"`
+	} `positional-args:"yes"`
+}
+
+func (c *Restore) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.Days <= 0 {
+		return fmt.Errorf("--days must be positive")
+	}
+
+	if c.PollInterval <= 0 {
+		return fmt.Errorf("--poll-interval must be positive")
+	}
+
+	files := make([]string, 0, len(c.Args.Files))
+	for _, file := range c.Args.Files {
+		files = append(files, string(file))
+	}
+	if len(files) == 0 {
+		// pending restores are tracked by the state file next to each manifest.
+		matches, err := filepath.Glob("*" + internal.RestoreStateExt)
+		if err != nil {
+			return fmt.Errorf("find pending restores error: %w", err)
+		}
+		if len(matches) == 0 {
+			return fmt.Errorf("no pending restores in the current directory")
+		}
+
+		for _, m := range matches {
+			files = append(files, strings.TrimSuffix(m, internal.RestoreStateExt))
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	success := 0
+	failures := make([]error, 0)
+	pending := make([]*pendingRestore, 0)
+	n := len(files)
+	for i, file := range files {
+		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, flags.Filename(file)))
+		logger := internal.MustLogger(ctx)
+
+		p, err := c.restore(ctx, file)
+		switch {
+		case err == nil && p == nil:
+			success++
+			continue
+		case err == nil:
+			p.ctx = ctx
+			pending = append(pending, p)
+			continue
+		case errors.Is(err, context.Canceled):
+			return nil
+		}
+
+		logger.Printf("restore error: %v", err)
+		failures = append(failures, fmt.Errorf(`restore "%s" error: %v`, file, err))
+	}
+
+	if c.Wait {
+		for _, p := range pending {
+			if err = c.wait(p); err == nil {
+				success++
+				continue
+			}
+
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			internal.MustLogger(p.ctx).Printf("wait for restore error: %v", err)
+			failures = append(failures, fmt.Errorf(`wait for restore of "%s" error: %v`, p.manifestName, err))
+		}
+
+		log.Printf("successfully restored %d/%d files", success, n)
+	} else {
+		log.Printf("%d/%d files are readable, %d restores are in progress", success, n, len(pending))
+	}
+
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// pendingRestore is an object whose restore is in progress.
+type pendingRestore struct {
+	ctx          context.Context
+	manifestName string
+	client       *s3.Client
+	input        *s3.HeadObjectInput
+}
+
+// restore requests the restore of the manifest's object if it is archived.
+//
+// The returned pendingRestore is nil if the object can already be downloaded.
+func (c *Restore) restore(ctx context.Context, name string) (*pendingRestore, error) {
+	logger := internal.MustLogger(ctx)
+	stateName := name + internal.RestoreStateExt
+
+	man, err := internal.LoadManifestFromFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("read manifest error: %w", err)
+	}
+
+	cfg := config.ForBucket(man.Bucket)
+	expectedBucketOwner := internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner)
+
+	sseKey, err := cfg.SSE.CustomerKeyForManifest(man)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := config.NewS3ClientForBucket(ctx, man.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	headObjectInput := &s3.HeadObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: expectedBucketOwner,
+	}
+	headObjectInput.SSECustomerAlgorithm, headObjectInput.SSECustomerKey, headObjectInput.SSECustomerKeyMD5 = sseKey.Headers()
+
+	head, err := client.HeadObject(ctx, headObjectInput)
+	if err != nil {
+		return nil, fmt.Errorf("get object metadata error: %w", err)
+	}
+
+	p := &pendingRestore{manifestName: name, client: client, input: headObjectInput}
+
+	if !internal.IsArchived(head) {
+		logger.Printf(`object has storage class "%s" and can be downloaded without restore`, head.StorageClass)
+		_ = os.Remove(stateName)
+		return nil, nil
+	}
+
+	status, ok, err := internal.ParseRestoreStatus(head.Restore)
+	switch {
+	case err != nil:
+		return nil, err
+	case ok && !status.Ongoing:
+		logRestored(logger, status)
+		_ = os.Remove(stateName)
+		return nil, nil
+	case ok:
+		if state, err := internal.LoadRestoreStateFromFile(stateName); err == nil {
+			logger.Printf(`restore with tier "%s" requested at %s is in progress`, state.Tier, state.RequestedAt.Local().Format(time.DateTime))
+		} else {
+			logger.Printf("restore is in progress")
+		}
+		return p, nil
+	}
+
+	// objects in the archive access tiers of Intelligent-Tiering move back to the frequent access tier so there are
+	// no days to specify.
+	request := &types.RestoreRequest{GlacierJobParameters: &types.GlacierJobParameters{Tier: types.Tier(c.Tier)}}
+	if head.ArchiveStatus == "" {
+		request.Days = aws.Int32(c.Days)
+	}
+
+	if _, err = client.RestoreObject(ctx, &s3.RestoreObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: expectedBucketOwner,
+		RestoreRequest:      request,
+	}); err != nil {
+		var ae smithy.APIError
+		if !errors.As(err, &ae) || ae.ErrorCode() != "RestoreAlreadyInProgress" {
+			return nil, fmt.Errorf("restore object error: %w", err)
+		}
+
+		logger.Printf("restore is already in progress")
+		return p, nil
+	}
+
+	state := internal.RestoreState{
+		Bucket:      man.Bucket,
+		Key:         man.Key,
+		VersionID:   aws.ToString(man.VersionID),
+		Tier:        c.Tier,
+		Days:        aws.ToInt32(request.Days),
+		RequestedAt: time.Now(),
+	}
+	if err = state.SaveToFile(stateName); err != nil {
+		logger.Printf("requested restore but %v", err)
+	} else {
+		logger.Printf(`requested restore of "%s" object with tier "%s"; run xy3 restore again to check its status`, head.StorageClass, c.Tier)
+	}
+
+	return p, nil
+}
+
+// wait blocks until the restore has completed.
+func (c *Restore) wait(p *pendingRestore) error {
+	logger := internal.MustLogger(p.ctx)
+
+	head, err := internal.WaitForRestore(p.ctx, p.client, p.input, c.PollInterval, func(_ *s3.HeadObjectOutput) {
+		logger.Printf("restore is in progress; checking again in %s", c.PollInterval)
+	})
+	if err != nil {
+		return err
+	}
+
+	if status, ok, _ := internal.ParseRestoreStatus(head.Restore); ok {
+		logRestored(logger, status)
+	}
+
+	_ = os.Remove(p.manifestName + internal.RestoreStateExt)
+	return nil
+}
+
+func logRestored(logger *log.Logger, status internal.RestoreStatus) {
+	if status.ExpiryDate.IsZero() {
+		logger.Printf("object has been restored")
+	} else {
+		logger.Printf("object has been restored until %s", status.ExpiryDate.Local().Format(time.DateTime))
+	}
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+// maxPresignExpires is the longest expiration of a presigned URL signed with SigV4.
+const maxPresignExpires = 7 * 24 * time.Hour
+
+type Share struct {
+	Profile     string        `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL string        `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Expires     time.Duration `long:"expires" default:"24h" description:"how long the URLs are valid for, up to 168h; URLs signed with temporary credentials expire when the credentials do"`
+	Attachment  bool          `long:"attachment" description:"if specified, the GET URLs make browsers save the file with the original filename instead of displaying it"`
+	Uploads     []string      `long:"upload" value-name:"NAME" description:"if specified, the positional arguments must be S3 prefixes in format s3://bucket/prefix/, and a presigned PUT URL is created for each name under each prefix; can be given multiple times"`
+	Args        struct {
+		Files []flags.Filename `positional-arg-name:"file" description:"the local .s3 files or S3 URIs in format s3://bucket/key to create presigned GET URLs for; or S3 prefixes to create presigned PUT URLs for (with --upload)" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *Share) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.Expires <= 0 || c.Expires > maxPresignExpires {
+		return fmt.Errorf("--expires must be positive and at most %s", maxPresignExpires)
+	}
+
+	for _, name := range c.Uploads {
+		if name == "" || strings.HasSuffix(name, "/") {
+			return fmt.Errorf(`invalid --upload name "%s"`, name)
+		}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	success := 0
+	failures := make([]error, 0)
+	n := len(c.Args.Files)
+	for i, file := range c.Args.Files {
+		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, file))
+		logger := internal.MustLogger(ctx)
+
+		if len(c.Uploads) != 0 {
+			err = c.sharePut(ctx, string(file))
+		} else {
+			err = c.shareGet(ctx, string(file))
+		}
+		if err == nil {
+			success++
+			continue
+		}
+
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+
+		logger.Printf("share error: %v", err)
+		failures = append(failures, fmt.Errorf(`share "%s" error: %v`, file, err))
+	}
+
+	log.Printf("successfully shared %d/%d files; the URLs expire at %s", success, n, time.Now().Add(c.Expires).Format(time.DateTime))
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// shareGet prints the presigned GET URL of the object from a manifest or S3 URI.
+func (c *Share) shareGet(ctx context.Context, name string) (err error) {
+	logger := internal.MustLogger(ctx)
+
+	var man internal.Manifest
+	if strings.HasPrefix(name, "s3://") {
+		if man.Bucket, man.Key, err = internal.ParseS3URI(name); err != nil {
+			return fmt.Errorf(`invalid s3 URI "%s": %w`, name, err)
+		}
+		if man.Key == "" || strings.HasSuffix(man.Key, "/") {
+			return fmt.Errorf(`s3 URI "%s" has no key`, name)
+		}
+	} else if man, err = internal.LoadManifestFromFile(name); err != nil {
+		return fmt.Errorf("read manifest error: %w", err)
+	}
+
+	cfg := config.ForBucket(man.Bucket)
+
+	// the recipients would need the key to download objects encrypted with SSE-C. without a manifest, the objects are
+	// assumed to be encrypted with SSE-C if the bucket has a key.
+	var sseKey *internal.SSECustomerKey
+	if strings.HasPrefix(name, "s3://") {
+		sseKey, err = cfg.SSE.CustomerKey()
+	} else {
+		sseKey, err = cfg.SSE.CustomerKeyForManifest(man)
+	}
+	if err != nil {
+		return err
+	}
+	if sseKey != nil {
+		return fmt.Errorf("objects encrypted with SSE-C cannot be shared")
+	}
+	if man.Encryption != nil {
+		logger.Printf(`object is encrypted with %s; the recipients will need an identity to decrypt it`, man.Encryption.Scheme)
+	}
+
+	client, err := config.NewS3ClientForBucket(ctx, man.Bucket)
+	if err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	req, err := c.presignGet(ctx, s3.NewPresignClient(client), man, cfg)
+	if err != nil {
+		return err
+	}
+
+	return c.print(ctx, req)
+}
+
+// presignGet returns the presigned GET request of the object in the manifest.
+func (c *Share) presignGet(ctx context.Context, client *s3.PresignClient, man internal.Manifest, cfg config.BucketConfig) (*v4.PresignedHTTPRequest, error) {
+	input := &s3.GetObjectInput{
+		Bucket:              aws.String(man.Bucket),
+		Key:                 aws.String(man.Key),
+		VersionId:           man.VersionID,
+		ExpectedBucketOwner: internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner),
+	}
+	if c.Attachment {
+		input.ResponseContentDisposition = aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(man.Key)}))
+	}
+
+	req, err := client.PresignGetObject(ctx, input, s3.WithPresignExpires(c.Expires))
+	if err != nil {
+		return nil, fmt.Errorf("presign GetObject error: %w", err)
+	}
+
+	return req, nil
+}
+
+// sharePut prints the presigned PUT URL of every --upload name under the given S3 prefix.
+func (c *Share) sharePut(ctx context.Context, s3Location string) error {
+	logger := internal.MustLogger(ctx)
+
+	bucket, prefix, err := internal.ParseS3URI(s3Location)
+	if err != nil {
+		return fmt.Errorf(`invalid s3 location "%s": %w`, s3Location, err)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	cfg := config.ForBucket(bucket)
+	client, err := config.NewS3ClientForBucket(ctx, bucket)
+	if err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	presignClient := s3.NewPresignClient(client)
+	for _, name := range c.Uploads {
+		req, err := c.presignPut(ctx, presignClient, cfg, bucket, prefix+name)
+		if err != nil {
+			return err
+		}
+
+		logger.Printf(`PUT URL for "s3://%s/%s%s":`, bucket, prefix, name)
+		if err = c.print(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// presignPut returns the presigned PUT request of the given key.
+//
+// Like upload, the bucket's storage class and encryption are applied, so the recipients must send the corresponding
+// headers that are logged by print.
+func (c *Share) presignPut(ctx context.Context, client *s3.PresignClient, cfg config.BucketConfig, bucket, key string) (*v4.PresignedHTTPRequest, error) {
+	// the recipients would need the key to upload objects encrypted with SSE-C.
+	if cfg.SSE.Mode() == internal.SSECustomer {
+		return nil, fmt.Errorf("buckets with SSE-C cannot be shared for upload")
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: cfg.ExpectedBucketOwner,
+		StorageClass:        cfg.StorageClass,
+	}
+	cfg.SSE.ApplyToPutObject(input, nil)
+
+	req, err := client.PresignPutObject(ctx, input, s3.WithPresignExpires(c.Expires))
+	if err != nil {
+		return nil, fmt.Errorf(`presign PutObject for "%s" error: %w`, key, err)
+	}
+
+	return req, nil
+}
+
+// print writes the URL to stdout, and logs the headers that the recipients must also send.
+func (c *Share) print(ctx context.Context, req *v4.PresignedHTTPRequest) error {
+	logger := internal.MustLogger(ctx)
+
+	for k, vs := range req.SignedHeader {
+		if !strings.EqualFold(k, "host") {
+			logger.Printf(`the request must include header "%s: %s"`, k, strings.Join(vs, ","))
+		}
+	}
+
+	if _, err := fmt.Println(req.URL); err != nil {
+		return fmt.Errorf("print URL error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestPresignClient() *s3.PresignClient {
+	return s3.NewPresignClient(s3.New(s3.Options{
+		Credentials: credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		Region:      "us-east-1",
+	}))
+}
+
+func TestShare_Execute(t *testing.T) {
+	tests := []struct {
+		name    string
+		c       Share
+		wantErr string
+	}{
+		{name: "zero expires", c: Share{}, wantErr: "--expires must be positive and at most 168h0m0s"},
+		{name: "negative expires", c: Share{Expires: -time.Hour}, wantErr: "--expires must be positive and at most 168h0m0s"},
+		{name: "expires too long", c: Share{Expires: maxPresignExpires + time.Second}, wantErr: "--expires must be positive and at most 168h0m0s"},
+		{name: "empty upload name", c: Share{Expires: time.Hour, Uploads: []string{""}}, wantErr: `invalid --upload name ""`},
+		{name: "upload name is a prefix", c: Share{Expires: time.Hour, Uploads: []string{"a/"}}, wantErr: `invalid --upload name "a/"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.EqualError(t, tt.c.Execute(nil), tt.wantErr)
+		})
+	}
+}
+
+func TestShare_PresignGet(t *testing.T) {
+	client := newTestPresignClient()
+	man := internal.Manifest{Bucket: "bucket", Key: "prefix/a b.txt", VersionID: aws.String("v1")}
+
+	// the longest expiration is accepted.
+	req, err := (&Share{Expires: maxPresignExpires}).presignGet(t.Context(), client, man, config.BucketConfig{})
+	require.NoError(t, err)
+	u, err := url.Parse(req.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "604800", u.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "v1", u.Query().Get("versionId"))
+	assert.False(t, u.Query().Has("response-content-disposition"))
+
+	req, err = (&Share{Expires: time.Hour, Attachment: true}).presignGet(t.Context(), client, man, config.BucketConfig{})
+	require.NoError(t, err)
+	u, err = url.Parse(req.URL)
+	require.NoError(t, err)
+	assert.Equal(t, "3600", u.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, `attachment; filename="a b.txt"`, u.Query().Get("response-content-disposition"))
+}
+
+func TestShare_PresignPut(t *testing.T) {
+	client := newTestPresignClient()
+	c := &Share{Expires: time.Hour}
+
+	// the recipients must send the encryption and storage class headers that are signed.
+	cfg := config.BucketConfig{
+		StorageClass: types.StorageClassStandardIa,
+		SSE:          config.SSEConfig{ServerSideEncryption: types.ServerSideEncryptionAwsKms, KMSKeyID: "key-id"},
+	}
+	req, err := c.presignPut(t.Context(), client, cfg, "bucket", "prefix/a.txt")
+	require.NoError(t, err)
+	assert.Equal(t, "PUT", req.Method)
+	assert.Contains(t, req.URL, "/prefix/a.txt?")
+	assert.Equal(t, "aws:kms", req.SignedHeader.Get("X-Amz-Server-Side-Encryption"))
+	assert.Equal(t, "key-id", req.SignedHeader.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"))
+	assert.Equal(t, "STANDARD_IA", req.SignedHeader.Get("X-Amz-Storage-Class"))
+
+	// without settings, there are no extra headers.
+	req, err = c.presignPut(t.Context(), client, config.BucketConfig{}, "bucket", "prefix/a.txt")
+	require.NoError(t, err)
+	assert.Empty(t, req.SignedHeader.Get("X-Amz-Server-Side-Encryption"))
+	assert.Empty(t, req.SignedHeader.Get("X-Amz-Storage-Class"))
+
+	_, err = c.presignPut(t.Context(), client, config.BucketConfig{SSE: config.SSEConfig{CustomerKeyEnv: "XY3_SSE_KEY"}}, "bucket", "prefix/a.txt")
+	assert.EqualError(t, err, "buckets with SSE-C cannot be shared for upload")
+}
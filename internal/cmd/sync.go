@@ -0,0 +1,609 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/go-aws-commons/s3writer"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+// mtimeMetadataKey is the S3 metadata that records the modification time of the synced file.
+const mtimeMetadataKey = "mtime"
+
+type Sync struct {
+	Profile           string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL       string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Delete            bool   `long:"delete" description:"if specified, delete the objects under the prefix whose files no longer exist locally"`
+	DryRun            bool   `long:"dry-run" description:"if specified, only log which files would be uploaded and which objects would be deleted"`
+	RefreshMtime      bool   `long:"refresh-mtime" description:"if specified, copy unchanged objects over themselves to update their mtime metadata so that the next sync does not hash their files again; this creates a new version and resets the minimum storage duration of the object"`
+	ManifestsDir      string `long:"manifests-dir" value-name:"DIR" description:"if specified, write a .s3 file for every synced file to this directory, mirroring the directory tree"`
+	AggregateManifest string `long:"aggregate-manifest" value-name:"FILE" description:"if specified, write a single manifest of every synced file to this file; an existing file is updated"`
+	MaxBytesInSecond  int64  `long:"throttle" description:"limits the number of bytes that are uploaded in one second; the zero-value indicates no limit."`
+	Args              struct {
+		Dir        flags.Filename `positional-arg-name:"dir" description:"the local directory whose files are uploaded as individual objects" required:"yes"`
+		S3Location string         `positional-arg-name:"s3location" description:"the S3 bucket and prefix in format s3://bucket/prefix to upload the files to" required:"yes"`
+	} `positional-args:"yes"`
+
+	bucket, prefix string
+	cfg            config.BucketConfig
+	sseKey         *internal.SSECustomerKey
+	client         *s3.Client
+
+	// api is client for everything other than uploads, which lets tests substitute a fake.
+	api syncClient
+}
+
+// syncClient abstracts the S3 APIs that Sync uses other than uploads.
+type syncClient interface {
+	s3.ListObjectsV2APIClient
+	HeadObject(context.Context, *s3.HeadObjectInput, ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	CopyObject(context.Context, *s3.CopyObjectInput, ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObjects(context.Context, *s3.DeleteObjectsInput, ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
+}
+
+// syncFile is a local file to be synced.
+type syncFile struct {
+	path    string
+	rel     string
+	size    int64
+	modTime time.Time
+}
+
+func (c *Sync) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.MaxBytesInSecond < 0 {
+		return fmt.Errorf("--throttle must be non-negative")
+	}
+
+	if c.bucket, c.prefix, err = internal.ParseS3URI(c.Args.S3Location); err != nil {
+		return fmt.Errorf(`invalid s3 location "%s": %w`, c.Args.S3Location, err)
+	}
+	if c.prefix != "" && !strings.HasSuffix(c.prefix, "/") {
+		c.prefix += "/"
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	c.cfg = config.ForBucket(c.bucket)
+	if c.cfg.ChecksumAlgorithm, err = internal.ParseS3ChecksumAlgorithm(string(c.cfg.ChecksumAlgorithm)); err != nil {
+		return err
+	}
+	if c.cfg.Digests, err = internal.ParseDigestAlgorithms(c.cfg.Digests); err != nil {
+		return err
+	}
+	if c.sseKey, err = c.cfg.SSE.CustomerKey(); err != nil {
+		return err
+	}
+
+	// encryption is not deterministic so there would be no way to tell whether a file has changed.
+	if c.cfg.Age.CanEncrypt() {
+		return fmt.Errorf(`bucket "%s" has age encryption which sync does not support; upload the directory as an archive instead`, c.bucket)
+	}
+
+	if c.client, err = config.NewS3ClientForBucket(ctx, c.bucket); err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+	c.api = c.client
+
+	files, err := c.walk(string(c.Args.Dir))
+	if err != nil {
+		return err
+	}
+
+	objects, err := c.listObjects(ctx)
+	if err != nil {
+		return err
+	}
+
+	aggregate := &internal.SyncManifest{Bucket: c.bucket, Prefix: c.prefix, Files: make(map[string]internal.Manifest)}
+	if c.AggregateManifest != "" {
+		switch m, err := internal.LoadSyncManifestFromFile(c.AggregateManifest); {
+		case err == nil && (m.Bucket != c.bucket || m.Prefix != c.prefix):
+			return fmt.Errorf(`aggregate manifest "%s" is for "s3://%s/%s"`, c.AggregateManifest, m.Bucket, m.Prefix)
+		case err == nil:
+			aggregate = &m
+			if aggregate.Files == nil {
+				aggregate.Files = make(map[string]internal.Manifest)
+			}
+		case !errors.Is(err, fs.ErrNotExist):
+			return err
+		}
+	}
+
+	var (
+		uploaded, unchanged, deleted int
+		failures                     = make([]error, 0)
+		n                            = len(files)
+	)
+
+	for i, file := range files {
+		ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, flags.Filename(file.rel)))
+		logger := internal.MustLogger(ctx)
+		key := c.prefix + file.rel
+
+		reason, head, err := c.changed(ctx, file, key, objects[key])
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			logger.Printf("compare error: %v", err)
+			failures = append(failures, fmt.Errorf(`compare "%s" error: %v`, file.rel, err))
+			continue
+		}
+
+		var man internal.Manifest
+		switch {
+		case reason == "" && c.DryRun:
+			unchanged++
+			continue
+
+		case reason == "":
+			unchanged++
+
+			// the manifests of unchanged files are only written if missing.
+			_, ok := aggregate.Files[file.rel]
+			writeAggregate := c.AggregateManifest != "" && !ok
+			writeFile := false
+			if c.ManifestsDir != "" {
+				_, err = os.Stat(c.manifestName(file))
+				writeFile = errors.Is(err, fs.ErrNotExist)
+			}
+			if !writeAggregate && !writeFile {
+				continue
+			}
+
+			man = internal.NewManifestFromHeadObject(c.bucket, key, c.cfg.ExpectedBucketOwner, head)
+			if writeAggregate {
+				aggregate.Files[file.rel] = man
+			}
+			if writeFile {
+				if err = c.writeManifest(file, man); err != nil {
+					logger.Print(err)
+					failures = append(failures, err)
+				}
+			}
+			continue
+
+		case c.DryRun:
+			logger.Printf(`would upload (%s) to "s3://%s/%s"`, reason, c.bucket, key)
+			uploaded++
+			continue
+		}
+
+		logger.Printf(`uploading (%s) to "s3://%s/%s"`, reason, c.bucket, key)
+		if man, err = c.upload(ctx, file, key); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			logger.Printf("upload error: %v", err)
+			failures = append(failures, fmt.Errorf(`upload "%s" error: %v`, file.rel, err))
+			continue
+		}
+		uploaded++
+
+		aggregate.Files[file.rel] = man
+		if err = c.writeManifest(file, man); err != nil {
+			logger.Print(err)
+			failures = append(failures, err)
+		}
+	}
+
+	if c.Delete {
+		if deleted, err = c.deleteObjects(ctx, files, objects, aggregate); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			failures = append(failures, err)
+		}
+	}
+
+	if c.AggregateManifest != "" && !c.DryRun {
+		if err = aggregate.SaveToFile(c.AggregateManifest); err != nil {
+			failures = append(failures, err)
+		} else {
+			log.Printf(`wrote aggregate manifest "%s"`, c.AggregateManifest)
+		}
+	}
+
+	if c.DryRun {
+		log.Printf("dry run: %d files would be uploaded, %d are unchanged, %d objects would be deleted", uploaded, unchanged, deleted)
+	} else {
+		log.Printf("%d files uploaded, %d unchanged, %d objects deleted", uploaded, unchanged, deleted)
+	}
+	if len(failures) != 0 {
+		for _, err = range failures {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// walk returns the regular files in the directory tree sorted by their relative paths.
+//
+// The manifests that sync writes are skipped in case they are inside the directory.
+func (c *Sync) walk(dir string) (files []syncFile, err error) {
+	var excludeDir, excludeFile string
+	if c.ManifestsDir != "" {
+		if excludeDir, err = filepath.Abs(c.ManifestsDir); err != nil {
+			return nil, fmt.Errorf("resolve --manifests-dir error: %w", err)
+		}
+	}
+	if c.AggregateManifest != "" {
+		if excludeFile, err = filepath.Abs(c.AggregateManifest); err != nil {
+			return nil, fmt.Errorf("resolve --aggregate-manifest error: %w", err)
+		}
+	}
+
+	if err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir() && abs == excludeDir:
+			return filepath.SkipDir
+		case !d.Type().IsRegular() || abs == excludeFile:
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, syncFile{path: path, rel: filepath.ToSlash(rel), size: fi.Size(), modTime: fi.ModTime()})
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf(`walk directory "%s" error: %w`, dir, err)
+	}
+
+	slices.SortFunc(files, func(a, b syncFile) int {
+		return strings.Compare(a.rel, b.rel)
+	})
+
+	return files, nil
+}
+
+// listObjects returns the objects under the prefix keyed by their keys.
+func (c *Sync) listObjects(ctx context.Context) (map[string]types.Object, error) {
+	objects := make(map[string]types.Object)
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:              aws.String(c.bucket),
+		ExpectedBucketOwner: c.cfg.ExpectedBucketOwner,
+	}
+	if c.prefix != "" {
+		input.Prefix = aws.String(c.prefix)
+	}
+
+	for paginator := s3.NewListObjectsV2Paginator(c.api, input); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list objects error: %w", err)
+		}
+
+		for _, obj := range page.Contents {
+			objects[aws.ToString(obj.Key)] = obj
+		}
+	}
+
+	return objects, nil
+}
+
+// changed returns the reason the file must be uploaded, or the empty string if the object is unchanged.
+//
+// Objects with the same size are compared by their mtime metadata first, then by their checksum metadata which requires
+// hashing the file. If only the modification time differs, the object's mtime metadata is refreshed with --refresh-mtime
+// (see refreshMtime) so that the next sync does not hash the file again. The HeadObject response is returned for
+// unchanged objects.
+func (c *Sync) changed(ctx context.Context, file syncFile, key string, obj types.Object) (string, *s3.HeadObjectOutput, error) {
+	switch {
+	case obj.Key == nil:
+		return "new", nil, nil
+	case aws.ToInt64(obj.Size) != file.size:
+		return "size changed", nil, nil
+	}
+
+	head, err := c.headObject(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if head.Metadata[mtimeMetadataKey] == formatMtime(file.modTime) {
+		return "", head, nil
+	}
+
+	checksum := head.Metadata["checksum"]
+	if checksum == "" {
+		return "no checksum", nil, nil
+	}
+
+	verifier := internal.NewMultiVerifier(checksum)
+	if verifier == nil {
+		return "unknown checksum", nil, nil
+	}
+
+	f, err := os.Open(file.path)
+	if err != nil {
+		return "", nil, fmt.Errorf(`open file "%s" error: %w`, file.path, err)
+	}
+	defer f.Close()
+
+	if _, err = io.Copy(verifier, f); err != nil {
+		return "", nil, fmt.Errorf(`hash file "%s" error: %w`, file.path, err)
+	}
+
+	if _, _, ok := verifier.SumAndVerify(); !ok {
+		return "content changed", nil, nil
+	}
+
+	// comparing does not modify the object unless asked to.
+	if !c.RefreshMtime || c.DryRun {
+		return "", head, nil
+	}
+
+	if head, err = c.refreshMtime(ctx, file, key, head); err != nil {
+		return "", nil, err
+	}
+
+	return "", head, nil
+}
+
+// headObject returns the HeadObject response of the given key.
+func (c *Sync) headObject(ctx context.Context, key string) (*s3.HeadObjectOutput, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:              aws.String(c.bucket),
+		Key:                 aws.String(key),
+		ExpectedBucketOwner: c.cfg.ExpectedBucketOwner,
+		ChecksumMode:        types.ChecksumModeEnabled,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = c.sseKey.Headers()
+
+	head, err := c.api.HeadObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("head object error: %w", err)
+	}
+
+	return head, nil
+}
+
+// refreshMtime replaces the mtime metadata of an unchanged object with the file's modification time, returning the
+// HeadObject response of the updated object.
+//
+// The object is copied over itself with MetadataDirective REPLACE, keeping its other metadata, storage class,
+// encryption, and checksum algorithm; versioned buckets get a new version with the same contents. Objects that cannot
+// be copied with a single CopyObject (larger than 5 GiB, or archived) are left as-is.
+func (c *Sync) refreshMtime(ctx context.Context, file syncFile, key string, head *s3.HeadObjectOutput) (*s3.HeadObjectOutput, error) {
+	if aws.ToInt64(head.ContentLength) > xy3.MaxCopyObjectSize || !internal.IsReadable(head) {
+		return head, nil
+	}
+
+	metadata := maps.Clone(head.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[mtimeMetadataKey] = formatMtime(file.modTime)
+
+	alg, _ := internal.S3ChecksumsFromHeadObject(head).Get()
+	input := &s3.CopyObjectInput{
+		Bucket:                    aws.String(c.bucket),
+		Key:                       aws.String(key),
+		CopySource:                aws.String((&url.URL{Path: c.bucket + "/" + key}).EscapedPath()),
+		CopySourceIfMatch:         head.ETag,
+		MetadataDirective:         types.MetadataDirectiveReplace,
+		Metadata:                  metadata,
+		CacheControl:              head.CacheControl,
+		ContentDisposition:        head.ContentDisposition,
+		ContentEncoding:           head.ContentEncoding,
+		ContentLanguage:           head.ContentLanguage,
+		ContentType:               head.ContentType,
+		ChecksumAlgorithm:         alg,
+		ExpectedBucketOwner:       c.cfg.ExpectedBucketOwner,
+		ExpectedSourceBucketOwner: c.cfg.ExpectedBucketOwner,
+		StorageClass:              head.StorageClass,
+	}
+	if c.sseKey != nil {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = c.sseKey.Headers()
+		input.CopySourceSSECustomerAlgorithm, input.CopySourceSSECustomerKey, input.CopySourceSSECustomerKeyMD5 = c.sseKey.Headers()
+	} else {
+		input.ServerSideEncryption, input.SSEKMSKeyId, input.BucketKeyEnabled = head.ServerSideEncryption, head.SSEKMSKeyId, head.BucketKeyEnabled
+	}
+
+	if _, err := c.api.CopyObject(ctx, input); err != nil {
+		return nil, fmt.Errorf("update mtime metadata error: %w", err)
+	}
+
+	return c.headObject(ctx, key)
+}
+
+// upload uploads the file, recording its modification time in the object's metadata.
+func (c *Sync) upload(ctx context.Context, file syncFile, key string) (man internal.Manifest, err error) {
+	f, err := os.Open(file.path)
+	if err != nil {
+		return man, fmt.Errorf(`open file "%s" error: %w`, file.path, err)
+	}
+	defer f.Close()
+
+	// read first 512 bytes to detect content type, same as upload.
+	var contentType *string
+	data := make([]byte, 512)
+	if n, err := f.Read(data); err != nil && !errors.Is(err, io.EOF) {
+		return man, fmt.Errorf("read first 512 bytes error: %w", err)
+	} else if v := http.DetectContentType(data[:n]); v != "application/octet-stream" {
+		contentType = &v
+	}
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return man, fmt.Errorf(`seek start of "%s" error: %w`, file.path, err)
+	}
+
+	if man, err = xy3.Upload(ctx, c.client, f, c.bucket, key, func(uploadOpts *xy3.UploadOptions) {
+		uploadOpts.S3WriterOptions = func(s3writerOpts *s3writer.Options) {
+			s3writerOpts.MaxBytesInSecond = c.MaxBytesInSecond
+		}
+
+		uploadOpts.PutObjectInputOptions = func(input *s3.PutObjectInput) {
+			if input.Metadata == nil {
+				input.Metadata = make(map[string]string)
+			}
+			input.Metadata[mtimeMetadataKey] = formatMtime(file.modTime)
+
+			input.ContentType = contentType
+			input.ExpectedBucketOwner = c.cfg.ExpectedBucketOwner
+			input.StorageClass = c.cfg.StorageClass
+			c.cfg.SSE.ApplyToPutObject(input, c.sseKey)
+		}
+
+		uploadOpts.ChecksumAlgorithm = c.cfg.ChecksumAlgorithm
+		uploadOpts.Digests = c.cfg.Digests
+		uploadOpts.ExpectedSize = file.size
+	}); err != nil {
+		return man, fmt.Errorf("upload error: %w", err)
+	}
+
+	man.ExpectedBucketOwner = c.cfg.ExpectedBucketOwner
+	return man, nil
+}
+
+// manifestName returns the name of the file's manifest in --manifests-dir.
+func (c *Sync) manifestName(file syncFile) string {
+	return filepath.Join(c.ManifestsDir, filepath.FromSlash(file.rel)+".s3")
+}
+
+// writeManifest writes the file's manifest to --manifests-dir if specified.
+func (c *Sync) writeManifest(file syncFile, man internal.Manifest) error {
+	if c.ManifestsDir == "" {
+		return nil
+	}
+
+	name := c.manifestName(file)
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return fmt.Errorf(`create manifest directory "%s" error: %w`, filepath.Dir(name), err)
+	}
+
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("create manifest file error: %w", err)
+	}
+
+	if err, _ = man.SaveTo(f), f.Close(); err != nil {
+		return fmt.Errorf(`write manifest to "%s" error: %w`, name, err)
+	}
+
+	return nil
+}
+
+// deleteObjects deletes the objects under the prefix whose files no longer exist locally.
+func (c *Sync) deleteObjects(ctx context.Context, files []syncFile, objects map[string]types.Object, aggregate *internal.SyncManifest) (int, error) {
+	keep := make(map[string]bool, len(files))
+	for _, file := range files {
+		keep[c.prefix+file.rel] = true
+	}
+
+	var ids []types.ObjectIdentifier
+	for key := range objects {
+		if !keep[key] {
+			ids = append(ids, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+	}
+	slices.SortFunc(ids, func(a, b types.ObjectIdentifier) int {
+		return strings.Compare(aws.ToString(a.Key), aws.ToString(b.Key))
+	})
+
+	deleted := 0
+	for chunk := range slices.Chunk(ids, 1000) {
+		for _, id := range chunk {
+			if c.DryRun {
+				log.Printf(`would delete "s3://%s/%s"`, c.bucket, aws.ToString(id.Key))
+			} else {
+				log.Printf(`deleting "s3://%s/%s"`, c.bucket, aws.ToString(id.Key))
+			}
+		}
+
+		if c.DryRun {
+			deleted += len(chunk)
+			continue
+		}
+
+		output, err := c.api.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket:              aws.String(c.bucket),
+			Delete:              &types.Delete{Objects: chunk, Quiet: aws.Bool(true)},
+			ExpectedBucketOwner: c.cfg.ExpectedBucketOwner,
+		})
+		if err != nil {
+			return deleted, fmt.Errorf("delete objects error: %w", err)
+		}
+
+		failed := make(map[string]bool, len(output.Errors))
+		for _, e := range output.Errors {
+			failed[aws.ToString(e.Key)] = true
+			log.Printf(`delete "s3://%s/%s" error: %s`, c.bucket, aws.ToString(e.Key), aws.ToString(e.Message))
+		}
+
+		for _, id := range chunk {
+			key := aws.ToString(id.Key)
+			if failed[key] {
+				continue
+			}
+
+			deleted++
+			rel := strings.TrimPrefix(key, c.prefix)
+			delete(aggregate.Files, rel)
+			if c.ManifestsDir != "" {
+				_ = os.Remove(c.manifestName(syncFile{rel: rel}))
+			}
+		}
+
+		if len(output.Errors) != 0 {
+			return deleted, fmt.Errorf("failed to delete %d objects", len(output.Errors))
+		}
+	}
+
+	return deleted, nil
+}
+
+// formatMtime formats the modification time for the mtime metadata.
+func formatMtime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
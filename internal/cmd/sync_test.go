@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSyncClient adds to s3test.Client by recording CopyObject and DeleteObjects, and fails to delete the keys in
+// deleteErrors.
+type fakeSyncClient struct {
+	s3test.Client
+	deleteErrors map[string]bool
+
+	copies  []*s3.CopyObjectInput
+	deletes []*s3.DeleteObjectsInput
+}
+
+func (f *fakeSyncClient) CopyObject(_ context.Context, input *s3.CopyObjectInput, _ ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	f.copies = append(f.copies, input)
+
+	head := *f.Objects[aws.ToString(input.Key)]
+	head.Metadata = input.Metadata
+	head.VersionId = aws.String("v2")
+	f.Objects[aws.ToString(input.Key)] = &head
+
+	return &s3.CopyObjectOutput{VersionId: head.VersionId}, nil
+}
+
+func (f *fakeSyncClient) DeleteObjects(_ context.Context, input *s3.DeleteObjectsInput, _ ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error) {
+	f.deletes = append(f.deletes, input)
+
+	output := &s3.DeleteObjectsOutput{}
+	for _, id := range input.Delete.Objects {
+		if f.deleteErrors[aws.ToString(id.Key)] {
+			output.Errors = append(output.Errors, types.Error{Key: id.Key, Code: aws.String("AccessDenied"), Message: aws.String("Access Denied")})
+		}
+	}
+
+	return output, nil
+}
+
+func TestSync_Changed(t *testing.T) {
+	data := []byte("hello, world!")
+	sum := sha256.Sum256(data)
+	checksum := "sha256-" + base64.RawStdEncoding.EncodeToString(sum[:])
+
+	name := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, os.WriteFile(name, data, 0644))
+
+	modTime := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	file := syncFile{path: name, rel: "a.txt", size: int64(len(data)), modTime: modTime}
+	obj := types.Object{Key: aws.String("prefix/a.txt"), Size: aws.Int64(int64(len(data)))}
+
+	newHead := func(mtime, checksum string) *s3.HeadObjectOutput {
+		return &s3.HeadObjectOutput{
+			ContentLength: aws.Int64(int64(len(data))),
+			ContentType:   aws.String("text/plain"),
+			ETag:          aws.String(`"etag"`),
+			Metadata:      map[string]string{mtimeMetadataKey: mtime, "checksum": checksum},
+			StorageClass:  types.StorageClassStandardIa,
+		}
+	}
+
+	tests := []struct {
+		name       string
+		obj        types.Object
+		head       *s3.HeadObjectOutput
+		refresh    bool
+		dryRun     bool
+		wantReason string
+		wantCopy   bool
+	}{
+		{
+			name:       "new",
+			wantReason: "new",
+		},
+		{
+			name:       "size changed",
+			obj:        types.Object{Key: obj.Key, Size: aws.Int64(1)},
+			wantReason: "size changed",
+		},
+		{
+			name: "mtime match",
+			obj:  obj,
+			head: newHead(formatMtime(modTime), "sha256-invalid"),
+		},
+		{
+			name: "checksum match",
+			obj:  obj,
+			head: newHead(formatMtime(modTime.Add(-time.Hour)), checksum),
+		},
+		{
+			name:     "checksum match with --refresh-mtime",
+			obj:      obj,
+			head:     newHead(formatMtime(modTime.Add(-time.Hour)), checksum),
+			refresh:  true,
+			wantCopy: true,
+		},
+		{
+			name:    "checksum match with --refresh-mtime and --dry-run",
+			obj:     obj,
+			head:    newHead(formatMtime(modTime.Add(-time.Hour)), checksum),
+			refresh: true,
+			dryRun:  true,
+		},
+		{
+			name:       "content changed",
+			obj:        obj,
+			head:       newHead(formatMtime(modTime.Add(-time.Hour)), "sha256-"+base64.RawStdEncoding.EncodeToString(make([]byte, 32))),
+			wantReason: "content changed",
+		},
+		{
+			name:       "no checksum",
+			obj:        obj,
+			head:       newHead("", ""),
+			wantReason: "no checksum",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &fakeSyncClient{Client: s3test.Client{Objects: map[string]*s3.HeadObjectOutput{}}}
+			if tt.head != nil {
+				client.Objects["prefix/a.txt"] = tt.head
+			}
+
+			c := &Sync{RefreshMtime: tt.refresh, DryRun: tt.dryRun, bucket: "bucket", prefix: "prefix/", api: client}
+			reason, head, err := c.changed(t.Context(), file, "prefix/a.txt", tt.obj)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantReason, reason)
+
+			if tt.wantReason != "" {
+				assert.Nil(t, head)
+				assert.Empty(t, client.copies)
+				return
+			}
+
+			require.NotNil(t, head)
+			if !tt.wantCopy {
+				assert.Empty(t, client.copies)
+				return
+			}
+
+			// the object is copied over itself with only the mtime metadata replaced.
+			require.Len(t, client.copies, 1)
+			input := client.copies[0]
+			assert.Equal(t, "bucket/prefix/a.txt", aws.ToString(input.CopySource))
+			assert.Equal(t, `"etag"`, aws.ToString(input.CopySourceIfMatch))
+			assert.Equal(t, types.MetadataDirectiveReplace, input.MetadataDirective)
+			assert.Equal(t, map[string]string{mtimeMetadataKey: formatMtime(modTime), "checksum": checksum}, input.Metadata)
+			assert.Equal(t, "text/plain", aws.ToString(input.ContentType))
+			assert.Equal(t, types.StorageClassStandardIa, input.StorageClass)
+
+			// the original HeadObject response is not modified, and the response of the new object is returned.
+			assert.Equal(t, formatMtime(modTime.Add(-time.Hour)), tt.head.Metadata[mtimeMetadataKey])
+			assert.Equal(t, formatMtime(modTime), head.Metadata[mtimeMetadataKey])
+			assert.Equal(t, "v2", aws.ToString(head.VersionId))
+		})
+	}
+}
+
+func TestSync_ListObjects(t *testing.T) {
+	client := &fakeSyncClient{Client: s3test.Client{Objects: map[string]*s3.HeadObjectOutput{
+		"prefix/a.txt":     {ContentLength: aws.Int64(1), ETag: aws.String(`"a"`)},
+		"prefix/sub/b.txt": {ContentLength: aws.Int64(2), ETag: aws.String(`"b"`)},
+		"other/c.txt":      {ContentLength: aws.Int64(3), ETag: aws.String(`"c"`)},
+	}}}
+
+	objects, err := (&Sync{bucket: "bucket", prefix: "prefix/", api: client}).listObjects(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"prefix/a.txt", "prefix/sub/b.txt"}, slices.Sorted(maps.Keys(objects)))
+	assert.Equal(t, int64(2), aws.ToInt64(objects["prefix/sub/b.txt"].Size))
+}
+
+func TestSync_Walk(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "sub/b.txt", "manifests/a.txt.s3", "aggregate.json"} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(name), 0755))
+		require.NoError(t, os.WriteFile(name, []byte(name), 0644))
+	}
+
+	c := &Sync{ManifestsDir: filepath.Join(dir, "manifests"), AggregateManifest: filepath.Join(dir, "aggregate.json")}
+	files, err := c.walk(dir)
+	require.NoError(t, err)
+
+	rels := make([]string, 0, len(files))
+	for _, file := range files {
+		rels = append(rels, file.rel)
+	}
+	assert.Equal(t, []string{"a.txt", "sub/b.txt"}, rels)
+
+	// without the flags, everything is synced.
+	files, err = (&Sync{}).walk(dir)
+	require.NoError(t, err)
+	assert.Len(t, files, 4)
+}
+
+func TestSync_DeleteObjects(t *testing.T) {
+	files := []syncFile{{rel: "keep.txt"}}
+	objects := map[string]types.Object{
+		"prefix/keep.txt":   {Key: aws.String("prefix/keep.txt")},
+		"prefix/gone.txt":   {Key: aws.String("prefix/gone.txt")},
+		"prefix/denied.txt": {Key: aws.String("prefix/denied.txt")},
+	}
+	newAggregate := func() *internal.SyncManifest {
+		return &internal.SyncManifest{Files: map[string]internal.Manifest{
+			"keep.txt":   {Key: "prefix/keep.txt"},
+			"gone.txt":   {Key: "prefix/gone.txt"},
+			"denied.txt": {Key: "prefix/denied.txt"},
+		}}
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		client := &fakeSyncClient{}
+		c := &Sync{DryRun: true, bucket: "bucket", prefix: "prefix/", api: client}
+
+		aggregate := newAggregate()
+		deleted, err := c.deleteObjects(t.Context(), files, objects, aggregate)
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+		assert.Empty(t, client.deletes)
+		assert.Len(t, aggregate.Files, 3)
+	})
+
+	t.Run("partial errors", func(t *testing.T) {
+		manifestsDir := t.TempDir()
+		for _, name := range []string{"keep.txt.s3", "gone.txt.s3", "denied.txt.s3"} {
+			require.NoError(t, os.WriteFile(filepath.Join(manifestsDir, name), []byte("{}"), 0644))
+		}
+
+		client := &fakeSyncClient{deleteErrors: map[string]bool{"prefix/denied.txt": true}}
+		c := &Sync{ManifestsDir: manifestsDir, bucket: "bucket", prefix: "prefix/", api: client}
+
+		aggregate := newAggregate()
+		deleted, err := c.deleteObjects(t.Context(), files, objects, aggregate)
+		assert.EqualError(t, err, "failed to delete 1 objects")
+		assert.Equal(t, 1, deleted)
+
+		require.Len(t, client.deletes, 1)
+		assert.Equal(t, []types.ObjectIdentifier{{Key: aws.String("prefix/denied.txt")}, {Key: aws.String("prefix/gone.txt")}}, client.deletes[0].Delete.Objects)
+
+		// only the deleted object has its manifests removed.
+		assert.Equal(t, []string{"denied.txt", "keep.txt"}, slices.Sorted(maps.Keys(aggregate.Files)))
+		assert.NoFileExists(t, filepath.Join(manifestsDir, "gone.txt.s3"))
+		assert.FileExists(t, filepath.Join(manifestsDir, "denied.txt.s3"))
+		assert.FileExists(t, filepath.Join(manifestsDir, "keep.txt.s3"))
+	})
+}
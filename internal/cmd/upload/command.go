@@ -10,6 +10,7 @@ import (
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/jessevdk/go-flags"
 	"github.com/nguyengg/go-aws-commons/s3writer"
 	"github.com/nguyengg/xy3/internal"
@@ -17,16 +18,23 @@ import (
 )
 
 type Command struct {
-	Profile          string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
-	UploadTo         string `short:"u" long:"upload-to" description:"the S3 bucket and prefix in format s3://bucket/prefix to upload the files to; takes precedence over .xy3 setting" value-name:"S3_LOCATION"`
-	Delete           bool   `long:"delete" description:"if specified, delete the original files or directories that were successfully compressed and uploaded."`
-	MaxBytesInSecond int64  `long:"throttle" description:"limits the number of bytes that are uploaded in one second; the zero-value indicates no limit."`
-	Args             struct {
+	Profile           string   `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL       string   `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	UploadTo          string   `short:"u" long:"upload-to" description:"the S3 bucket and prefix in format s3://bucket/prefix to upload the files to; takes precedence over .xy3 setting" value-name:"S3_LOCATION"`
+	Delete            bool     `long:"delete" description:"if specified, delete the original files or directories that were successfully compressed and uploaded."`
+	MaxBytesInSecond  int64    `long:"throttle" description:"limits the number of bytes that are uploaded in one second; the zero-value indicates no limit."`
+	ChecksumAlgorithm string   `long:"checksum-algorithm" description:"the S3 additional checksum algorithm such as SHA256, CRC32C, or CRC64NVME; takes precedence over .xy3 setting"`
+	Digests           []string `long:"digest" description:"the digest algorithm such as sha256, sha384, sha512, or blake3; can be given multiple times with the first being the primary one; takes precedence over .xy3 setting"`
+	Resume            bool     `long:"resume" description:"if specified, save the state of multipart uploads to .s3-upload files next to the files so that failed uploads are kept instead of aborted, and resume the uploads whose state were saved"`
+	Abort             bool     `long:"abort" description:"if specified, abort the interrupted uploads whose state were saved to .s3-upload files next to the files and upload the files again"`
+	TrainDict         bool     `long:"train-dict" description:"if specified, train a zstd dictionary from a sample of each directory's files to compress with; the dictionary is embedded in the archive and its ID is recorded in the manifest"`
+	Args              struct {
 		Files []flags.Filename `positional-arg-name:"file" description:"the local directories to be uploaded to S3 as archives." required:"yes"`
 	} `positional-args:"yes"`
 
 	bucket, prefix string
 	cfg            config.BucketConfig
+	sseKey         *internal.SSECustomerKey
 	client         *s3.Client
 }
 
@@ -39,6 +47,10 @@ func (c *Command) Execute(args []string) (err error) {
 		return fmt.Errorf("--throttle must be non-negative")
 	}
 
+	if c.Resume && c.Abort {
+		return fmt.Errorf("--resume cannot be used with --abort")
+	}
+
 	if c.UploadTo != "" {
 		if c.bucket, c.prefix, err = internal.ParseS3URI(c.UploadTo); err != nil {
 			return fmt.Errorf("invalid --upload-to: %w", err)
@@ -48,7 +60,7 @@ func (c *Command) Execute(args []string) (err error) {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
 	defer stop()
 
-	if _, err = config.LoadProfile(ctx, c.Profile); err != nil {
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
 		return err
 	}
 
@@ -63,6 +75,22 @@ func (c *Command) Execute(args []string) (err error) {
 	}
 
 	c.cfg = config.ForBucket(c.bucket)
+	if c.ChecksumAlgorithm != "" {
+		c.cfg.ChecksumAlgorithm = types.ChecksumAlgorithm(c.ChecksumAlgorithm)
+	}
+	if c.cfg.ChecksumAlgorithm, err = internal.ParseS3ChecksumAlgorithm(string(c.cfg.ChecksumAlgorithm)); err != nil {
+		return err
+	}
+	if len(c.Digests) != 0 {
+		c.cfg.Digests = c.Digests
+	}
+	if c.cfg.Digests, err = internal.ParseDigestAlgorithms(c.cfg.Digests); err != nil {
+		return err
+	}
+	if c.sseKey, err = c.cfg.SSE.CustomerKey(); err != nil {
+		return err
+	}
+
 	c.client, err = config.NewS3ClientForBucket(ctx, c.bucket)
 	if err != nil {
 		return fmt.Errorf("create s3 client error: %w", err)
@@ -97,6 +125,11 @@ func (c *Command) Execute(args []string) (err error) {
 				break
 			}
 
+			if _, statErr := os.Stat(stateFileName(string(file))); statErr == nil {
+				logger.Printf("upload was interrupted; its multipart upload was kept so use --resume to continue or --abort to start over")
+				break
+			}
+
 			logger.Printf("upload was interrupted without having started a multipart upload")
 			break
 		}
@@ -15,34 +15,41 @@ import (
 
 // compressDir creates a new archive and compresses all files recursively starting at root.
 //
-// On success, return the name of the archive as well as additional metadata.
-func (c *Command) compressDir(ctx context.Context, dir string) (name string, contentType *string, size int64, checksum string, err error) {
+// On success, return the name of the archive as well as additional metadata. The returned dictID is non-zero only if
+// a zstd dictionary was trained and used (see Command.TrainDict).
+func (c *Command) compressDir(ctx context.Context, dir string) (name string, contentType *string, size int64, checksum string, dictID uint32, err error) {
 	alg := xy3.DefaultAlgorithmName
 	comp := xy3.NewCompressorFromName(alg)
 	ext := comp.ArchiveExt()
 
+	var dict []byte
+	if c.TrainDict {
+		dict, dictID = xy3.TryTrainDictionary(ctx, dir)
+	}
+
 	f, err := commons.OpenExclFile(".", filepath.Base(dir), ext, 0666)
 	if err != nil {
-		return "", nil, 0, "", fmt.Errorf("create archive error: %w", err)
+		return "", nil, 0, "", 0, fmt.Errorf("create archive error: %w", err)
 	}
 	defer f.Close()
 
 	var (
 		sizer       = &commons.Sizer{}
-		checksummer = internal.DefaultChecksum()
+		checksummer = internal.NewDigest(c.cfg.Digests[0])
 	)
 
 	if err = xy3.CompressDir(ctx, dir, io.MultiWriter(f, sizer, checksummer), func(opts *xy3.CompressOptions) {
 		opts.Algorithm = alg
+		opts.ZstdDictionary = dict
 	}); err != nil {
 		_, _ = f.Close(), os.Remove(f.Name())
-		return "", nil, 0, "", err
+		return "", nil, 0, "", 0, err
 	}
 
 	if err = f.Close(); err != nil {
 		_ = os.Remove(f.Name())
-		return "", nil, 0, "", fmt.Errorf("close archive error: %w", err)
+		return "", nil, 0, "", 0, fmt.Errorf("close archive error: %w", err)
 	}
 
-	return f.Name(), aws.String(comp.ContentType()), sizer.Size, checksummer.SumToString(nil), nil
+	return f.Name(), aws.String(comp.ContentType()), sizer.Size, checksummer.SumToString(nil), dictID, nil
 }
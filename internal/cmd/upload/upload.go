@@ -2,16 +2,19 @@ package upload
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/s3writer"
 	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
 )
 
@@ -26,10 +29,36 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 		contentType *string
 		size        int64
 		checksum    string
+		dictID      uint32
 		stem, ext   string
 		success     bool
 	)
 
+	// with --resume, the state of the multipart upload is saved next to name so that it can be resumed if it fails.
+	stateFile := stateFileName(name)
+	var state *internal.UploadState
+	if _, err = os.Stat(stateFile); err == nil {
+		if !c.Resume && !c.Abort {
+			return fmt.Errorf(`upload state "%s" exists; use --resume to continue the upload or --abort to start over`, stateFile)
+		}
+
+		s, err := internal.LoadUploadStateFromFile(stateFile)
+		if err != nil {
+			return err
+		}
+
+		if c.Abort {
+			if err = c.abort(ctx, stateFile, s); err != nil {
+				return err
+			}
+
+			logger.Printf(`aborted upload from "%s"`, stateFile)
+		} else {
+			state = &s
+			logger.Printf(`resuming upload from "%s"`, stateFile)
+		}
+	}
+
 	// name can either be a file or a directory, so use stat to determine what to do.
 	// if it's a directory, compress it and the resulting archive will be deleted upon return.
 	switch fi, err = os.Stat(name); {
@@ -38,8 +67,27 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 
 	case fi.IsDir():
 		var archiveName string
-		archiveName, contentType, size, checksum, err = c.compressDir(ctx, name)
-		if err != nil {
+		if state != nil && !canReuseArchive(*state) {
+			// the archive was deleted or modified so the directory is compressed again.
+			if err = c.abort(ctx, stateFile, *state); err != nil {
+				return err
+			}
+
+			logger.Printf(`aborted upload from "%s" because its archive "%s" has changed`, stateFile, state.Source.Name)
+			state = nil
+		}
+
+		if state != nil {
+			// the archive from the interrupted upload is reused since compressing again may not produce the same
+			// bytes.
+			archiveName, checksum = state.Source.Name, state.Checksum
+			if a := state.Archive; a != nil {
+				size, dictID = a.Size, a.ZstdDictionaryID
+				if a.ContentType != "" {
+					contentType = aws.String(a.ContentType)
+				}
+			}
+		} else if archiveName, contentType, size, checksum, dictID, err = c.compressDir(ctx, name); err != nil {
 			return fmt.Errorf(`compress directory "%s" error: %w`, name, err)
 		}
 
@@ -100,6 +148,28 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 		stem, ext = commons.StemExt(name)
 	}
 
+	// if the bucket has age recipients configured, the contents are encrypted on the fly and the key gets the ".age"
+	// extension so that download knows to decrypt.
+	var (
+		encrypter  codec.Codec
+		encryption *internal.Encryption
+	)
+	if c.cfg.Age.CanEncrypt() {
+		recipients, err := c.cfg.Age.ParseRecipients()
+		if err != nil {
+			return err
+		}
+
+		encrypter = codec.AgeCodec{Recipients: recipients}
+		encryption = &internal.Encryption{Scheme: codec.AgeScheme}
+		for _, r := range recipients {
+			encryption.Recipients = append(encryption.Recipients, codec.AgeFingerprint(r))
+		}
+
+		ext += encrypter.Ext()
+		contentType = aws.String(encrypter.ContentType())
+	}
+
 	// we used to pick a "unique" S3 key as well, but with bucket versioning enabled, that is no longer needed.
 	key := c.prefix + stem + ext
 
@@ -120,10 +190,24 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 				input.ContentType = contentType
 				input.ExpectedBucketOwner = c.cfg.ExpectedBucketOwner
 				input.StorageClass = c.cfg.StorageClass
+				c.cfg.SSE.ApplyToPutObject(input, c.sseKey)
 			}
 
+			uploadOpts.ChecksumAlgorithm = c.cfg.ChecksumAlgorithm
+			uploadOpts.Digests = c.cfg.Digests
 			uploadOpts.ExpectedChecksum = checksum
 			uploadOpts.ExpectedSize = size
+			uploadOpts.Encrypter = encrypter
+			if c.Resume {
+				uploadOpts.StateFile = stateFile
+			}
+			if fi.IsDir() {
+				uploadOpts.StateArchive = &internal.UploadArchive{
+					ContentType:      aws.ToString(contentType),
+					Size:             size,
+					ZstdDictionaryID: dictID,
+				}
+			}
 		})
 	if err != nil {
 		return fmt.Errorf("upload error: %w", err)
@@ -131,6 +215,9 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 
 	logger.Printf("done uploading")
 
+	man.ZstdDictionaryID = dictID
+	man.Encryption = encryption
+
 	// now generate the local .s3 file that contains the S3 URI. if writing to file fails, prints the JSON content
 	// to standard output so that they can be saved manually later.
 	mf, err := commons.OpenExclFile(".", stem, ext+".s3", 0666)
@@ -149,3 +236,40 @@ func (c *Command) upload(ctx context.Context, name string) (err error) {
 	success = true
 	return nil
 }
+
+// stateFileName returns the name of the file next to the given file or directory that saves the state of its multipart
+// upload.
+//
+// Files with the same base name in different directories have their own state files.
+func stateFileName(name string) string {
+	return filepath.Clean(name) + ".s3-upload"
+}
+
+// abort aborts the multipart upload of the given upload state, and deletes the archive that was compressed for it.
+func (c *Command) abort(ctx context.Context, stateFile string, state internal.UploadState) error {
+	if err := xy3.AbortUpload(ctx, c.client, stateFile, func(input *s3.AbortMultipartUploadInput) {
+		input.ExpectedBucketOwner = c.cfg.ExpectedBucketOwner
+	}); err != nil {
+		return fmt.Errorf(`abort upload from "%s" error: %w`, stateFile, err)
+	}
+
+	if state.Archive != nil {
+		if err := os.Remove(state.Source.Name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf(`delete archive "%s" error: %w`, state.Source.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// canReuseArchive returns true if the archive of the given upload state has not changed since the upload started.
+func canReuseArchive(state internal.UploadState) bool {
+	f, err := os.Open(state.Source.Name)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	source, err := internal.NewUploadSource(f)
+	return err == nil && source.Equal(state.Source)
+}
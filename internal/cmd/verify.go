@@ -0,0 +1,240 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jessevdk/go-flags"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Verify struct {
+	Profile     string `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL string `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Deep        bool   `long:"deep" description:"if specified, download each object to compute its checksums instead of only comparing its metadata"`
+	Concurrency int    `long:"concurrency" default:"4" description:"the number of manifests that are verified at the same time"`
+	JSON        bool   `long:"json" description:"if specified, print the report as JSON to stdout"`
+	Args        struct {
+		Files []flags.Filename `positional-arg-name:"file" description:"the local .s3 files, or local directories to find .s3 files (including those in subdirectories) in" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+// verifyReport groups the manifests by the outcome of their verification.
+type verifyReport struct {
+	Verified     []string        `json:"verified"`
+	Missing      []verifyProblem `json:"missing"`
+	Mismatched   []verifyProblem `json:"mismatched"`
+	Unverifiable []verifyProblem `json:"unverifiable"`
+	Failed       []verifyProblem `json:"failed"`
+}
+
+// verifyProblem is a manifest that could not be verified.
+type verifyProblem struct {
+	Manifest string `json:"manifest"`
+	S3URI    string `json:"s3Uri,omitempty"`
+	Error    string `json:"error"`
+}
+
+func (c *Verify) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if c.Concurrency <= 0 {
+		return fmt.Errorf("--concurrency must be positive")
+	}
+
+	var names []string
+	for _, file := range c.Args.Files {
+		fi, err := os.Stat(string(file))
+		if err != nil {
+			return fmt.Errorf(`stat file "%s" error: %w`, file, err)
+		}
+
+		if !fi.IsDir() {
+			names = append(names, string(file))
+			continue
+		}
+
+		manifests, err := findLocalManifests(string(file))
+		if err != nil {
+			return err
+		}
+		for _, ms := range manifests {
+			for _, m := range ms {
+				names = append(names, m.name)
+			}
+		}
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	var (
+		report  = verifyReport{Verified: make([]string, 0), Missing: make([]verifyProblem, 0), Mismatched: make([]verifyProblem, 0), Unverifiable: make([]verifyProblem, 0), Failed: make([]verifyProblem, 0)}
+		clients = &s3ClientCache{clients: make(map[string]*s3.Client)}
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		sem     = make(chan struct{}, c.Concurrency)
+		n       = len(names)
+	)
+
+	for i, name := range names {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			ctx := internal.WithPrefixLogger(ctx, internal.Prefix(i+1, n, flags.Filename(name)))
+			s3Uri, err := c.verify(ctx, clients, name)
+			if errors.Is(err, context.Canceled) {
+				return
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err == nil {
+				internal.MustLogger(ctx).Printf("verified")
+				report.Verified = append(report.Verified, name)
+				return
+			}
+
+			internal.MustLogger(ctx).Printf("verify error: %v", err)
+			p := verifyProblem{Manifest: name, S3URI: s3Uri, Error: err.Error()}
+			if _, ok := xy3.IsErrChecksumMismatch(err); ok || errors.Is(err, xy3.ErrObjectChanged) {
+				report.Mismatched = append(report.Mismatched, p)
+			} else if errors.Is(err, xy3.ErrObjectNotFound) {
+				report.Missing = append(report.Missing, p)
+			} else if errors.Is(err, xy3.ErrUnverifiable) {
+				report.Unverifiable = append(report.Unverifiable, p)
+			} else {
+				report.Failed = append(report.Failed, p)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if err = ctx.Err(); err != nil {
+		return nil
+	}
+
+	// the goroutines finish in any order.
+	slices.Sort(report.Verified)
+	for _, ps := range [][]verifyProblem{report.Missing, report.Mismatched, report.Unverifiable, report.Failed} {
+		slices.SortFunc(ps, func(a, b verifyProblem) int {
+			return strings.Compare(a.Manifest, b.Manifest)
+		})
+	}
+
+	if c.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err = enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		for _, section := range []struct {
+			title    string
+			problems []verifyProblem
+		}{
+			{"missing", report.Missing},
+			{"mismatched", report.Mismatched},
+			{"unverifiable", report.Unverifiable},
+			{"failed", report.Failed},
+		} {
+			if len(section.problems) == 0 {
+				continue
+			}
+
+			fmt.Printf("%s (%d):\n", section.title, len(section.problems))
+			for _, p := range section.problems {
+				fmt.Printf("\t%s (%s): %s\n", p.Manifest, p.S3URI, p.Error)
+			}
+		}
+	}
+
+	log.Printf("%d verified, %d missing, %d mismatched, %d unverifiable, %d failed", len(report.Verified), len(report.Missing), len(report.Mismatched), len(report.Unverifiable), len(report.Failed))
+	if len(report.Verified) != n {
+		return fmt.Errorf("%d/%d manifests did not pass verification", n-len(report.Verified), n)
+	}
+
+	return nil
+}
+
+// verify verifies a single manifest, returning its S3 URI for the report.
+func (c *Verify) verify(ctx context.Context, clients *s3ClientCache, name string) (string, error) {
+	man, err := internal.LoadManifestFromFile(name)
+	if err != nil {
+		return "", fmt.Errorf("read manifest error: %w", err)
+	}
+
+	s3Uri := fmt.Sprintf("s3://%s/%s", man.Bucket, man.Key)
+
+	cfg := config.ForBucket(man.Bucket)
+	sseKey, err := cfg.SSE.CustomerKeyForManifest(man)
+	if err != nil {
+		return s3Uri, err
+	}
+
+	client, err := clients.get(ctx, man.Bucket)
+	if err != nil {
+		return s3Uri, err
+	}
+
+	return s3Uri, xy3.Verify(ctx, client, man, func(opts *xy3.VerifyOptions) {
+		opts.Deep = c.Deep
+		opts.DownloadOptions = append(opts.DownloadOptions, xy3.WithExpectedBucketOwner(internal.FirstNonNilPtr(man.ExpectedBucketOwner, cfg.ExpectedBucketOwner)))
+		if sseKey != nil {
+			opts.DownloadOptions = append(opts.DownloadOptions, xy3.WithSSECustomerKey(sseKey.Key, sseKey.KeyMD5))
+		}
+	})
+}
+
+// s3ClientCache creates at most one S3 client per bucket for concurrent use.
+type s3ClientCache struct {
+	mu      sync.Mutex
+	clients map[string]*s3.Client
+}
+
+func (c *s3ClientCache) get(ctx context.Context, bucket string) (*s3.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[bucket]; ok {
+		return client, nil
+	}
+
+	client, err := config.NewS3ClientForBucket(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	c.clients[bucket] = client
+	return client, nil
+}
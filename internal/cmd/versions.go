@@ -0,0 +1,303 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/dustin/go-humanize"
+	"github.com/jessevdk/go-flags"
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/xy3"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/nguyengg/xy3/internal/config"
+)
+
+type Versions struct {
+	Profile     string   `long:"profile" description:"the AWS profile to use; takes precedence over .xy3 setting"`
+	EndpointURL string   `long:"endpoint-url" description:"the custom S3 endpoint URL (e.g. for MinIO); takes precedence over .xy3 setting"`
+	Restore     string   `long:"restore" value-name:"VERSION_ID" description:"if specified, copy the given version over the object so that it becomes the latest version; a .s3 file argument is updated to point to the new version"`
+	Manifests   []string `long:"manifest" value-name:"VERSION_ID" description:"if specified, create a local .s3 file for the given version; can be given multiple times"`
+	Args        struct {
+		Files []flags.Filename `positional-arg-name:"file" description:"the local .s3 files or S3 URIs in format s3://bucket/key whose versions are listed" required:"yes"`
+	} `positional-args:"yes"`
+}
+
+func (c *Versions) Execute(args []string) (err error) {
+	if len(args) != 0 {
+		return fmt.Errorf("unknown positional arguments: %s", strings.Join(args, " "))
+	}
+
+	if (c.Restore != "" || len(c.Manifests) != 0) && len(c.Args.Files) != 1 {
+		return fmt.Errorf("--restore and --manifest require exactly one file")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	defer stop()
+
+	if _, err = config.LoadProfileAndEndpoint(ctx, c.Profile, c.EndpointURL); err != nil {
+		return err
+	}
+
+	for _, file := range c.Args.Files {
+		ctx := internal.WithPrefixLogger(ctx, string(file))
+
+		if err = c.versions(ctx, string(file)); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+
+			return fmt.Errorf(`versions of "%s" error: %w`, file, err)
+		}
+	}
+
+	return nil
+}
+
+// versionsTarget is the object whose versions are being listed.
+type versionsTarget struct {
+	man          internal.Manifest
+	manifestName string
+	cfg          config.BucketConfig
+	sseKey       *internal.SSECustomerKey
+	client       *s3.Client
+}
+
+func (c *Versions) versions(ctx context.Context, name string) (err error) {
+	t := &versionsTarget{}
+
+	if strings.HasPrefix(name, "s3://") {
+		if t.man.Bucket, t.man.Key, err = internal.ParseS3URI(name); err != nil {
+			return fmt.Errorf(`invalid s3 URI "%s": %w`, name, err)
+		}
+		if t.man.Key == "" {
+			return fmt.Errorf(`s3 URI "%s" has no key`, name)
+		}
+
+		t.cfg = config.ForBucket(t.man.Bucket)
+		if t.sseKey, err = t.cfg.SSE.CustomerKey(); err != nil {
+			return err
+		}
+	} else {
+		if t.man, err = internal.LoadManifestFromFile(name); err != nil {
+			return fmt.Errorf("read manifest error: %w", err)
+		}
+		t.manifestName = name
+
+		t.cfg = config.ForBucket(t.man.Bucket)
+		if t.sseKey, err = t.cfg.SSE.CustomerKeyForManifest(t.man); err != nil {
+			return err
+		}
+	}
+
+	if t.client, err = config.NewS3ClientForBucket(ctx, t.man.Bucket); err != nil {
+		return fmt.Errorf("create s3 client error: %w", err)
+	}
+
+	switch {
+	case c.Restore != "":
+		return c.restore(ctx, t, c.Restore)
+	case len(c.Manifests) != 0:
+		for _, versionID := range c.Manifests {
+			if err = c.createManifest(ctx, t, versionID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	default:
+		return c.list(ctx, t)
+	}
+}
+
+// list prints the versions and delete markers of the object from newest to oldest.
+func (c *Versions) list(ctx context.Context, t *versionsTarget) error {
+	type version struct {
+		id           string
+		lastModified time.Time
+		size         int64
+		latest       bool
+		deleteMarker bool
+	}
+
+	var versions []version
+	for paginator := s3.NewListObjectVersionsPaginator(t.client, &s3.ListObjectVersionsInput{
+		Bucket:              aws.String(t.man.Bucket),
+		Prefix:              aws.String(t.man.Key),
+		ExpectedBucketOwner: internal.FirstNonNilPtr(t.man.ExpectedBucketOwner, t.cfg.ExpectedBucketOwner),
+	}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("list object versions error: %w", err)
+		}
+
+		// other keys may share the same prefix.
+		for _, v := range page.Versions {
+			if aws.ToString(v.Key) == t.man.Key {
+				versions = append(versions, version{
+					id:           aws.ToString(v.VersionId),
+					lastModified: aws.ToTime(v.LastModified),
+					size:         aws.ToInt64(v.Size),
+					latest:       aws.ToBool(v.IsLatest),
+				})
+			}
+		}
+		for _, m := range page.DeleteMarkers {
+			if aws.ToString(m.Key) == t.man.Key {
+				versions = append(versions, version{
+					id:           aws.ToString(m.VersionId),
+					lastModified: aws.ToTime(m.LastModified),
+					latest:       aws.ToBool(m.IsLatest),
+					deleteMarker: true,
+				})
+			}
+		}
+	}
+
+	if len(versions) == 0 {
+		log.Printf(`"s3://%s/%s" has no versions`, t.man.Bucket, t.man.Key)
+		return nil
+	}
+
+	// versions of the same key are listed newest first, but delete markers are listed separately.
+	slices.SortStableFunc(versions, func(a, b version) int {
+		return b.lastModified.Compare(a.lastModified)
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, v := range versions {
+		var notes []string
+		if v.latest {
+			notes = append(notes, "latest")
+		}
+		if v.deleteMarker {
+			notes = append(notes, "delete marker")
+		}
+		if t.man.VersionID != nil && *t.man.VersionID == v.id {
+			notes = append(notes, "manifest")
+		}
+
+		size := "-"
+		if !v.deleteMarker {
+			size = humanize.IBytes(uint64(v.size))
+		}
+
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", v.id, v.lastModified.Local().Format(time.DateTime), size, strings.Join(notes, ", "))
+	}
+
+	return w.Flush()
+}
+
+// headVersion returns the HeadObject response of the given version.
+func (c *Versions) headVersion(ctx context.Context, t *versionsTarget, versionID string) (*s3.HeadObjectOutput, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:              aws.String(t.man.Bucket),
+		Key:                 aws.String(t.man.Key),
+		VersionId:           aws.String(versionID),
+		ExpectedBucketOwner: internal.FirstNonNilPtr(t.man.ExpectedBucketOwner, t.cfg.ExpectedBucketOwner),
+		ChecksumMode:        types.ChecksumModeEnabled,
+	}
+	input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = t.sseKey.Headers()
+
+	output, err := t.client.HeadObject(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf(`get metadata about version "%s" error: %w`, versionID, err)
+	}
+
+	return output, nil
+}
+
+// restore copies the given version over the object so that it becomes the latest version.
+//
+// The new version keeps the storage class, encryption, and checksum algorithm of the restored version.
+func (c *Versions) restore(ctx context.Context, t *versionsTarget, versionID string) error {
+	logger := internal.MustLogger(ctx)
+
+	// the restored version's size and ETag are not known, and its digests are copied from its checksum metadata.
+	src := internal.Manifest{
+		Bucket:              t.man.Bucket,
+		Key:                 t.man.Key,
+		VersionID:           aws.String(versionID),
+		ExpectedBucketOwner: t.man.ExpectedBucketOwner,
+		Encryption:          t.man.Encryption,
+	}
+	expectedBucketOwner := internal.FirstNonNilPtr(t.man.ExpectedBucketOwner, t.cfg.ExpectedBucketOwner)
+
+	man, err := xy3.Copy(ctx, t.client, src, t.man.Bucket, t.man.Key, func(opts *xy3.CopyOptions) {
+		opts.ExpectedSourceBucketOwner, opts.ExpectedBucketOwner = expectedBucketOwner, expectedBucketOwner
+		opts.SourceSSECustomerKey, opts.SSECustomerKey = t.sseKey, t.sseKey
+	})
+	if err != nil {
+		if errors.Is(err, xy3.ErrObjectNotRestored) {
+			logger.Printf(`use "xy3 restore" to restore the version first`)
+		}
+
+		return fmt.Errorf(`restore version "%s" error: %w`, versionID, err)
+	}
+
+	logger.Printf(`restored version "%s" as new version "%s"`, versionID, aws.ToString(man.VersionID))
+
+	if t.manifestName == "" {
+		return nil
+	}
+
+	// the manifest is updated to point to the new version, whose contents are the same as the restored version.
+	man.ExpectedBucketOwner = t.man.ExpectedBucketOwner
+
+	f, err := os.OpenFile(t.manifestName, os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf(`open manifest file "%s" error: %w`, t.manifestName, err)
+	}
+
+	if err, _ = man.SaveTo(f), f.Close(); err != nil {
+		_ = man.SaveTo(os.Stdout)
+		return fmt.Errorf(`write manifest to "%s" error: %w`, t.manifestName, err)
+	}
+
+	logger.Printf(`updated manifest "%s"`, t.manifestName)
+	return nil
+}
+
+// createManifest creates a new local .s3 file for the given version.
+func (c *Versions) createManifest(ctx context.Context, t *versionsTarget, versionID string) error {
+	logger := internal.MustLogger(ctx)
+
+	head, err := c.headVersion(ctx, t, versionID)
+	if err != nil {
+		return err
+	}
+
+	man := internal.NewManifestFromHeadObject(t.man.Bucket, t.man.Key, t.man.ExpectedBucketOwner, head)
+	man.Encryption = t.man.Encryption
+
+	stem, ext := commons.StemExt(path.Base(t.man.Key))
+	f, err := commons.OpenExclFile(filepath.Dir(t.manifestName), stem, ext+".s3", 0666)
+	if err != nil {
+		return fmt.Errorf("create manifest file error: %w", err)
+	}
+	name := f.Name()
+
+	if err, _ = man.SaveTo(f), f.Close(); err != nil {
+		return fmt.Errorf(`write manifest to "%s" error: %w`, name, err)
+	}
+
+	if err = os.Chtimes(name, time.Time{}, aws.ToTime(head.LastModified)); err != nil {
+		logger.Printf(`wrote "%s" for version "%s"; change modify time error: %v`, name, versionID, err)
+	} else {
+		logger.Printf(`wrote "%s" for version "%s"`, name, versionID)
+	}
+
+	return nil
+}
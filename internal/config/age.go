@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+)
+
+// AgeConfig contains the per-bucket settings for client-side encryption with age.
+//
+// Example .xy3 section:
+//
+//	[s3://my-bucket]
+//	age-recipients = age1ql3z7hjy54pw3hyww5ayyfg7zqgvc7w3j2elw8zmrj2kg5sfn9aqmcac8p
+//	age-identity-file = ~/.xy3-age-key.txt
+//
+// Encryption is enabled for uploads if any recipient is configured, and for downloads of encrypted objects if an
+// identity file or a passphrase is configured.
+type AgeConfig struct {
+	// Recipients are the X25519 recipients (comma-separated "age1..." public keys) to encrypt to.
+	Recipients []string
+	// RecipientsFile is the name of a file listing recipients, one per line, in the format accepted by `age -R`.
+	RecipientsFile string
+	// IdentityFile is the name of a file of identities, in the format accepted by `age -i`, to decrypt with.
+	IdentityFile string
+	// PassphraseEnv is the name of the environment variable whose value is the passphrase to encrypt and decrypt with.
+	//
+	// A passphrase cannot be used together with other recipients.
+	PassphraseEnv string
+}
+
+// CanEncrypt returns true if there are recipients to encrypt to.
+func (c AgeConfig) CanEncrypt() bool {
+	return len(c.Recipients) != 0 || c.RecipientsFile != "" || c.PassphraseEnv != ""
+}
+
+// CanDecrypt returns true if there are identities to decrypt with.
+func (c AgeConfig) CanDecrypt() bool {
+	return c.IdentityFile != "" || c.PassphraseEnv != ""
+}
+
+// ParseRecipients returns the configured recipients.
+func (c AgeConfig) ParseRecipients() ([]age.Recipient, error) {
+	recipients := make([]age.Recipient, 0, len(c.Recipients))
+	for _, v := range c.Recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(v))
+		if err != nil {
+			return nil, fmt.Errorf(`parse age recipient "%s" error: %w`, v, err)
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	if c.RecipientsFile != "" {
+		f, err := os.Open(expandHome(c.RecipientsFile))
+		if err != nil {
+			return nil, fmt.Errorf(`open age recipients file "%s" error: %w`, c.RecipientsFile, err)
+		}
+		defer f.Close()
+
+		rs, err := age.ParseRecipients(f)
+		if err != nil {
+			return nil, fmt.Errorf(`parse age recipients file "%s" error: %w`, c.RecipientsFile, err)
+		}
+
+		recipients = append(recipients, rs...)
+	}
+
+	if c.PassphraseEnv != "" {
+		if len(recipients) != 0 {
+			return nil, errors.New("age passphrase cannot be used with other recipients")
+		}
+
+		passphrase, err := c.passphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		r, err := age.NewScryptRecipient(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("create age scrypt recipient error: %w", err)
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// ParseIdentities returns the configured identities.
+func (c AgeConfig) ParseIdentities() ([]age.Identity, error) {
+	identities := make([]age.Identity, 0)
+
+	if c.IdentityFile != "" {
+		f, err := os.Open(expandHome(c.IdentityFile))
+		if err != nil {
+			return nil, fmt.Errorf(`open age identity file "%s" error: %w`, c.IdentityFile, err)
+		}
+		defer f.Close()
+
+		ids, err := age.ParseIdentities(f)
+		if err != nil {
+			return nil, fmt.Errorf(`parse age identity file "%s" error: %w`, c.IdentityFile, err)
+		}
+
+		identities = append(identities, ids...)
+	}
+
+	if c.PassphraseEnv != "" {
+		passphrase, err := c.passphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		id, err := age.NewScryptIdentity(passphrase)
+		if err != nil {
+			return nil, fmt.Errorf("create age scrypt identity error: %w", err)
+		}
+
+		identities = append(identities, id)
+	}
+
+	return identities, nil
+}
+
+func (c AgeConfig) passphrase() (string, error) {
+	passphrase := os.Getenv(c.PassphraseEnv)
+	if passphrase == "" {
+		return "", fmt.Errorf(`age passphrase environment variable "%s" is empty`, c.PassphraseEnv)
+	}
+
+	return passphrase, nil
+}
+
+// expandHome replaces the leading "~/" with the user's home directory.
+func expandHome(name string) string {
+	if rest, ok := strings.CutPrefix(name, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+
+	return name
+}
@@ -35,6 +35,21 @@ type BucketConfig struct {
 	AWSProfile          string
 	ExpectedBucketOwner *string
 	StorageClass        types.StorageClass
+
+	// ChecksumAlgorithm is the S3 additional checksum algorithm for uploads such as SHA256, CRC32C, or CRC64NVME.
+	ChecksumAlgorithm types.ChecksumAlgorithm
+
+	// Digests are the digest algorithms for uploads such as sha256, sha384, sha512, or blake3; the first is primary.
+	Digests []string
+
+	// SSE contains settings for server-side encryption.
+	SSE SSEConfig
+
+	// Age contains settings for client-side encryption with age.
+	Age AgeConfig
+
+	// Endpoint contains settings for S3-compatible stores.
+	Endpoint EndpointConfig
 }
 
 // ForBucket returns configuration for a specific bucket.
@@ -54,6 +69,34 @@ func (l *Loader) ForBucket(bucket string) (c BucketConfig) {
 	if k := sec.Key("storage-class"); k != nil {
 		c.StorageClass = types.StorageClass(k.Value())
 	}
+	c.ChecksumAlgorithm = types.ChecksumAlgorithm(sec.Key("checksum-algorithm").Value())
+	c.Digests = sec.Key("digests").Strings(",")
+
+	c.SSE = SSEConfig{
+		ServerSideEncryption: types.ServerSideEncryption(sec.Key("sse").Value()),
+		KMSKeyID:             sec.Key("sse-kms-key-id").Value(),
+		CustomerKeyFile:      sec.Key("sse-customer-key-file").Value(),
+		CustomerKeyEnv:       sec.Key("sse-customer-key-env").Value(),
+	}
+	if k := sec.Key("bucket-key-enabled"); k.Value() != "" {
+		c.SSE.BucketKeyEnabled = aws.Bool(k.MustBool())
+	}
+
+	c.Age = AgeConfig{
+		Recipients:     sec.Key("age-recipients").Strings(","),
+		RecipientsFile: sec.Key("age-recipients-file").Value(),
+		IdentityFile:   sec.Key("age-identity-file").Value(),
+		PassphraseEnv:  sec.Key("age-passphrase-env").Value(),
+	}
+
+	c.Endpoint = EndpointConfig{
+		URL:           sec.Key("endpoint").Value(),
+		Region:        sec.Key("region").Value(),
+		UsePathStyle:  sec.Key("use-path-style").MustBool(),
+		DisableHTTPS:  sec.Key("disable-https").MustBool(),
+		UseAccelerate: sec.Key("accelerate").MustBool(),
+		UseDualStack:  sec.Key("dual-stack").MustBool(),
+	}
 
 	return
 }
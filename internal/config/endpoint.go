@@ -0,0 +1,58 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// EndpointConfig contains settings for S3-compatible stores such as MinIO or Ceph RGW.
+type EndpointConfig struct {
+	// URL is the custom endpoint URL; "http://" or "https://" is prepended if no scheme is given.
+	URL string
+	// Region overrides the region from the AWS profile.
+	Region string
+	// UsePathStyle addresses buckets with path-style URLs instead of virtual-hosted-style URLs.
+	UsePathStyle bool
+	// DisableHTTPS uses http instead of https.
+	DisableHTTPS bool
+	// UseAccelerate enables S3 Transfer Acceleration.
+	UseAccelerate bool
+	// UseDualStack enables the dual-stack (IPv4 and IPv6) endpoints.
+	UseDualStack bool
+}
+
+// defaultEndpointRegion is used when a custom endpoint is given without a region, since most S3-compatible stores
+// don't care about the region but the SDK requires one for signing.
+const defaultEndpointRegion = "us-east-1"
+
+// ApplyToS3Options modifies the given s3.Options with the settings.
+func (c EndpointConfig) ApplyToS3Options(opts *s3.Options) {
+	if c.Region != "" {
+		opts.Region = c.Region
+	}
+
+	if c.URL != "" {
+		url := c.URL
+		if !strings.Contains(url, "://") {
+			if c.DisableHTTPS {
+				url = "http://" + url
+			} else {
+				url = "https://" + url
+			}
+		}
+
+		opts.BaseEndpoint = aws.String(url)
+		if opts.Region == "" {
+			opts.Region = defaultEndpointRegion
+		}
+	}
+
+	opts.UsePathStyle = opts.UsePathStyle || c.UsePathStyle
+	opts.EndpointOptions.DisableHTTPS = opts.EndpointOptions.DisableHTTPS || c.DisableHTTPS
+	opts.UseAccelerate = opts.UseAccelerate || c.UseAccelerate
+	if c.UseDualStack {
+		opts.EndpointOptions.UseDualStackEndpoint = aws.DualStackEndpointStateEnabled
+	}
+}
@@ -13,6 +13,8 @@ import (
 type Loader struct {
 	// Profile is the AWS profile to use, taking precedence over bucket-based AWS profile setting.
 	Profile string
+	// EndpointURL is the custom S3 endpoint URL to use, taking precedence over bucket-based endpoint setting.
+	EndpointURL string
 
 	cfg           *ini.File
 	s3clientCache sync.Map
@@ -79,6 +81,12 @@ func (l *Loader) LoadProfile(ctx context.Context, profile string) (string, error
 	return l.Load(ctx)
 }
 
+// LoadProfileAndEndpoint is a convenient method to set Loader.Profile and Loader.EndpointURL then call Load.
+func (l *Loader) LoadProfileAndEndpoint(ctx context.Context, profile, endpointURL string) (string, error) {
+	l.EndpointURL = endpointURL
+	return l.LoadProfile(ctx, profile)
+}
+
 // DefaultLoader is the default Loader instance for package-level methods.
 var DefaultLoader = &Loader{cfg: ini.Empty()}
 
@@ -91,3 +99,8 @@ func Load(ctx context.Context) (string, error) {
 func LoadProfile(ctx context.Context, profile string) (string, error) {
 	return DefaultLoader.LoadProfile(ctx, profile)
 }
+
+// LoadProfileAndEndpoint calls Loader.LoadProfileAndEndpoint on the DefaultLoader instance.
+func LoadProfileAndEndpoint(ctx context.Context, profile, endpointURL string) (string, error) {
+	return DefaultLoader.LoadProfileAndEndpoint(ctx, profile, endpointURL)
+}
@@ -17,7 +17,7 @@ func (l *Loader) NewS3Client(ctx context.Context, optFns ...func(*s3.Options)) (
 		return nil, err
 	}
 
-	c := s3.NewFromConfig(cfg, optFns...)
+	c := s3.NewFromConfig(cfg, append([]func(*s3.Options){EndpointConfig{URL: l.EndpointURL}.ApplyToS3Options}, optFns...)...)
 	l.s3clientCache.Store("s3", c)
 	return c, nil
 }
@@ -32,23 +32,29 @@ func (l *Loader) NewS3ClientForBucket(ctx context.Context, bucket string, optFns
 		return c.(*s3.Client), nil
 	}
 
+	bucketCfg := l.ForBucket(bucket)
 	cfg, err := config.LoadDefaultConfig(ctx, func(opts *config.LoadOptions) error {
 		if l.Profile != "" {
 			opts.SharedConfigProfile = l.Profile
 			return nil
 		}
 
-		opts.SharedConfigProfile = l.ForBucket(bucket).AWSProfile
+		opts.SharedConfigProfile = bucketCfg.AWSProfile
 		return nil
 	})
 	if err != nil {
 		return nil, err
 	}
 
-	c := s3.NewFromConfig(cfg, optFns...)
+	// --endpoint-url takes precedence over the bucket's endpoint.
+	endpoint := bucketCfg.Endpoint
+	if l.EndpointURL != "" {
+		endpoint.URL = l.EndpointURL
+	}
+
+	c := s3.NewFromConfig(cfg, append([]func(*s3.Options){endpoint.ApplyToS3Options}, optFns...)...)
 	l.s3clientCache.Store(key, c)
 	return c, nil
-
 }
 
 func NewS3ClientForBucket(ctx context.Context, bucket string, optFns ...func(*s3.Options)) (*s3.Client, error) {
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/go-ini/ini"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoader_NewS3ClientForBucket(t *testing.T) {
+	// the shared config files must not interfere with the region.
+	dir := t.TempDir()
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "")
+	t.Setenv("AWS_ENDPOINT_URL", "")
+	t.Setenv("AWS_ENDPOINT_URL_S3", "")
+
+	const xy3 = `
+[s3://minio]
+endpoint = localhost:9000
+disable-https = true
+use-path-style = true
+
+[s3://ceph]
+endpoint = ceph.example.com
+region = eu-central-1
+
+[s3://scheme]
+endpoint = http://store.example.com:8080
+
+[s3://aws]
+region = us-west-2
+accelerate = true
+dual-stack = true
+`
+
+	tests := []struct {
+		name             string
+		bucket           string
+		endpointURL      string
+		wantEndpoint     *string
+		wantRegion       string
+		wantPathStyle    bool
+		wantDisableHTTPS bool
+		wantAccelerate   bool
+		wantDualStack    aws.DualStackEndpointState
+	}{
+		{
+			name:             "missing scheme with disable-https",
+			bucket:           "minio",
+			wantEndpoint:     aws.String("http://localhost:9000"),
+			wantRegion:       "us-east-1",
+			wantPathStyle:    true,
+			wantDisableHTTPS: true,
+		},
+		{
+			name:         "missing scheme defaults to https",
+			bucket:       "ceph",
+			wantEndpoint: aws.String("https://ceph.example.com"),
+			wantRegion:   "eu-central-1",
+		},
+		{
+			name:         "scheme is kept",
+			bucket:       "scheme",
+			wantEndpoint: aws.String("http://store.example.com:8080"),
+			wantRegion:   "us-east-1",
+		},
+		{
+			name:             "--endpoint-url overrides endpoint but keeps use-path-style",
+			bucket:           "minio",
+			endpointURL:      "http://127.0.0.1:9001",
+			wantEndpoint:     aws.String("http://127.0.0.1:9001"),
+			wantRegion:       "us-east-1",
+			wantPathStyle:    true,
+			wantDisableHTTPS: true,
+		},
+		{
+			name:         "--endpoint-url without bucket section",
+			bucket:       "unknown",
+			endpointURL:  "localhost:9000",
+			wantEndpoint: aws.String("https://localhost:9000"),
+			wantRegion:   "us-east-1",
+		},
+		{
+			name:           "aws bucket without endpoint",
+			bucket:         "aws",
+			wantRegion:     "us-west-2",
+			wantAccelerate: true,
+			wantDualStack:  aws.DualStackEndpointStateEnabled,
+		},
+		{
+			name:   "no settings",
+			bucket: "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := ini.Load([]byte(xy3))
+			require.NoError(t, err)
+
+			l := &Loader{EndpointURL: tt.endpointURL, cfg: cfg}
+			client, err := l.NewS3ClientForBucket(t.Context(), tt.bucket)
+			require.NoError(t, err)
+
+			opts := client.Options()
+			assert.Equal(t, tt.wantEndpoint, opts.BaseEndpoint)
+			assert.Equal(t, tt.wantRegion, opts.Region)
+			assert.Equal(t, tt.wantPathStyle, opts.UsePathStyle)
+			assert.Equal(t, tt.wantDisableHTTPS, opts.EndpointOptions.DisableHTTPS)
+			assert.Equal(t, tt.wantAccelerate, opts.UseAccelerate)
+			assert.Equal(t, tt.wantDualStack, opts.EndpointOptions.UseDualStackEndpoint)
+		})
+	}
+}
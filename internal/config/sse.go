@@ -0,0 +1,119 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// SSEConfig contains the per-bucket settings for server-side encryption.
+//
+// Example .xy3 sections:
+//
+//	[s3://kms-bucket]
+//	sse = aws:kms
+//	sse-kms-key-id = arn:aws:kms:us-west-2:111122223333:key/1234abcd-12ab-34cd-56ef-1234567890ab
+//	bucket-key-enabled = true
+//
+//	[s3://ssec-bucket]
+//	sse-customer-key-file = ~/.xy3-sse-c.key
+type SSEConfig struct {
+	// ServerSideEncryption is the "sse" setting: AES256, aws:kms, or aws:kms:dsse.
+	ServerSideEncryption types.ServerSideEncryption
+	// KMSKeyID is the "sse-kms-key-id" setting.
+	KMSKeyID string
+	// BucketKeyEnabled is the "bucket-key-enabled" setting.
+	BucketKeyEnabled *bool
+	// CustomerKeyFile is the "sse-customer-key-file" setting, the name of a file containing either the raw 256-bit
+	// key or its base64 encoding to use SSE-C.
+	CustomerKeyFile string
+	// CustomerKeyEnv is the "sse-customer-key-env" setting, the name of the environment variable whose value is the
+	// base64-encoded 256-bit key to use SSE-C.
+	CustomerKeyEnv string
+}
+
+// Mode returns the encryption mode to be recorded in manifests (see internal.Manifest.SSE).
+func (c SSEConfig) Mode() string {
+	if c.CustomerKeyFile != "" || c.CustomerKeyEnv != "" {
+		return internal.SSECustomer
+	}
+
+	return string(c.ServerSideEncryption)
+}
+
+// CustomerKey returns the SSE-C key, or nil if SSE-C is not configured.
+func (c SSEConfig) CustomerKey() (*internal.SSECustomerKey, error) {
+	switch {
+	case c.CustomerKeyFile != "":
+		data, err := os.ReadFile(expandHome(c.CustomerKeyFile))
+		if err != nil {
+			return nil, fmt.Errorf(`read SSE-C key file "%s" error: %w`, c.CustomerKeyFile, err)
+		}
+
+		// the file can contain either the raw key or its base64 encoding.
+		if len(data) == 32 {
+			return internal.NewSSECustomerKey(base64.StdEncoding.EncodeToString(data))
+		}
+
+		return internal.NewSSECustomerKey(string(bytes.TrimSpace(data)))
+
+	case c.CustomerKeyEnv != "":
+		v := os.Getenv(c.CustomerKeyEnv)
+		if v == "" {
+			return nil, fmt.Errorf(`SSE-C key environment variable "%s" is empty`, c.CustomerKeyEnv)
+		}
+
+		return internal.NewSSECustomerKey(v)
+
+	default:
+		return nil, nil
+	}
+}
+
+// ApplyToPutObject applies the SSE settings to the given input.
+//
+// The customer key should come from CustomerKey.
+func (c SSEConfig) ApplyToPutObject(input *s3.PutObjectInput, key *internal.SSECustomerKey) {
+	if key != nil {
+		input.SSECustomerAlgorithm, input.SSECustomerKey, input.SSECustomerKeyMD5 = key.Headers()
+		return
+	}
+
+	if c.ServerSideEncryption != "" {
+		input.ServerSideEncryption = c.ServerSideEncryption
+	}
+	if c.KMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(c.KMSKeyID)
+	}
+	if c.BucketKeyEnabled != nil {
+		input.BucketKeyEnabled = c.BucketKeyEnabled
+	}
+}
+
+// CustomerKeyForManifest returns the SSE-C key to download the object of the given manifest.
+//
+// Returns nil if the object was not encrypted with SSE-C, and an error if it was but the key is not configured or
+// does not match the one the object was encrypted with.
+func (c SSEConfig) CustomerKeyForManifest(man internal.Manifest) (*internal.SSECustomerKey, error) {
+	if man.SSE != internal.SSECustomer {
+		return nil, nil
+	}
+
+	key, err := c.CustomerKey()
+	switch {
+	case err != nil:
+		return nil, err
+	case key == nil:
+		return nil, fmt.Errorf(`object is encrypted with SSE-C but bucket "%s" has no sse-customer-key-file or sse-customer-key-env setting`, man.Bucket)
+	case man.SSECustomerKeyMD5 != "" && man.SSECustomerKeyMD5 != key.KeyMD5:
+		return nil, fmt.Errorf("object is encrypted with a different SSE-C key (key MD5 %s, configured key MD5 %s)", man.SSECustomerKeyMD5, key.KeyMD5)
+	default:
+		return key, nil
+	}
+}
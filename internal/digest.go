@@ -0,0 +1,167 @@
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/nguyengg/go-aws-commons/sri"
+	"lukechampine.com/blake3"
+)
+
+// DefaultDigestAlgorithm is the digest algorithm of DefaultChecksum.
+const DefaultDigestAlgorithm = "sha256"
+
+// NewDigest returns a new sri.Hash for the given digest algorithm.
+//
+// Supported algorithms are sha256, sha384, sha512 (all defined by Subresource Integrity), and blake3 (formatted the same
+// way, e.g. "blake3-..."). Returns nil if the algorithm is not supported.
+func NewDigest(name string) sri.Hash {
+	switch name {
+	case "sha256":
+		return sri.NewSha256()
+	case "sha384":
+		return sri.NewSha384()
+	case "sha512":
+		return sri.NewSha512()
+	case "blake3":
+		return &namedHash{Hash: blake3.New(32, nil), name: name}
+	default:
+		return nil
+	}
+}
+
+// ParseDigestAlgorithms validates the given digest algorithms, case-insensitive, and removes duplicates.
+//
+// The first algorithm is the primary one. If names is empty, DefaultDigestAlgorithm is returned.
+func ParseDigestAlgorithms(names []string) ([]string, error) {
+	algs := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || slices.Contains(algs, name) {
+			continue
+		}
+
+		if NewDigest(name) == nil {
+			return nil, fmt.Errorf(`unsupported digest algorithm "%s"`, name)
+		}
+
+		algs = append(algs, name)
+	}
+
+	if len(algs) == 0 {
+		algs = append(algs, DefaultDigestAlgorithm)
+	}
+
+	return algs, nil
+}
+
+// MultiHash computes several digests at once.
+type MultiHash struct {
+	io.Writer
+	hashes []sri.Hash
+}
+
+// NewMultiHash returns a MultiHash of the given digest algorithms.
+//
+// Returns an error if any algorithm is not supported.
+func NewMultiHash(names ...string) (*MultiHash, error) {
+	m := &MultiHash{}
+	ws := make([]io.Writer, 0, len(names))
+	for _, name := range names {
+		h := NewDigest(name)
+		if h == nil {
+			return nil, fmt.Errorf(`unsupported digest algorithm "%s"`, name)
+		}
+
+		m.hashes = append(m.hashes, h)
+		ws = append(ws, h)
+	}
+
+	m.Writer = io.MultiWriter(ws...)
+	return m, nil
+}
+
+// SumToStrings returns the digests in the same order as the algorithms were given.
+func (m *MultiHash) SumToStrings() []string {
+	digests := make([]string, len(m.hashes))
+	for i, h := range m.hashes {
+		digests[i] = h.SumToString(nil)
+	}
+
+	return digests
+}
+
+// MultiVerifier verifies the contents written to it against every given digest.
+//
+// Unlike sri.Verifier which passes if any digest matches, MultiVerifier passes only if all recognised digests match.
+type MultiVerifier struct {
+	io.Writer
+	hashes  map[string]sri.Hash
+	digests []string
+}
+
+// NewMultiVerifier returns a MultiVerifier of the given digests.
+//
+// Empty digests and digests of unsupported algorithms are ignored. Returns nil if there is no digest to verify.
+func NewMultiVerifier(digests ...string) *MultiVerifier {
+	v := &MultiVerifier{hashes: make(map[string]sri.Hash)}
+	ws := make([]io.Writer, 0, len(digests))
+	for _, d := range digests {
+		name, _, ok := strings.Cut(d, "-")
+		if !ok {
+			continue
+		}
+
+		if _, ok = v.hashes[name]; !ok {
+			h := NewDigest(name)
+			if h == nil {
+				continue
+			}
+
+			v.hashes[name] = h
+			ws = append(ws, h)
+		}
+
+		v.digests = append(v.digests, d)
+	}
+
+	if len(v.digests) == 0 {
+		return nil
+	}
+
+	v.Writer = io.MultiWriter(ws...)
+	return v
+}
+
+// SumAndVerify returns true if all digests match.
+//
+// If a digest does not match, that digest and the actual digest using the same algorithm are returned.
+func (v *MultiVerifier) SumAndVerify() (expected, actual string, ok bool) {
+	for _, expected = range v.digests {
+		name, _, _ := strings.Cut(expected, "-")
+		if actual = v.hashes[name].SumToString(nil); subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+			return expected, actual, false
+		}
+	}
+
+	return "", "", true
+}
+
+// namedHash implements sri.Hash for hash functions not supported by sri.
+type namedHash struct {
+	hash.Hash
+	name string
+}
+
+func (h *namedHash) Name() string {
+	return h.name
+}
+
+func (h *namedHash) SumToString(b []byte) string {
+	return h.name + "-" + base64.RawStdEncoding.EncodeToString(h.Sum(b))
+}
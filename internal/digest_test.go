@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDigestAlgorithms(t *testing.T) {
+	got, err := ParseDigestAlgorithms(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sha256"}, got)
+
+	got, err = ParseDigestAlgorithms([]string{"SHA512", " blake3", "sha512"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sha512", "blake3"}, got)
+
+	_, err = ParseDigestAlgorithms([]string{"md5"})
+	assert.Error(t, err)
+}
+
+func TestMultiVerifier(t *testing.T) {
+	data := []byte("hello, world!")
+
+	m, err := NewMultiHash("sha256", "sha384", "sha512", "blake3")
+	assert.NoError(t, err)
+	_, _ = m.Write(data)
+	digests := m.SumToStrings()
+	assert.Len(t, digests, 4)
+	assert.Equal(t, "sha256-aOZWslHmfoNYvvhIOrDVHGYZ8+ehqfDnWDjUH/No9yg", digests[0])
+
+	// all digests match; digests of unknown algorithms are ignored.
+	v := NewMultiVerifier(append(digests, "md5-abcd")...)
+	_, _ = v.Write(data)
+	_, _, ok := v.SumAndVerify()
+	assert.True(t, ok)
+
+	// a single mismatch fails verification even if the other digests match.
+	v = NewMultiVerifier(digests[0], "blake3-AAAA")
+	_, _ = v.Write(data)
+	expected, actual, ok := v.SumAndVerify()
+	assert.False(t, ok)
+	assert.Equal(t, "blake3-AAAA", expected)
+	assert.Equal(t, digests[3], actual)
+
+	assert.Nil(t, NewMultiVerifier("", "md5-abcd"))
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// DownloadState identifies the S3 object being downloaded to a partial file so that a resumed download can detect
+// changes to the object.
+type DownloadState struct {
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	ETag      string `json:"etag"`
+	VersionID string `json:"versionId,omitempty"`
+	Size      int64  `json:"size"`
+
+	// PartSize and Parts are only set by parallel downloads whose parts are not written in order. Parts are the part
+	// numbers that have been written to the partial file, sorted in ascending order.
+	PartSize int64   `json:"partSize,omitempty"`
+	Parts    []int32 `json:"parts,omitempty"`
+}
+
+// SameObject returns true if both states are for the same version of the same object.
+func (s *DownloadState) SameObject(o DownloadState) bool {
+	return s.Bucket == o.Bucket && s.Key == o.Key && s.ETag == o.ETag && s.VersionID == o.VersionID && s.Size == o.Size
+}
+
+// AddPart adds the part number to Parts, keeping Parts sorted.
+func (s *DownloadState) AddPart(partNumber int32) {
+	if i, ok := slices.BinarySearch(s.Parts, partNumber); !ok {
+		s.Parts = slices.Insert(s.Parts, i, partNumber)
+	}
+}
+
+// ContiguousSize returns the number of bytes from the start of the object that have been written by parallel parts.
+func (s *DownloadState) ContiguousSize() int64 {
+	var n int32
+	for _, p := range s.Parts {
+		if p != n+1 {
+			break
+		}
+		n = p
+	}
+
+	return min(int64(n)*s.PartSize, s.Size)
+}
+
+// LoadDownloadStateFromFile reads and returns a download state from a file with the specified name.
+func LoadDownloadStateFromFile(name string) (s DownloadState, err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return s, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err, _ = dec.Decode(&s), f.Close(); err != nil {
+		return s, fmt.Errorf("unmarshal download state error: %w", err)
+	}
+
+	return s, nil
+}
+
+// SaveToFile writes the download state to a file with the specified name.
+//
+// Like UploadState.SaveToFile, the state is written to a temporary file first which then replaces the file.
+func (s *DownloadState) SaveToFile(name string) error {
+	if err := saveJSONFile(name, s); err != nil {
+		return fmt.Errorf("save download state error: %w", err)
+	}
+
+	return nil
+}
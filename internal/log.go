@@ -35,3 +35,12 @@ func MustPrefix(ctx context.Context) string {
 func MustLogger(ctx context.Context) *log.Logger {
 	return ctx.Value(loggerKey{}).(*log.Logger)
 }
+
+// Logger returns the logger attached to the given context, or log.Default if there is none.
+func Logger(ctx context.Context) *log.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*log.Logger); ok {
+		return logger
+	}
+
+	return log.Default()
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
 )
 
 // Manifest contains the bucket, key, and additional metadata about the file that has been uploaded to S3.
@@ -14,6 +17,85 @@ type Manifest struct {
 	ExpectedBucketOwner *string `json:"expectedBucketOwner,omitempty"`
 	Size                int64   `json:"size,omitempty"`
 	Checksum            string  `json:"checksum,omitempty"`
+
+	// VersionID is the version of the object that was uploaded if the bucket has versioning enabled.
+	//
+	// Downloading and removing the object act on this version instead of the latest version of the key.
+	VersionID *string `json:"versionId,omitempty"`
+
+	// ETag is the entity tag of the object, including the surrounding quotes, which changes if the object is replaced.
+	ETag string `json:"etag,omitempty"`
+
+	// Checksums are the additional digests of the object such as "sha512-..." or "blake3-..." (see NewDigest).
+	//
+	// Checksum is the primary digest, which is also stored in the object's "checksum" metadata.
+	Checksums []string `json:"checksums,omitempty"`
+
+	// S3ChecksumAlgorithm and S3Checksum are the S3 additional checksum that the object was uploaded with.
+	//
+	// S3Checksum is in the same format as S3 reports it: the checksum of objects uploaded with multipart upload is the
+	// checksum of the checksums of the parts, suffixed with "-N" where N is the number of parts, unless the algorithm
+	// only supports full-object checksums (CRC64NVME).
+	S3ChecksumAlgorithm string `json:"s3ChecksumAlgorithm,omitempty"`
+	S3Checksum          string `json:"s3Checksum,omitempty"`
+
+	// ZstdDictionaryID is the ID of the zstd dictionary that the archive was compressed with.
+	//
+	// The dictionary itself is embedded in the archive; the ID is informational.
+	ZstdDictionaryID uint32 `json:"zstdDictionaryId,omitempty"`
+
+	// SSE is the server-side encryption mode that the object was uploaded with such as "AES256" or "aws:kms".
+	//
+	// If the value is "SSE-C" (see SSECustomer), the object was encrypted with a customer-provided key which must be
+	// given again to download it. SSECustomerKeyMD5 identifies which key.
+	SSE               string `json:"sse,omitempty"`
+	SSEKMSKeyID       string `json:"sseKmsKeyId,omitempty"`
+	SSECustomerKeyMD5 string `json:"sseCustomerKeyMd5,omitempty"`
+
+	// Encryption is non-nil if the object was encrypted client-side before upload.
+	//
+	// Size and Checksum are of the encrypted object.
+	Encryption *Encryption `json:"encryption,omitempty"`
+
+	// Extracted is the file or directory that an archive was extracted to by pull, relative to the manifest's directory.
+	//
+	// Pulling a newer version of the archive replaces it.
+	Extracted string `json:"extracted,omitempty"`
+}
+
+// Encryption describes how an object was encrypted client-side.
+type Encryption struct {
+	// Scheme is the encryption scheme such as codec.AgeScheme.
+	Scheme string `json:"scheme"`
+
+	// Recipients are the fingerprints of the recipients that can decrypt the object (see codec.AgeFingerprint).
+	Recipients []string `json:"recipients,omitempty"`
+}
+
+// NewManifestFromHeadObject returns the manifest of an existing object from its HeadObject response.
+//
+// The digests other than the "checksum" metadata are not known without downloading the object so Checksums is empty.
+func NewManifestFromHeadObject(bucket, key string, expectedBucketOwner *string, output *s3.HeadObjectOutput) Manifest {
+	m := Manifest{
+		Bucket:              bucket,
+		Key:                 key,
+		VersionID:           output.VersionId,
+		ETag:                aws.ToString(output.ETag),
+		ExpectedBucketOwner: expectedBucketOwner,
+		Size:                aws.ToInt64(output.ContentLength),
+		Checksum:            output.Metadata["checksum"],
+	}
+
+	alg, value := S3ChecksumsFromHeadObject(output).Get()
+	m.S3ChecksumAlgorithm, m.S3Checksum = string(alg), value
+
+	if output.SSECustomerAlgorithm != nil {
+		m.SSE, m.SSECustomerKeyMD5 = SSECustomer, aws.ToString(output.SSECustomerKeyMD5)
+	} else {
+		m.SSE, m.SSEKMSKeyID = string(output.ServerSideEncryption), aws.ToString(output.SSEKMSKeyId)
+	}
+
+	return m
 }
 
 // LoadManifestFromFile reads and returns a manifest from a file with the specified name.
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewManifestFromHeadObject(t *testing.T) {
+	m := NewManifestFromHeadObject("bucket", "key", aws.String("1234"), &s3.HeadObjectOutput{
+		ContentLength:        aws.Int64(5),
+		ChecksumSHA256:       aws.String("sha256-value"),
+		Metadata:             map[string]string{"checksum": "sha256-abc"},
+		ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+		SSEKMSKeyId:          aws.String("key-id"),
+		VersionId:            aws.String("v1"),
+		ETag:                 aws.String(`"etag"`),
+	})
+
+	assert.Equal(t, Manifest{
+		Bucket:              "bucket",
+		Key:                 "key",
+		VersionID:           aws.String("v1"),
+		ETag:                `"etag"`,
+		ExpectedBucketOwner: aws.String("1234"),
+		Size:                5,
+		Checksum:            "sha256-abc",
+		S3ChecksumAlgorithm: "SHA256",
+		S3Checksum:          "sha256-value",
+		SSE:                 "aws:kms",
+		SSEKMSKeyID:         "key-id",
+	}, m)
+}
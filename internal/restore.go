@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrRestoreNotRequested is returned by WaitForRestore if the object is archived but has no restore in progress.
+var ErrRestoreNotRequested = errors.New("object is archived and no restore has been requested")
+
+// RestoreStatus is the parsed value of the x-amz-restore header.
+type RestoreStatus struct {
+	// Ongoing is true if the restore is still in progress.
+	Ongoing bool
+	// ExpiryDate is when the restored copy will be removed. It is zero for objects in the archive access tiers of
+	// S3 Intelligent-Tiering which move back to the frequent access tier once restored.
+	ExpiryDate time.Time
+}
+
+var restoreHeaderRegex = regexp.MustCompile(`([a-z-]+)="([^"]*)"`)
+
+// ParseRestoreStatus parses the x-amz-restore header from HeadObjectOutput.Restore.
+//
+// The header looks like `ongoing-request="true"` or `ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`.
+// The returned bool is false if there is no header, i.e. no restore has ever been requested.
+func ParseRestoreStatus(header *string) (s RestoreStatus, ok bool, err error) {
+	if header == nil || *header == "" {
+		return s, false, nil
+	}
+
+	for _, m := range restoreHeaderRegex.FindAllStringSubmatch(*header, -1) {
+		switch m[1] {
+		case "ongoing-request":
+			s.Ongoing, ok = m[2] == "true", true
+		case "expiry-date":
+			if s.ExpiryDate, err = time.Parse(time.RFC1123, m[2]); err != nil {
+				return s, false, fmt.Errorf(`parse expiry date "%s" error: %w`, m[2], err)
+			}
+		}
+	}
+
+	if !ok {
+		return s, false, fmt.Errorf(`invalid restore header "%s"`, *header)
+	}
+
+	return s, true, nil
+}
+
+// IsArchived returns true if the object is in an archive storage class (GLACIER or DEEP_ARCHIVE) or in one of the
+// archive access tiers of S3 Intelligent-Tiering.
+//
+// GLACIER_IR objects can be read immediately so they are not considered archived.
+func IsArchived(output *s3.HeadObjectOutput) bool {
+	switch output.StorageClass {
+	case types.StorageClassGlacier, types.StorageClassDeepArchive:
+		return true
+	}
+
+	return output.ArchiveStatus != ""
+}
+
+// IsReadable returns true if the object can be downloaded, i.e. it is not archived or its restore has completed.
+func IsReadable(output *s3.HeadObjectOutput) bool {
+	if !IsArchived(output) {
+		return true
+	}
+
+	s, ok, err := ParseRestoreStatus(output.Restore)
+	return err == nil && ok && !s.Ongoing
+}
+
+// HeadObjectClient abstracts the HeadObject API.
+type HeadObjectClient interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// WaitForRestore calls HeadObject every interval until the object is readable.
+//
+// If onPoll is non-nil, it is called with every HeadObject response while the restore is still in progress. If the object
+// is archived but no restore is in progress, ErrRestoreNotRequested is returned.
+func WaitForRestore(ctx context.Context, client HeadObjectClient, input *s3.HeadObjectInput, interval time.Duration, onPoll func(*s3.HeadObjectOutput)) (*s3.HeadObjectOutput, error) {
+	for {
+		output, err := client.HeadObject(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf(`head object "s3://%s/%s" error: %w`, aws.ToString(input.Bucket), aws.ToString(input.Key), err)
+		}
+
+		if IsReadable(output) {
+			return output, nil
+		}
+
+		switch s, ok, err := ParseRestoreStatus(output.Restore); {
+		case err != nil:
+			return nil, err
+		case !ok || !s.Ongoing:
+			return nil, ErrRestoreNotRequested
+		}
+
+		if onPoll != nil {
+			onPoll(output)
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal/s3test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRestoreStatus(t *testing.T) {
+	s, ok, err := ParseRestoreStatus(aws.String(`ongoing-request="true"`))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, RestoreStatus{Ongoing: true}, s)
+
+	s, ok, err = ParseRestoreStatus(aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, s.Ongoing)
+	assert.Equal(t, time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC), s.ExpiryDate.UTC())
+
+	_, ok, err = ParseRestoreStatus(nil)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = ParseRestoreStatus(aws.String("garbage"))
+	assert.Error(t, err)
+}
+
+func TestIsReadable(t *testing.T) {
+	assert.True(t, IsReadable(&s3.HeadObjectOutput{StorageClass: types.StorageClassGlacierIr}))
+	assert.False(t, IsReadable(&s3.HeadObjectOutput{StorageClass: types.StorageClassDeepArchive}))
+	assert.False(t, IsReadable(&s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="true"`)}))
+	assert.True(t, IsReadable(&s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)}))
+	assert.False(t, IsReadable(&s3.HeadObjectOutput{StorageClass: types.StorageClassIntelligentTiering, ArchiveStatus: types.ArchiveStatusArchiveAccess}))
+}
+
+func TestWaitForRestore(t *testing.T) {
+	input := &s3.HeadObjectInput{Bucket: aws.String("bucket"), Key: aws.String("key")}
+	restored := &s3.HeadObjectOutput{StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="false", expiry-date="Fri, 21 Dec 2012 00:00:00 GMT"`)}
+	client := &s3test.Client{Objects: map[string]*s3.HeadObjectOutput{
+		"key": {StorageClass: types.StorageClassGlacier, Restore: aws.String(`ongoing-request="true"`)},
+	}}
+
+	// the restore completes after the second poll.
+	polls := 0
+	output, err := WaitForRestore(context.Background(), client, input, time.Millisecond, func(_ *s3.HeadObjectOutput) {
+		if polls++; polls == 2 {
+			client.Objects["key"] = restored
+		}
+	})
+	require.NoError(t, err)
+	assert.Same(t, restored, output)
+	assert.Equal(t, 2, polls)
+	assert.Len(t, client.HeadKeys(), 3)
+
+	client = &s3test.Client{Objects: map[string]*s3.HeadObjectOutput{"key": {StorageClass: types.StorageClassDeepArchive}}}
+	_, err = WaitForRestore(context.Background(), client, input, time.Millisecond, nil)
+	assert.ErrorIs(t, err, ErrRestoreNotRequested)
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// RestoreStateExt is the extension of the file next to a manifest that tracks the pending restore of its archived
+// object.
+const RestoreStateExt = ".restore"
+
+// RestoreState records the RestoreObject request of an archived object.
+type RestoreState struct {
+	Bucket      string    `json:"bucket"`
+	Key         string    `json:"key"`
+	VersionID   string    `json:"versionId,omitempty"`
+	Tier        string    `json:"tier,omitempty"`
+	Days        int32     `json:"days,omitempty"`
+	RequestedAt time.Time `json:"requestedAt"`
+}
+
+// LoadRestoreStateFromFile reads and returns a restore state from a file with the specified name.
+func LoadRestoreStateFromFile(name string) (s RestoreState, err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return s, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err, _ = dec.Decode(&s), f.Close(); err != nil {
+		return s, fmt.Errorf("unmarshal restore state error: %w", err)
+	}
+
+	return s, nil
+}
+
+// SaveToFile writes the restore state to a file with the specified name.
+func (s *RestoreState) SaveToFile(name string) error {
+	if err := saveJSONFile(name, s); err != nil {
+		return fmt.Errorf("save restore state error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// crc64NVMETable is the table for CRC-64/NVME using the reversed polynomial as required by hash/crc64.
+var crc64NVMETable = crc64.MakeTable(0x9a6c9329ac4bc9b5)
+
+// NewS3ChecksumHash returns a new hash.Hash for the given S3 checksum algorithm.
+//
+// Returns nil if the algorithm is not supported.
+func NewS3ChecksumHash(alg types.ChecksumAlgorithm) hash.Hash {
+	switch alg {
+	case types.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case types.ChecksumAlgorithmCrc64nvme:
+		return crc64.New(crc64NVMETable)
+	case types.ChecksumAlgorithmSha1:
+		return sha1.New()
+	case types.ChecksumAlgorithmSha256:
+		return sha256.New()
+	default:
+		return nil
+	}
+}
+
+// ParseS3ChecksumAlgorithm validates the given S3 checksum algorithm, case-insensitive.
+//
+// The empty string is valid and means no additional checksum.
+func ParseS3ChecksumAlgorithm(text string) (types.ChecksumAlgorithm, error) {
+	if text == "" {
+		return "", nil
+	}
+
+	alg := types.ChecksumAlgorithm(strings.ToUpper(text))
+	if NewS3ChecksumHash(alg) == nil {
+		return "", fmt.Errorf(`unsupported S3 checksum algorithm "%s"`, text)
+	}
+
+	return alg, nil
+}
+
+// S3Checksums contains the checksum fields that are common to many S3 responses.
+type S3Checksums struct {
+	ChecksumCRC32     *string
+	ChecksumCRC32C    *string
+	ChecksumCRC64NVME *string
+	ChecksumSHA1      *string
+	ChecksumSHA256    *string
+}
+
+// S3ChecksumsFromHeadObject returns the S3 additional checksums in the HeadObject response.
+func S3ChecksumsFromHeadObject(output *s3.HeadObjectOutput) S3Checksums {
+	return S3Checksums{
+		ChecksumCRC32:     output.ChecksumCRC32,
+		ChecksumCRC32C:    output.ChecksumCRC32C,
+		ChecksumCRC64NVME: output.ChecksumCRC64NVME,
+		ChecksumSHA1:      output.ChecksumSHA1,
+		ChecksumSHA256:    output.ChecksumSHA256,
+	}
+}
+
+// Get returns the first available checksum and its algorithm.
+//
+// Returns two empty values if there is no checksum.
+func (c S3Checksums) Get() (types.ChecksumAlgorithm, string) {
+	switch {
+	case c.ChecksumSHA256 != nil:
+		return types.ChecksumAlgorithmSha256, *c.ChecksumSHA256
+	case c.ChecksumCRC64NVME != nil:
+		return types.ChecksumAlgorithmCrc64nvme, *c.ChecksumCRC64NVME
+	case c.ChecksumCRC32C != nil:
+		return types.ChecksumAlgorithmCrc32c, *c.ChecksumCRC32C
+	case c.ChecksumCRC32 != nil:
+		return types.ChecksumAlgorithmCrc32, *c.ChecksumCRC32
+	case c.ChecksumSHA1 != nil:
+		return types.ChecksumAlgorithmSha1, *c.ChecksumSHA1
+	default:
+		return "", ""
+	}
+}
+
+// NewS3Checksums returns the S3Checksums with only the field of the given algorithm set to value.
+//
+// Returns the zero-value if value is empty.
+func NewS3Checksums(alg types.ChecksumAlgorithm, value string) (c S3Checksums) {
+	if value == "" {
+		return
+	}
+
+	switch alg {
+	case types.ChecksumAlgorithmCrc32:
+		c.ChecksumCRC32 = &value
+	case types.ChecksumAlgorithmCrc32c:
+		c.ChecksumCRC32C = &value
+	case types.ChecksumAlgorithmCrc64nvme:
+		c.ChecksumCRC64NVME = &value
+	case types.ChecksumAlgorithmSha1:
+		c.ChecksumSHA1 = &value
+	case types.ChecksumAlgorithmSha256:
+		c.ChecksumSHA256 = &value
+	}
+
+	return
+}
+
+// SplitS3Checksum splits the checksum value of a multipart upload (e.g. "3d7I3A==-12") into its base64-encoded
+// checksum-of-checksums and the number of parts.
+//
+// Returns parts == 0 for full-object checksums (no "-N" suffix).
+func SplitS3Checksum(value string) (string, int, error) {
+	v, n, ok := strings.Cut(value, "-")
+	if !ok {
+		return value, 0, nil
+	}
+
+	parts, err := strconv.Atoi(n)
+	if err != nil || parts <= 0 {
+		return value, 0, fmt.Errorf(`invalid S3 checksum "%s"`, value)
+	}
+
+	return v, parts, nil
+}
+
+// S3ChecksumVerifier computes the S3 native checksum of the contents written to it.
+//
+// If the expected checksum is composite, the checksum is computed as the checksum of the checksums of every part.
+// Otherwise, the checksum is of the full object.
+type S3ChecksumVerifier struct {
+	expected string
+	partSize int64
+
+	full, part, composite hash.Hash
+	n                     int64
+	parts                 int
+}
+
+// NewS3ChecksumVerifier returns a verifier of the given expected checksum value.
+//
+// If the expected value is a composite checksum (ends in "-N"), partSize must be the size of every part but the last.
+// Returns nil if the algorithm is not supported.
+func NewS3ChecksumVerifier(alg types.ChecksumAlgorithm, expected string, partSize int64) *S3ChecksumVerifier {
+	h := NewS3ChecksumHash(alg)
+	if h == nil {
+		return nil
+	}
+
+	v := &S3ChecksumVerifier{expected: expected, full: h}
+	if _, parts, _ := SplitS3Checksum(expected); parts > 0 && partSize > 0 {
+		v.partSize = partSize
+		v.part = NewS3ChecksumHash(alg)
+		v.composite = NewS3ChecksumHash(alg)
+	}
+
+	return v
+}
+
+// Write implements io.Writer.
+func (v *S3ChecksumVerifier) Write(p []byte) (int, error) {
+	if v.part == nil {
+		return v.full.Write(p)
+	}
+
+	written := len(p)
+	for len(p) > 0 {
+		m := min(int64(len(p)), v.partSize-v.n)
+		_, _ = v.part.Write(p[:m])
+		v.n += m
+		p = p[m:]
+
+		if v.n == v.partSize {
+			v.endPart()
+		}
+	}
+
+	return written, nil
+}
+
+func (v *S3ChecksumVerifier) endPart() {
+	_, _ = v.composite.Write(v.part.Sum(nil))
+	v.part.Reset()
+	v.n = 0
+	v.parts++
+}
+
+// Sum returns the checksum in the same format as S3 does.
+//
+// Sum must only be called once after all contents have been written.
+func (v *S3ChecksumVerifier) Sum() string {
+	if v.part == nil {
+		return base64.StdEncoding.EncodeToString(v.full.Sum(nil))
+	}
+
+	if v.n > 0 || v.parts == 0 {
+		v.endPart()
+	}
+
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(v.composite.Sum(nil)), v.parts)
+}
+
+// SumAndVerify returns true if Sum matches the expected value.
+//
+// Like Sum, SumAndVerify must only be called once after all contents have been written.
+func (v *S3ChecksumVerifier) SumAndVerify() (string, bool) {
+	actual := v.Sum()
+	return actual, actual == v.expected
+}
+
+// FormatS3Checksum formats the algorithm and value for display and for ErrChecksumMismatch, e.g. "CRC32C:3d7I3A==-12".
+func FormatS3Checksum(alg types.ChecksumAlgorithm, value string) string {
+	return fmt.Sprintf("%s:%s", alg, value)
+}
@@ -0,0 +1,91 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewS3ChecksumHash_CRC64NVME(t *testing.T) {
+	// check value of CRC-64/NVME.
+	h := NewS3ChecksumHash(types.ChecksumAlgorithmCrc64nvme)
+	_, _ = h.Write([]byte("123456789"))
+	assert.Equal(t, uint64(0xae8b14860a799888), binary.BigEndian.Uint64(h.Sum(nil)))
+}
+
+func TestParseS3ChecksumAlgorithm(t *testing.T) {
+	got, err := ParseS3ChecksumAlgorithm("crc32c")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ChecksumAlgorithmCrc32c, got)
+
+	got, err = ParseS3ChecksumAlgorithm("")
+	assert.NoError(t, err)
+	assert.Equal(t, types.ChecksumAlgorithm(""), got)
+
+	_, err = ParseS3ChecksumAlgorithm("md5")
+	assert.Error(t, err)
+}
+
+func TestS3ChecksumsFromHeadObject(t *testing.T) {
+	alg, value := S3ChecksumsFromHeadObject(&s3.HeadObjectOutput{ChecksumCRC32C: aws.String("3d7I3A=="), ETag: aws.String(`"etag"`)}).Get()
+	assert.Equal(t, types.ChecksumAlgorithmCrc32c, alg)
+	assert.Equal(t, "3d7I3A==", value)
+
+	alg, value = S3ChecksumsFromHeadObject(&s3.HeadObjectOutput{}).Get()
+	assert.Empty(t, alg)
+	assert.Empty(t, value)
+}
+
+func TestSplitS3Checksum(t *testing.T) {
+	v, parts, err := SplitS3Checksum("3d7I3A==-12")
+	assert.NoError(t, err)
+	assert.Equal(t, "3d7I3A==", v)
+	assert.Equal(t, 12, parts)
+
+	v, parts, err = SplitS3Checksum("3d7I3A==")
+	assert.NoError(t, err)
+	assert.Equal(t, "3d7I3A==", v)
+	assert.Equal(t, 0, parts)
+
+	_, _, err = SplitS3Checksum("3d7I3A==-x")
+	assert.Error(t, err)
+}
+
+func TestS3ChecksumVerifier(t *testing.T) {
+	data := []byte(strings.Repeat("hello, world!", 100))
+
+	// full object.
+	full := sha256.Sum256(data)
+	expected := base64.StdEncoding.EncodeToString(full[:])
+	v := NewS3ChecksumVerifier(types.ChecksumAlgorithmSha256, expected, 0)
+	_, _ = v.Write(data)
+	actual, ok := v.SumAndVerify()
+	assert.True(t, ok)
+	assert.Equal(t, expected, actual)
+
+	// composite of 3 parts of 500, 500, and 300 bytes.
+	composite := sha256.New()
+	for _, part := range [][]byte{data[:500], data[500:1000], data[1000:]} {
+		sum := sha256.Sum256(part)
+		composite.Write(sum[:])
+	}
+	expected = base64.StdEncoding.EncodeToString(composite.Sum(nil)) + "-3"
+
+	// write in odd chunks so that writes straddle part boundaries.
+	v = NewS3ChecksumVerifier(types.ChecksumAlgorithmSha256, expected, 500)
+	for p := data; len(p) > 0; {
+		n := min(len(p), 333)
+		_, _ = v.Write(p[:n])
+		p = p[n:]
+	}
+	actual, ok = v.SumAndVerify()
+	assert.True(t, ok)
+	assert.Equal(t, expected, actual)
+}
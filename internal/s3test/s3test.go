@@ -0,0 +1,107 @@
+// Package s3test provides in-memory fakes of S3 APIs for tests.
+package s3test
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Client is an in-memory fake of the HeadObject and ListObjectsV2 APIs.
+//
+// The objects only exist as their HeadObject responses. Tests that need other APIs can embed Client in their own fakes.
+type Client struct {
+	// Objects are the HeadObject responses keyed by object key.
+	Objects map[string]*s3.HeadObjectOutput
+
+	mu       sync.Mutex
+	headKeys []string
+}
+
+// HeadObject returns the response of the requested key in Objects, or types.NotFound if there is none.
+func (c *Client) HeadObject(_ context.Context, input *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := aws.ToString(input.Key)
+	c.headKeys = append(c.headKeys, key)
+
+	head, ok := c.Objects[key]
+	if !ok {
+		return nil, &types.NotFound{}
+	}
+
+	return head, nil
+}
+
+// HeadKeys returns the keys of every HeadObject request so far in order.
+func (c *Client) HeadKeys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return slices.Clone(c.headKeys)
+}
+
+// ListObjectsV2 lists the keys in Objects that start with the requested prefix in lexicographical order.
+//
+// If there is a delimiter, keys that contain it after the prefix are rolled up into CommonPrefixes instead. Pages have
+// up to MaxKeys (default 1000) objects and common prefixes, and the continuation token is the last key or common
+// prefix of the previous page.
+func (c *Client) ListObjectsV2(_ context.Context, input *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	maxKeys := int(aws.ToInt32(input.MaxKeys))
+	if maxKeys <= 0 {
+		maxKeys = 1000
+	}
+
+	prefix, delimiter := aws.ToString(input.Prefix), aws.ToString(input.Delimiter)
+	after := max(aws.ToString(input.StartAfter), aws.ToString(input.ContinuationToken))
+
+	output := &s3.ListObjectsV2Output{Prefix: input.Prefix, Delimiter: input.Delimiter, IsTruncated: aws.Bool(false)}
+	last := ""
+	for _, key := range slices.Sorted(maps.Keys(c.Objects)) {
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			continue
+		}
+
+		// keys with the same common prefix are next to each other so only the first one adds to CommonPrefixes.
+		commonPrefix := ""
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i != -1 {
+			if commonPrefix = key[:len(prefix)+i+len(delimiter)]; commonPrefix == after || commonPrefix == last {
+				continue
+			}
+		}
+
+		if len(output.Contents)+len(output.CommonPrefixes) == maxKeys {
+			output.IsTruncated, output.NextContinuationToken = aws.Bool(true), aws.String(last)
+			break
+		}
+
+		if commonPrefix != "" {
+			output.CommonPrefixes = append(output.CommonPrefixes, types.CommonPrefix{Prefix: aws.String(commonPrefix)})
+			last = commonPrefix
+			continue
+		}
+
+		head := c.Objects[key]
+		output.Contents = append(output.Contents, types.Object{
+			Key:          aws.String(key),
+			ETag:         head.ETag,
+			LastModified: head.LastModified,
+			Size:         head.ContentLength,
+			StorageClass: types.ObjectStorageClass(head.StorageClass),
+		})
+		last = key
+	}
+	output.KeyCount = aws.Int32(int32(len(output.Contents) + len(output.CommonPrefixes)))
+
+	return output, nil
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// SSECustomer is the value of Manifest.SSE for objects encrypted with customer-provided keys (SSE-C).
+const SSECustomer = "SSE-C"
+
+// SSECustomerKey is a customer-provided key for SSE-C.
+type SSECustomerKey struct {
+	// Key is the base64-encoded 256-bit key.
+	Key string
+	// KeyMD5 is the base64-encoded MD5 digest of the key.
+	KeyMD5 string
+}
+
+// NewSSECustomerKey validates the given base64-encoded 256-bit key and computes its MD5 digest.
+func NewSSECustomerKey(key string) (*SSECustomerKey, error) {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("decode SSE-C key error: %w", err)
+	}
+
+	if len(data) != 32 {
+		return nil, fmt.Errorf("SSE-C key must be 256-bit, got %d bits", len(data)*8)
+	}
+
+	h := md5.Sum(data)
+	return &SSECustomerKey{Key: key, KeyMD5: base64.StdEncoding.EncodeToString(h[:])}, nil
+}
+
+// Headers returns the values of the SSECustomerAlgorithm, SSECustomerKey, and SSECustomerKeyMD5 fields of S3 inputs.
+//
+// For convenience, if the receiver is nil, all values are nil.
+func (k *SSECustomerKey) Headers() (algorithm, key, keyMD5 *string) {
+	if k == nil {
+		return nil, nil, nil
+	}
+
+	return aws.String("AES256"), aws.String(k.Key), aws.String(k.KeyMD5)
+}
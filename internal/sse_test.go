@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSSECustomerKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		key     string
+		wantMD5 string
+		wantErr bool
+	}{
+		{
+			name:    "valid key",
+			key:     "AAECAwQFBgcICQoLDA0ODxAREhMUFRYXGBkaGxwdHh8=",
+			wantMD5: "tP/LI3N87DFaSk0aoqYgzg==",
+		},
+		{
+			name:    "not base64",
+			key:     "not a key!",
+			wantErr: true,
+		},
+		{
+			name:    "128-bit key",
+			key:     "AAECAwQFBgcICQoLDA0ODw==",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewSSECustomerKey(tt.key)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantMD5, got.KeyMD5)
+
+			algorithm, key, keyMD5 := got.Headers()
+			assert.Equal(t, "AES256", aws.ToString(algorithm))
+			assert.Equal(t, tt.key, aws.ToString(key))
+			assert.Equal(t, tt.wantMD5, aws.ToString(keyMD5))
+		})
+	}
+
+	var none *SSECustomerKey
+	algorithm, key, keyMD5 := none.Headers()
+	assert.Nil(t, algorithm)
+	assert.Nil(t, key)
+	assert.Nil(t, keyMD5)
+}
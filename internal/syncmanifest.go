@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SyncManifest is the aggregate manifest of a local directory that has been synced to an S3 prefix.
+type SyncManifest struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+
+	// Files are the manifests of the synced files, keyed by their slash-separated paths relative to the directory.
+	Files map[string]Manifest `json:"files"`
+}
+
+// LoadSyncManifestFromFile reads and returns an aggregate manifest from a file with the specified name.
+func LoadSyncManifestFromFile(name string) (m SyncManifest, err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return m, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err, _ = dec.Decode(&m), f.Close(); err != nil {
+		return m, fmt.Errorf("unmarshal sync manifest error: %w", err)
+	}
+
+	return m, nil
+}
+
+// SaveToFile writes the aggregate manifest to a file with the specified name.
+//
+// Like UploadState.SaveToFile, the manifest is written to a temporary file first which then replaces the file.
+func (m *SyncManifest) SaveToFile(name string) error {
+	if err := saveJSONFile(name, m); err != nil {
+		return fmt.Errorf("save sync manifest error: %w", err)
+	}
+
+	return nil
+}
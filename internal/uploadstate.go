@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// UploadState is the state of a resumable multipart upload that is persisted to a local file.
+type UploadState struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"uploadId"`
+	PartSize int64  `json:"partSize"`
+
+	// ChecksumAlgorithm and ChecksumType are the S3 additional checksum algorithm and type of the multipart upload.
+	ChecksumAlgorithm string `json:"checksumAlgorithm,omitempty"`
+	ChecksumType      string `json:"checksumType,omitempty"`
+
+	// Checksum is the primary digest of the source that was added to the object's "checksum" metadata.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Source identifies the local file being uploaded.
+	Source UploadSource `json:"source"`
+
+	// Archive describes the source if it is an archive that was compressed from a directory for the upload.
+	//
+	// A resumed upload reuses the archive instead of compressing the directory again, so the details that compressing
+	// would have produced must come from here.
+	Archive *UploadArchive `json:"archive,omitempty"`
+
+	// Parts are the parts that have been uploaded successfully, sorted by part number.
+	Parts []UploadPart `json:"parts,omitempty"`
+}
+
+// UploadSource identifies the local file being uploaded so that a resumed upload can detect changes to the file.
+type UploadSource struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// NewUploadSource returns the UploadSource of the given file.
+func NewUploadSource(f *os.File) (UploadSource, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return UploadSource{}, fmt.Errorf(`stat file "%s" error: %w`, f.Name(), err)
+	}
+
+	name, err := filepath.Abs(f.Name())
+	if err != nil {
+		return UploadSource{}, fmt.Errorf(`get absolute path of "%s" error: %w`, f.Name(), err)
+	}
+
+	return UploadSource{Name: name, Size: fi.Size(), ModTime: fi.ModTime().UTC()}, nil
+}
+
+// Equal returns true if both sources have the same name, size, and modification time.
+func (s UploadSource) Equal(o UploadSource) bool {
+	return s.Name == o.Name && s.Size == o.Size && s.ModTime.Equal(o.ModTime)
+}
+
+// UploadArchive describes an archive that was compressed from a directory for the upload.
+type UploadArchive struct {
+	ContentType      string `json:"contentType,omitempty"`
+	Size             int64  `json:"size"`
+	ZstdDictionaryID uint32 `json:"zstdDictionaryId,omitempty"`
+}
+
+// UploadPart is a part that has been uploaded successfully.
+type UploadPart struct {
+	PartNumber int32  `json:"partNumber"`
+	Size       int64  `json:"size"`
+	ETag       string `json:"etag"`
+
+	// Checksum is the part's S3 additional checksum as returned by UploadPart.
+	Checksum string `json:"checksum,omitempty"`
+
+	// Digest is the SHA-256 digest of the part's contents, used to validate the part against the source on resume.
+	Digest string `json:"digest"`
+}
+
+// Part returns the part with the given part number.
+func (s *UploadState) Part(partNumber int32) (UploadPart, bool) {
+	if i, ok := slices.BinarySearchFunc(s.Parts, partNumber, func(p UploadPart, n int32) int {
+		return int(p.PartNumber - n)
+	}); ok {
+		return s.Parts[i], true
+	}
+
+	return UploadPart{}, false
+}
+
+// SetPart adds or replaces the part with the same part number, keeping Parts sorted.
+func (s *UploadState) SetPart(part UploadPart) {
+	i, ok := slices.BinarySearchFunc(s.Parts, part.PartNumber, func(p UploadPart, n int32) int {
+		return int(p.PartNumber - n)
+	})
+	if ok {
+		s.Parts[i] = part
+		return
+	}
+
+	s.Parts = slices.Insert(s.Parts, i, part)
+}
+
+// LoadUploadStateFromFile reads and returns an upload state from a file with the specified name.
+func LoadUploadStateFromFile(name string) (s UploadState, err error) {
+	var f *os.File
+	if f, err = os.Open(name); err != nil {
+		return s, fmt.Errorf(`open file "%s" error: %w`, name, err)
+	}
+
+	dec := json.NewDecoder(f)
+	dec.DisallowUnknownFields()
+	if err, _ = dec.Decode(&s), f.Close(); err != nil {
+		return s, fmt.Errorf("unmarshal upload state error: %w", err)
+	}
+
+	return s, nil
+}
+
+// SaveToFile writes the upload state to a file with the specified name.
+//
+// The state is written to a temporary file first which then replaces the file so that an interruption while saving
+// does not corrupt the existing state.
+func (s *UploadState) SaveToFile(name string) error {
+	if err := saveJSONFile(name, s); err != nil {
+		return fmt.Errorf("save upload state error: %w", err)
+	}
+
+	return nil
+}
+
+// saveJSONFile writes v as indented JSON to a temporary file which then replaces the file with the specified name.
+func saveJSONFile(name string, v any) error {
+	f, err := os.CreateTemp(filepath.Dir(name), filepath.Base(name)+".*")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err, _ = enc.Encode(v), f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	if err = os.Rename(f.Name(), name); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,238 @@
+package xy3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/internal"
+	"golang.org/x/time/rate"
+)
+
+// readerWriterAt is the destination of the parallel mode.
+//
+// The byte ranges are written with io.WriterAt, then read back in order with io.ReaderAt to compute the checksums.
+type readerWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// parallelResumeFunc is called by downloadParallel with the HeadObject response and the part size from
+// DownloadOptions to determine which parts have already been downloaded.
+//
+// It returns the part size to use, the part numbers that have already been written to dst, and a function to be called
+// after each new part is written.
+type parallelResumeFunc func(headObjectResult *s3.HeadObjectOutput, partSize int64) (int64, []int32, func(partNumber int32) error, error)
+
+// downloadParallel implements the parallel mode of Download and DownloadFile.
+//
+// The object is split into parts of DownloadOptions.PartSize bytes; each part is downloaded with its own ranged
+// GetObject which is retried up to DownloadOptions.MaxRetries times. Meanwhile, a single goroutine reads the parts
+// back from dst in order to compute the checksums of the whole object.
+//
+// If resume is non-nil, the parts that have already been downloaded are skipped, but they are still hashed.
+func downloadParallel(ctx context.Context, client s3reader.GetAndHeadObjectClient, bucket, key string, dst readerWriterAt, opts *DownloadOptions, resume parallelResumeFunc) error {
+	p, err := newDownloadPlan(ctx, client, bucket, key, opts)
+	if err != nil {
+		return err
+	}
+
+	// every part must come from the same object.
+	if p.getObjectInput.IfMatch == nil {
+		p.getObjectInput.IfMatch = p.headObjectResult.ETag
+	}
+
+	var (
+		size      = aws.ToInt64(p.headObjectResult.ContentLength)
+		partSize  = opts.PartSize
+		existing  []int32
+		onPart    func(partNumber int32) error
+		completed = make(map[int32]bool)
+	)
+	if partSize <= 0 {
+		partSize = DefaultDownloadPartSize
+	}
+	if resume != nil {
+		if partSize, existing, onPart, err = resume(p.headObjectResult, partSize); err != nil {
+			return err
+		}
+	}
+
+	concurrency, maxRetries, limiter := parallelOptions(opts, partSize)
+
+	// preallocate the file.
+	if t, ok := dst.(interface{ Truncate(int64) error }); ok {
+		if err = t.Truncate(size); err != nil {
+			return fmt.Errorf("preallocate file error: %w", err)
+		}
+	}
+
+	bar := tspb.DefaultBytes(size, fmt.Sprintf(`downloading "%s"`, internal.TruncateRightWithSuffix(path.Base(key), 15, "...")))
+	defer bar.Close()
+
+	partCount := int32((size + partSize - 1) / partSize)
+	partRange := func(partNumber int32) (start, end int64) {
+		start = int64(partNumber-1) * partSize
+		return start, min(start+partSize, size) - 1
+	}
+
+	// written[i] is closed once part i+1 has been written to dst.
+	written := make([]chan struct{}, partCount)
+	for i := range written {
+		written[i] = make(chan struct{})
+	}
+	for _, partNumber := range existing {
+		if partNumber >= 1 && partNumber <= partCount && !completed[partNumber] {
+			completed[partNumber] = true
+			close(written[partNumber-1])
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// the hashing stage reads the parts back from dst in order. since it is the only goroutine that writes to the bar,
+	// the bar shows the progress of the contiguous bytes from the start of the object.
+	hashed := make(chan struct{})
+	go func() {
+		defer close(hashed)
+
+		w := io.MultiWriter(append([]io.Writer{bar}, p.hashers()...)...)
+		buf := make([]byte, 32*1024)
+		for partNumber := int32(1); partNumber <= partCount; partNumber++ {
+			select {
+			case <-written[partNumber-1]:
+			case <-ctx.Done():
+				return
+			}
+
+			start, end := partRange(partNumber)
+			if _, err := commons.CopyBufferWithContext(ctx, w, io.NewSectionReader(dst, start, end-start+1), buf); err != nil {
+				cancel(fmt.Errorf("hash part %d error: %w", partNumber, err))
+				return
+			}
+		}
+	}()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, concurrency)
+	)
+
+	for partNumber := int32(1); partNumber <= partCount && ctx.Err() == nil; partNumber++ {
+		if completed[partNumber] {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			start, end := partRange(partNumber)
+			if err := downloadRange(ctx, client, p.getObjectInput, dst, start, end, maxRetries, limiter); err != nil {
+				cancel(fmt.Errorf("download part %d (bytes=%d-%d) error: %w", partNumber, start, end, err))
+				return
+			}
+
+			if onPart != nil {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if err := onPart(partNumber); err != nil {
+					cancel(err)
+					return
+				}
+			}
+
+			close(written[partNumber-1])
+		}()
+	}
+
+	wg.Wait()
+	<-hashed
+
+	if err = context.Cause(ctx); err != nil {
+		return fmt.Errorf("download error: %w", err)
+	}
+
+	return p.verify()
+}
+
+// downloadRange downloads the inclusive byte range of the object and writes it to the same offset in dst.
+//
+// The range is retried up to maxRetries times with exponential backoff.
+func downloadRange(ctx context.Context, client s3reader.GetObjectClient, input *s3.GetObjectInput, dst io.WriterAt, start, end int64, maxRetries int, limiter *rate.Limiter) (err error) {
+	rangeInput := *input
+	rangeInput.Range = aws.String(fmt.Sprintf("bytes=%d-%d", start, end))
+
+	for attempt := 0; ; attempt++ {
+		if err = limiter.WaitN(ctx, int(end-start+1)); err != nil {
+			return fmt.Errorf("rate limit error: %w", err)
+		}
+
+		var output *s3.GetObjectOutput
+		if output, err = client.GetObject(ctx, &rangeInput); err == nil {
+			var n int64
+			n, err = io.Copy(io.NewOffsetWriter(dst, start), output.Body)
+			_ = output.Body.Close()
+
+			if err == nil && n != end-start+1 {
+				err = io.ErrUnexpectedEOF
+			}
+			if err == nil {
+				return nil
+			}
+		}
+
+		if attempt >= maxRetries || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(time.Duration(100<<attempt) * time.Millisecond):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// parallelOptions returns the concurrency, max retries, and rate limiter of the parallel mode.
+//
+// The rate limit comes from s3reader.Options.MaxBytesInSecond in DownloadOptions.S3ReaderOptions so that the same
+// throttle applies to both modes.
+func parallelOptions(opts *DownloadOptions, partSize int64) (int, int, *rate.Limiter) {
+	readerOpts := &s3reader.Options{}
+	if opts.S3ReaderOptions != nil {
+		opts.S3ReaderOptions(readerOpts)
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if readerOpts.MaxBytesInSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(readerOpts.MaxBytesInSecond), int(partSize))
+	}
+
+	maxRetries := opts.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultDownloadMaxRetries
+	}
+
+	return max(opts.Concurrency, 1), max(maxRetries, 0), limiter
+}
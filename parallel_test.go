@@ -0,0 +1,83 @@
+package xy3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nguyengg/go-aws-commons/sri"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadParallel(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data.bin"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	data := make([]byte, 1<<20+1)
+	_, _ = rand.Read(data)
+	h := sri.NewSha256()
+	_, _ = h.Write(data)
+
+	// the second range fails twice but is retried.
+	client := &fakeObjectClient{data: data, etag: etag(data), checksum: h.SumToString(nil), failRange: "bytes=262144-524287", failCount: 2}
+	err = downloadParallel(context.Background(), client, "bucket", "key", f, &DownloadOptions{Concurrency: 4, PartSize: 256 << 10}, nil)
+	require.NoError(t, err)
+	assert.Len(t, client.ranges, 7)
+
+	got, err := os.ReadFile(f.Name())
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadParallel_ChecksumMismatch(t *testing.T) {
+	f, err := os.Create(filepath.Join(t.TempDir(), "data.bin"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	data := make([]byte, 1<<20)
+	_, _ = rand.Read(data)
+
+	client := &fakeObjectClient{data: data, etag: etag(data), checksum: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU"}
+	err = downloadParallel(context.Background(), client, "bucket", "key", f, &DownloadOptions{Concurrency: 4, PartSize: 256 << 10}, nil)
+	_, ok := IsErrChecksumMismatch(err)
+	assert.True(t, ok)
+}
+
+func TestDownloadFile_ResumeParallel(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.bin")
+
+	data := make([]byte, 1<<20)
+	_, _ = rand.Read(data)
+	h := sri.NewSha256()
+	_, _ = h.Write(data)
+
+	// the first attempt fails at the third part without retries, leaving the other parts in the partial file.
+	client := &fakeObjectClient{data: data, etag: etag(data), checksum: h.SumToString(nil), failRange: "bytes=524288-786431", failCount: 1}
+	opts := &DownloadOptions{Concurrency: 1 << 10, PartSize: 256 << 10, MaxRetries: -1}
+	err := downloadFile(context.Background(), client, "bucket", "key", name, opts)
+	require.Error(t, err)
+	assert.NoFileExists(t, name)
+	assert.FileExists(t, name+PartialExt+DownloadStateExt)
+
+	// the parts that finished before the failure are saved so the second attempt only downloads the remaining parts.
+	state, err := internal.LoadDownloadStateFromFile(name + PartialExt + DownloadStateExt)
+	require.NoError(t, err)
+	assert.NotContains(t, state.Parts, int32(3))
+
+	client.ranges = nil
+	err = downloadFile(context.Background(), client, "bucket", "key", name, opts)
+	require.NoError(t, err)
+	assert.Contains(t, client.ranges, "bytes=524288-786431")
+	assert.Len(t, client.ranges, 4-len(state.Parts))
+	assert.NoFileExists(t, name+PartialExt+DownloadStateExt)
+
+	got, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
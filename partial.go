@@ -0,0 +1,254 @@
+package xy3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/xy3/codec"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// PartialExt is the extension of the partial file that DownloadFile writes to.
+const PartialExt = ".partial"
+
+// DownloadStateExt is the extension of the file next to the partial file that identifies the S3 object being
+// downloaded.
+const DownloadStateExt = ".s3-download"
+
+// DownloadFile downloads the S3 object specified by its bucket and key to the local file with the given name.
+//
+// The contents are written to name+PartialExt first while the object's ETag and VersionId are saved to
+// name+PartialExt+DownloadStateExt. If the download fails, both files are kept so that calling DownloadFile again with
+// the same arguments resumes from the end of the partial file using ranged GetObject requests, as long as the object's
+// ETag has not changed. The existing bytes are hashed again so that checksum verification still covers the whole
+// object. Once the download completes, the partial file is renamed to name which is overwritten if it exists.
+//
+// If DownloadOptions.Concurrency is greater than 1, the parallel mode is used: the partial file is preallocated, and the
+// part numbers that have been written are also saved to the state file so that a resumed download only requests the
+// missing parts.
+//
+// If DownloadOptions.Decrypter is given, the partial file holds the encrypted contents which are only decrypted to
+// name once the download completes.
+//
+// If the object is archived and has not been restored, ErrObjectNotRestored will be returned and no file is created.
+// If the checksum mismatches, the file is still created but ErrChecksumMismatch will be returned.
+func DownloadFile(ctx context.Context, client *s3.Client, bucket, key, name string, optFns ...func(*DownloadOptions)) error {
+	opts := &DownloadOptions{}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return downloadFile(ctx, client, bucket, key, name, opts)
+}
+
+func downloadFile(ctx context.Context, client s3reader.GetAndHeadObjectClient, bucket, key, name string, opts *DownloadOptions) error {
+	partial := name + PartialExt
+	stateFile := partial + DownloadStateExt
+
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return fmt.Errorf("open partial file error: %w", err)
+	}
+	defer f.Close()
+
+	// the encrypted contents are downloaded to the partial file so that they can be resumed.
+	decrypter := opts.Decrypter
+	partialOpts := *opts
+	partialOpts.Decrypter = nil
+
+	// the partial file can only be resumed if it was downloaded from the same object.
+	loadState := func(headObjectResult *s3.HeadObjectOutput) (state internal.DownloadState, prev *internal.DownloadState, err error) {
+		state = internal.DownloadState{
+			Bucket:    bucket,
+			Key:       key,
+			ETag:      aws.ToString(headObjectResult.ETag),
+			VersionID: aws.ToString(headObjectResult.VersionId),
+			Size:      aws.ToInt64(headObjectResult.ContentLength),
+		}
+
+		switch s, err := internal.LoadDownloadStateFromFile(stateFile); {
+		case err == nil && s.SameObject(state):
+			return state, &s, nil
+		case err != nil && !errors.Is(err, fs.ErrNotExist):
+			return state, nil, err
+		default:
+			return state, nil, nil
+		}
+	}
+
+	if opts.Concurrency > 1 {
+		err = downloadParallel(ctx, client, bucket, key, f, &partialOpts, func(headObjectResult *s3.HeadObjectOutput, partSize int64) (int64, []int32, func(int32) error, error) {
+			state, prev, err := loadState(headObjectResult)
+			switch {
+			case err != nil:
+				return 0, nil, nil, err
+			case prev != nil && prev.PartSize > 0:
+				state.PartSize, state.Parts = prev.PartSize, prev.Parts
+			case prev != nil:
+				// a partial file from a sequential download has its parts that are entirely within the file complete.
+				fi, err := f.Stat()
+				if err != nil {
+					return 0, nil, nil, fmt.Errorf("stat partial file error: %w", err)
+				}
+
+				state.PartSize = partSize
+				for partNumber := int32(1); int64(partNumber-1)*partSize < state.Size && min(int64(partNumber)*partSize, state.Size) <= fi.Size(); partNumber++ {
+					state.AddPart(partNumber)
+				}
+			default:
+				if err = f.Truncate(0); err != nil {
+					return 0, nil, nil, fmt.Errorf("truncate partial file error: %w", err)
+				}
+
+				state.PartSize = partSize
+			}
+
+			if err = state.SaveToFile(stateFile); err != nil {
+				return 0, nil, nil, err
+			}
+
+			return state.PartSize, slices.Clone(state.Parts), func(partNumber int32) error {
+				state.AddPart(partNumber)
+				return state.SaveToFile(stateFile)
+			}, nil
+		})
+	} else {
+		err = download(ctx, client, bucket, key, f, &partialOpts, func(headObjectResult *s3.HeadObjectOutput) (io.Reader, int64, error) {
+			state, prev, err := loadState(headObjectResult)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			var offset int64
+			switch {
+			case prev != nil && prev.PartSize > 0:
+				// a partial file from a parallel download can only be resumed after its contiguous parts.
+				offset = prev.ContiguousSize()
+			case prev != nil:
+				fi, err := f.Stat()
+				if err != nil {
+					return nil, 0, fmt.Errorf("stat partial file error: %w", err)
+				}
+
+				offset = min(fi.Size(), state.Size)
+			}
+
+			if err = f.Truncate(offset); err != nil {
+				return nil, 0, fmt.Errorf("truncate partial file error: %w", err)
+			}
+			if _, err = f.Seek(offset, io.SeekStart); err != nil {
+				return nil, 0, fmt.Errorf("seek partial file error: %w", err)
+			}
+
+			if err = state.SaveToFile(stateFile); err != nil {
+				return nil, 0, err
+			}
+
+			return io.NewSectionReader(f, 0, offset), offset, nil
+		})
+	}
+	if _, ok := IsErrChecksumMismatch(err); err != nil && !ok {
+		// without a state file, nothing was downloaded so the partial file is not worth keeping.
+		if _, statErr := os.Stat(stateFile); errors.Is(statErr, fs.ErrNotExist) {
+			_, _ = f.Close(), os.Remove(partial)
+		}
+
+		return err
+	}
+
+	// from here on, the partial file is complete so a checksum mismatch is reported only after the file is created.
+	_ = f.Close()
+	if finishErr := finishPartialFile(partial, name, decrypter); finishErr != nil {
+		return finishErr
+	}
+
+	_ = os.Remove(stateFile)
+	return err
+}
+
+// finishPartialFile renames or decrypts the complete partial file to name.
+func finishPartialFile(partial, name string, decrypter codec.Codec) (err error) {
+	if decrypter == nil {
+		if err = os.Rename(partial, name); err != nil {
+			return fmt.Errorf("rename partial file error: %w", err)
+		}
+
+		return nil
+	}
+
+	src, err := os.Open(partial)
+	if err != nil {
+		return fmt.Errorf("open partial file error: %w", err)
+	}
+	defer src.Close()
+
+	dec, err := decrypter.NewDecoder(src)
+	if err != nil {
+		return fmt.Errorf("decrypt error: %w", err)
+	}
+	defer dec.Close()
+
+	dst, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return fmt.Errorf("create file error: %w", err)
+	}
+
+	if _, err = io.Copy(dst, dec); err == nil {
+		err = dst.Close()
+	}
+	if err != nil {
+		_, _ = dst.Close(), os.Remove(name)
+		return fmt.Errorf("decrypt error: %w", err)
+	}
+
+	_, _ = src.Close(), os.Remove(partial)
+	return nil
+}
+
+// rangeOffsetClient shifts the byte range of every GetObject request by a fixed offset.
+//
+// s3reader.Reader always reads from the first byte; with rangeOffsetClient, it reads the object as if the object
+// started at offset instead.
+type rangeOffsetClient struct {
+	s3reader.GetObjectClient
+	offset int64
+}
+
+func (c *rangeOffsetClient) GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	shifted := *input
+
+	start, end := c.offset, ""
+	if input.Range != nil {
+		v, ok := strings.CutPrefix(aws.ToString(input.Range), "bytes=")
+		if !ok {
+			return nil, fmt.Errorf(`unsupported range "%s"`, aws.ToString(input.Range))
+		}
+
+		first, last, _ := strings.Cut(v, "-")
+		n, err := strconv.ParseInt(first, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf(`unsupported range "%s"`, aws.ToString(input.Range))
+		}
+		start += n
+
+		if last != "" {
+			if n, err = strconv.ParseInt(last, 10, 64); err != nil {
+				return nil, fmt.Errorf(`unsupported range "%s"`, aws.ToString(input.Range))
+			}
+			end = strconv.FormatInt(c.offset+n, 10)
+		}
+	}
+
+	shifted.Range = aws.String(fmt.Sprintf("bytes=%d-%s", start, end))
+	return c.GetObjectClient.GetObject(ctx, &shifted, optFns...)
+}
@@ -0,0 +1,141 @@
+package xy3
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/iotest"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/go-aws-commons/sri"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFile_Resume(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.bin")
+
+	data := make([]byte, 1<<20)
+	_, _ = rand.Read(data)
+	h := sri.NewSha256()
+	_, _ = h.Write(data)
+
+	// the first attempt fails halfway, leaving the partial and state files.
+	client := &fakeObjectClient{data: data, etag: etag(data), checksum: h.SumToString(nil), failAfter: len(data) / 2}
+	err := downloadFile(context.Background(), client, "bucket", "key", name, &DownloadOptions{})
+	require.Error(t, err)
+	assert.NoFileExists(t, name)
+	assert.FileExists(t, name+PartialExt+DownloadStateExt)
+	fi, err := os.Stat(name + PartialExt)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)/2), fi.Size())
+
+	// the second attempt only downloads the remaining bytes, but the checksum still covers the whole object.
+	client.failAfter, client.ranges = 0, nil
+	err = downloadFile(context.Background(), client, "bucket", "key", name, &DownloadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=%d-%d", len(data)/2, len(data)-1)}, client.ranges)
+	assert.NoFileExists(t, name+PartialExt)
+	assert.NoFileExists(t, name+PartialExt+DownloadStateExt)
+
+	got, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadFile_ETagChanged(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.bin")
+
+	data := make([]byte, 1<<20)
+	_, _ = rand.Read(data)
+
+	client := &fakeObjectClient{data: data, etag: etag(data), failAfter: len(data) / 2}
+	err := downloadFile(context.Background(), client, "bucket", "key", name, &DownloadOptions{})
+	require.Error(t, err)
+
+	// the object was replaced so the partial file must be discarded.
+	data = bytes.Repeat([]byte("a"), len(data))
+	client.data, client.etag, client.failAfter, client.ranges = data, etag(data), 0, nil
+	err = downloadFile(context.Background(), client, "bucket", "key", name, &DownloadOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{fmt.Sprintf("bytes=0-%d", len(data)-1)}, client.ranges)
+
+	got, err := os.ReadFile(name)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(data, got))
+}
+
+func TestDownloadFile_NotRestored(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "data.bin")
+
+	client := &fakeObjectClient{data: []byte("hello"), etag: etag([]byte("hello")), storageClass: types.StorageClassDeepArchive}
+	err := downloadFile(context.Background(), client, "bucket", "key", name, &DownloadOptions{})
+	assert.ErrorIs(t, err, ErrObjectNotRestored)
+	assert.Empty(t, client.ranges)
+	assert.NoFileExists(t, name)
+	assert.NoFileExists(t, name+PartialExt)
+}
+
+// fakeObjectClient implements s3reader.GetAndHeadObjectClient in memory.
+type fakeObjectClient struct {
+	data     []byte
+	etag     string
+	checksum string
+
+	storageClass types.StorageClass
+
+	// failAfter if positive fails the GetObject response body after that many bytes.
+	failAfter int
+
+	// failRange fails the GetObject request with that range failCount times.
+	failRange string
+	failCount int
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (c *fakeObjectClient) HeadObject(_ context.Context, _ *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	output := &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(c.data))), ETag: aws.String(c.etag), StorageClass: c.storageClass}
+	if c.checksum != "" {
+		output.Metadata = map[string]string{"checksum": c.checksum}
+	}
+
+	return output, nil
+}
+
+func (c *fakeObjectClient) GetObject(_ context.Context, input *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if input.IfMatch != nil && aws.ToString(input.IfMatch) != c.etag {
+		return nil, errors.New("precondition failed")
+	}
+
+	var start, end int64
+	if _, err := fmt.Sscanf(aws.ToString(input.Range), "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.ranges = append(c.ranges, aws.ToString(input.Range))
+	if c.failCount > 0 && c.failRange == aws.ToString(input.Range) {
+		c.failCount--
+		return nil, errors.New("connection reset")
+	}
+
+	var body io.Reader = bytes.NewReader(c.data[start : end+1])
+	if c.failAfter > 0 {
+		body = io.MultiReader(io.LimitReader(body, int64(c.failAfter)), iotest.ErrReader(errors.New("connection reset")))
+	}
+
+	return &s3.GetObjectOutput{Body: io.NopCloser(body)}, nil
+}
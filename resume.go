@@ -0,0 +1,539 @@
+package xy3
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/nguyengg/go-aws-commons/s3writer"
+	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/internal"
+	"golang.org/x/time/rate"
+)
+
+// resumableUploadClient abstracts the S3 APIs that are needed to implement resumable upload.
+type resumableUploadClient interface {
+	CreateMultipartUpload(context.Context, *s3.CreateMultipartUploadInput, ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(context.Context, *s3.UploadPartInput, ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	ListParts(context.Context, *s3.ListPartsInput, ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+	CompleteMultipartUpload(context.Context, *s3.CompleteMultipartUploadInput, ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(context.Context, *s3.AbortMultipartUploadInput, ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// AbortUpload aborts the multipart upload whose state was saved to the given file by Upload with
+// UploadOptions.StateFile, then deletes the file.
+//
+// If the multipart upload no longer exists (e.g. it has expired), only the file is deleted.
+func AbortUpload(ctx context.Context, client *s3.Client, stateFile string, optFns ...func(*s3.AbortMultipartUploadInput)) error {
+	state, err := internal.LoadUploadStateFromFile(stateFile)
+	if err != nil {
+		return err
+	}
+
+	input := &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(state.Bucket),
+		Key:      aws.String(state.Key),
+		UploadId: aws.String(state.UploadID),
+	}
+	for _, fn := range optFns {
+		fn(input)
+	}
+
+	return abortResumableUpload(ctx, client, input, stateFile)
+}
+
+// abortResumableUpload aborts the multipart upload then deletes its upload state file.
+func abortResumableUpload(ctx context.Context, client resumableUploadClient, input *s3.AbortMultipartUploadInput, stateFile string) error {
+	if _, err := client.AbortMultipartUpload(ctx, input); err != nil && !isNoSuchUpload(err) {
+		return fmt.Errorf(`abort multipart upload "%s" error: %w`, aws.ToString(input.UploadId), err)
+	}
+
+	if err := os.Remove(stateFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf(`delete upload state "%s" error: %w`, stateFile, err)
+	}
+
+	return nil
+}
+
+// isNoSuchUpload returns true if the error is because the multipart upload does not exist.
+func isNoSuchUpload(err error) bool {
+	var ae smithy.APIError
+	return errors.As(err, &ae) && ae.ErrorCode() == "NoSuchUpload"
+}
+
+// canResume returns true if the upload should use uploadResumable.
+//
+// An upload is resumable if it is of a local file that is not being encrypted, and either the state file already exists
+// or the file is large enough for multipart upload.
+func canResume(src io.Reader, opts *UploadOptions) (*os.File, bool) {
+	f, ok := src.(*os.File)
+	if !ok || opts.StateFile == "" || opts.Encrypter != nil {
+		return nil, false
+	}
+
+	if _, err := os.Stat(opts.StateFile); err == nil {
+		return f, true
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, false
+	}
+
+	partSize, _, _ := resumableOptions(opts, fi.Size())
+	return f, fi.Size() > partSize
+}
+
+// resumableOptions returns the part size, concurrency, and rate limiter from UploadOptions.S3WriterOptions.
+//
+// The part size is increased if necessary so that the file can be uploaded within s3writer.MaxPartCount parts.
+func resumableOptions(opts *UploadOptions, size int64) (int64, int, *rate.Limiter) {
+	writerOpts := &s3writer.Options{
+		Concurrency: s3writer.DefaultConcurrency,
+		PartSize:    s3writer.MinPartSize,
+	}
+	if opts.S3WriterOptions != nil {
+		opts.S3WriterOptions(writerOpts)
+	}
+
+	partSize := max(writerOpts.PartSize, s3writer.MinPartSize)
+	if n := (size + s3writer.MaxPartCount - 1) / s3writer.MaxPartCount; n > partSize {
+		// round up to the nearest MiB.
+		partSize = (n + 1<<20 - 1) &^ (1<<20 - 1)
+	}
+
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if writerOpts.MaxBytesInSecond > 0 {
+		limiter = rate.NewLimiter(rate.Limit(writerOpts.MaxBytesInSecond), int(partSize))
+	}
+
+	return partSize, max(writerOpts.Concurrency, 1), limiter
+}
+
+// uploadResumable implements the resumable upload of UploadOptions.StateFile.
+//
+// If the state file does not exist, a new multipart upload is started. Otherwise, the parts that have been uploaded are
+// listed with ListParts, and only the parts that are missing or that do not match the source are uploaded. The state
+// file is updated after every part, and is deleted once the multipart upload completes. A failed upload does not abort
+// its multipart upload so that it can be resumed later.
+//
+// If the source has changed since the multipart upload was started, the multipart upload is aborted and the upload
+// starts over. The upload also starts over if the multipart upload no longer exists (e.g. it has expired).
+func uploadResumable(ctx context.Context, client resumableUploadClient, f *os.File, bucket, key string, digests []string, opts *UploadOptions) (man internal.Manifest, err error) {
+	man.Bucket, man.Key = bucket, key
+
+	source, err := internal.NewUploadSource(f)
+	if err != nil {
+		return man, err
+	}
+
+	partSize, concurrency, limiter := resumableOptions(opts, source.Size)
+
+	newPutObjectInput := func(metadata map[string]string) *s3.PutObjectInput {
+		input := &s3.PutObjectInput{
+			Bucket:            &bucket,
+			Key:               &key,
+			ChecksumAlgorithm: opts.ChecksumAlgorithm,
+			Metadata:          metadata,
+		}
+		if opts.PutObjectInputOptions != nil {
+			opts.PutObjectInputOptions(input)
+		}
+
+		return input
+	}
+
+	var (
+		putObjectInput *s3.PutObjectInput
+		state          internal.UploadState
+		listed         map[int32]types.Part
+	)
+
+	switch state, err = internal.LoadUploadStateFromFile(opts.StateFile); {
+	case err == nil:
+		if state.Bucket != bucket || state.Key != key {
+			return man, fmt.Errorf(`upload state "%s" is for "s3://%s/%s"`, opts.StateFile, state.Bucket, state.Key)
+		}
+
+		putObjectInput = newPutObjectInput(nil)
+
+		if !state.Source.Equal(source) {
+			// the uploaded parts may no longer match the source so they are discarded.
+			if err = abortResumableUpload(ctx, client, &s3.AbortMultipartUploadInput{
+				Bucket:              &bucket,
+				Key:                 &key,
+				UploadId:            &state.UploadID,
+				ExpectedBucketOwner: putObjectInput.ExpectedBucketOwner,
+			}, opts.StateFile); err != nil {
+				return man, err
+			}
+			break
+		}
+
+		if listed, err = listUploadedParts(ctx, client, state, putObjectInput); err == nil {
+			break
+		}
+		if !isNoSuchUpload(err) {
+			return man, err
+		}
+
+		// the multipart upload has expired or was aborted by someone else.
+		if err = os.Remove(opts.StateFile); err != nil {
+			return man, fmt.Errorf(`delete upload state "%s" error: %w`, opts.StateFile, err)
+		}
+
+	case errors.Is(err, os.ErrNotExist):
+		// a new multipart upload is started below.
+
+	default:
+		return man, err
+	}
+
+	if listed != nil {
+		// the primary digest must be the same as the one in S3 metadata.
+		if name, _, ok := strings.Cut(state.Checksum, "-"); ok && name != digests[0] {
+			digests = append([]string{name}, slices.DeleteFunc(slices.Clone(digests), func(v string) bool { return v == name })...)
+		}
+	} else {
+		expectedChecksum := opts.ExpectedChecksum
+		if expectedChecksum == "" {
+			// like the upload below, the checksum always covers the whole file.
+			if _, err = f.Seek(0, io.SeekStart); err != nil {
+				return man, fmt.Errorf(`seek start of "%s" error: %w`, f.Name(), err)
+			}
+
+			if _, _, expectedChecksum, err = computeChecksum(ctx, f, digests[0]); err != nil {
+				return man, fmt.Errorf("precompute checksum error: %w", err)
+			}
+		}
+
+		putObjectInput = newPutObjectInput(map[string]string{"checksum": expectedChecksum})
+		if state, err = createResumableUpload(ctx, client, putObjectInput, source, partSize); err != nil {
+			return man, err
+		}
+		state.Checksum, state.Archive = expectedChecksum, opts.StateArchive
+
+		if err = state.SaveToFile(opts.StateFile); err != nil {
+			return man, err
+		}
+	}
+
+	var (
+		alg        = types.ChecksumAlgorithm(state.ChecksumAlgorithm)
+		fullObject = types.ChecksumType(state.ChecksumType) == types.ChecksumTypeFullObject
+		s3hash     hash.Hash
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, concurrency)
+		uploadErr  error
+	)
+
+	if fullObject {
+		s3hash = internal.NewS3ChecksumHash(alg)
+	}
+
+	hashes, err := internal.NewMultiHash(digests...)
+	if err != nil {
+		return man, err
+	}
+	verifier := internal.NewMultiVerifier(state.Checksum)
+
+	bar := tspb.DefaultBytes(source.Size, fmt.Sprintf(`uploading "%s"`, internal.TruncateRightWithSuffix(filepath.Base(f.Name()), 15, "...")))
+	defer bar.Close()
+
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return man, fmt.Errorf(`seek start of "%s" error: %w`, f.Name(), err)
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// the parts are read sequentially so that the digests of the full file can be computed at the same time, while
+	// the parts that need uploading are uploaded concurrently.
+	partCount := int32((source.Size + state.PartSize - 1) / state.PartSize)
+	for partNumber := int32(1); partNumber <= partCount && ctx.Err() == nil; partNumber++ {
+		data := make([]byte, min(state.PartSize, source.Size-int64(partNumber-1)*state.PartSize))
+		if _, err = io.ReadFull(f, data); err != nil {
+			cancel(fmt.Errorf(`read part %d error: %w`, partNumber, err))
+			break
+		}
+
+		ws := []io.Writer{hashes}
+		if verifier != nil {
+			ws = append(ws, verifier)
+		}
+		if s3hash != nil {
+			ws = append(ws, s3hash)
+		}
+		_, _ = io.MultiWriter(ws...).Write(data)
+
+		digest := sha256.Sum256(data)
+		part := internal.UploadPart{
+			PartNumber: partNumber,
+			Size:       int64(len(data)),
+			Digest:     base64.StdEncoding.EncodeToString(digest[:]),
+		}
+
+		// the bar is not safe for concurrent use so it shares the lock with state.
+		mu.Lock()
+		p, ok := state.Part(partNumber)
+		if ok = ok && isPartUploaded(p, part, listed[partNumber]); ok {
+			_, _ = bar.Write(data)
+		}
+		mu.Unlock()
+
+		if ok {
+			continue
+		}
+
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := limiter.WaitN(ctx, len(data)); err != nil {
+				cancel(fmt.Errorf("upload part %d rate limit error: %w", part.PartNumber, err))
+				return
+			}
+
+			output, err := client.UploadPart(ctx, &s3.UploadPartInput{
+				Bucket:               &bucket,
+				Key:                  &key,
+				UploadId:             &state.UploadID,
+				PartNumber:           aws.Int32(part.PartNumber),
+				Body:                 bytes.NewReader(data),
+				ChecksumAlgorithm:    alg,
+				ExpectedBucketOwner:  putObjectInput.ExpectedBucketOwner,
+				SSECustomerAlgorithm: putObjectInput.SSECustomerAlgorithm,
+				SSECustomerKey:       putObjectInput.SSECustomerKey,
+				SSECustomerKeyMD5:    putObjectInput.SSECustomerKeyMD5,
+			})
+			if err != nil {
+				cancel(fmt.Errorf("upload part %d error: %w", part.PartNumber, err))
+				return
+			}
+
+			part.ETag = aws.ToString(output.ETag)
+			_, part.Checksum = internal.S3Checksums{
+				ChecksumCRC32:     output.ChecksumCRC32,
+				ChecksumCRC32C:    output.ChecksumCRC32C,
+				ChecksumCRC64NVME: output.ChecksumCRC64NVME,
+				ChecksumSHA1:      output.ChecksumSHA1,
+				ChecksumSHA256:    output.ChecksumSHA256,
+			}.Get()
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			state.SetPart(part)
+			if err = state.SaveToFile(opts.StateFile); err != nil && uploadErr == nil {
+				uploadErr = err
+			}
+
+			_, _ = bar.Write(data)
+		}()
+	}
+
+	wg.Wait()
+
+	if err = context.Cause(ctx); err != nil {
+		return man, fmt.Errorf("upload to s3 error (upload state saved to %s): %w", opts.StateFile, err)
+	}
+	if uploadErr != nil {
+		return man, uploadErr
+	}
+
+	// before completing the multipart upload, verify that the file still matches the checksum in S3 metadata.
+	if verifier != nil {
+		if expected, actual, ok := verifier.SumAndVerify(); !ok {
+			return man, &ErrChecksumMismatch{Expected: expected, Actual: actual}
+		}
+	}
+
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:               &bucket,
+		Key:                  &key,
+		UploadId:             &state.UploadID,
+		ExpectedBucketOwner:  putObjectInput.ExpectedBucketOwner,
+		MultipartUpload:      &types.CompletedMultipartUpload{},
+		SSECustomerAlgorithm: putObjectInput.SSECustomerAlgorithm,
+		SSECustomerKey:       putObjectInput.SSECustomerKey,
+		SSECustomerKeyMD5:    putObjectInput.SSECustomerKeyMD5,
+	}
+	for _, p := range state.Parts[:partCount] {
+		checksums := internal.NewS3Checksums(alg, p.Checksum)
+		input.MultipartUpload.Parts = append(input.MultipartUpload.Parts, types.CompletedPart{
+			ChecksumCRC32:     checksums.ChecksumCRC32,
+			ChecksumCRC32C:    checksums.ChecksumCRC32C,
+			ChecksumCRC64NVME: checksums.ChecksumCRC64NVME,
+			ChecksumSHA1:      checksums.ChecksumSHA1,
+			ChecksumSHA256:    checksums.ChecksumSHA256,
+			ETag:              aws.String(p.ETag),
+			PartNumber:        aws.Int32(p.PartNumber),
+		})
+	}
+	if s3hash != nil {
+		checksums := internal.NewS3Checksums(alg, base64.StdEncoding.EncodeToString(s3hash.Sum(nil)))
+		input.ChecksumCRC32 = checksums.ChecksumCRC32
+		input.ChecksumCRC32C = checksums.ChecksumCRC32C
+		input.ChecksumCRC64NVME = checksums.ChecksumCRC64NVME
+		input.ChecksumType = types.ChecksumTypeFullObject
+		input.MpuObjectSize = aws.Int64(source.Size)
+	}
+
+	output, err := client.CompleteMultipartUpload(ctx, input)
+	if err != nil {
+		return man, fmt.Errorf("complete multipart upload error (upload state saved to %s): %w", opts.StateFile, err)
+	}
+
+	if err = os.Remove(opts.StateFile); err != nil {
+		return man, fmt.Errorf(`delete upload state "%s" error: %w`, opts.StateFile, err)
+	}
+
+	sums := hashes.SumToStrings()
+	man.Size = source.Size
+	man.VersionID, man.ETag = output.VersionId, aws.ToString(output.ETag)
+	setManifestSSE(&man, putObjectInput, output.ServerSideEncryption, output.SSEKMSKeyId)
+	man.Checksum = sums[0]
+	if len(sums) > 1 {
+		man.Checksums = sums[1:]
+	}
+
+	// unlike s3writer, the default CRC32 checksum is known here so it is always recorded.
+	if checksumAlg, value := (internal.S3Checksums{
+		ChecksumCRC32:     output.ChecksumCRC32,
+		ChecksumCRC32C:    output.ChecksumCRC32C,
+		ChecksumCRC64NVME: output.ChecksumCRC64NVME,
+		ChecksumSHA1:      output.ChecksumSHA1,
+		ChecksumSHA256:    output.ChecksumSHA256,
+	}).Get(); value != "" {
+		man.S3ChecksumAlgorithm, man.S3Checksum = string(checksumAlg), value
+	}
+
+	return man, nil
+}
+
+// listUploadedParts returns the parts of the multipart upload in the upload state, keyed by part number.
+func listUploadedParts(ctx context.Context, client resumableUploadClient, state internal.UploadState, input *s3.PutObjectInput) (map[int32]types.Part, error) {
+	listed := make(map[int32]types.Part)
+
+	for paginator := s3.NewListPartsPaginator(client, &s3.ListPartsInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		UploadId:             &state.UploadID,
+		ExpectedBucketOwner:  input.ExpectedBucketOwner,
+		SSECustomerAlgorithm: input.SSECustomerAlgorithm,
+		SSECustomerKey:       input.SSECustomerKey,
+		SSECustomerKeyMD5:    input.SSECustomerKeyMD5,
+	}); paginator.HasMorePages(); {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("list parts error: %w", err)
+		}
+
+		for _, p := range page.Parts {
+			listed[aws.ToInt32(p.PartNumber)] = p
+		}
+	}
+
+	return listed, nil
+}
+
+// createResumableUpload starts a new multipart upload and returns its initial state.
+//
+// Like s3writer, if there is no checksum algorithm, CRC32 full-object checksum is used because CompleteMultipartUpload
+// would otherwise fail (see https://github.com/nguyengg/xy3/issues/1). CRC64NVME only supports full-object checksums.
+func createResumableUpload(ctx context.Context, client resumableUploadClient, input *s3.PutObjectInput, source internal.UploadSource, partSize int64) (internal.UploadState, error) {
+	alg, checksumType := input.ChecksumAlgorithm, types.ChecksumType("")
+	switch alg {
+	case "":
+		alg, checksumType = types.ChecksumAlgorithmCrc32, types.ChecksumTypeFullObject
+	case types.ChecksumAlgorithmCrc64nvme:
+		checksumType = types.ChecksumTypeFullObject
+	}
+
+	output, err := client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:                  input.Bucket,
+		Key:                     input.Key,
+		ACL:                     input.ACL,
+		BucketKeyEnabled:        input.BucketKeyEnabled,
+		CacheControl:            input.CacheControl,
+		ChecksumAlgorithm:       alg,
+		ChecksumType:            checksumType,
+		ContentDisposition:      input.ContentDisposition,
+		ContentEncoding:         input.ContentEncoding,
+		ContentLanguage:         input.ContentLanguage,
+		ContentType:             input.ContentType,
+		ExpectedBucketOwner:     input.ExpectedBucketOwner,
+		Metadata:                input.Metadata,
+		SSECustomerAlgorithm:    input.SSECustomerAlgorithm,
+		SSECustomerKey:          input.SSECustomerKey,
+		SSECustomerKeyMD5:       input.SSECustomerKeyMD5,
+		SSEKMSEncryptionContext: input.SSEKMSEncryptionContext,
+		SSEKMSKeyId:             input.SSEKMSKeyId,
+		ServerSideEncryption:    input.ServerSideEncryption,
+		StorageClass:            input.StorageClass,
+		Tagging:                 input.Tagging,
+	})
+	if err != nil {
+		return internal.UploadState{}, fmt.Errorf("create multipart upload error: %w", err)
+	}
+
+	return internal.UploadState{
+		Bucket:            aws.ToString(input.Bucket),
+		Key:               aws.ToString(input.Key),
+		UploadID:          aws.ToString(output.UploadId),
+		PartSize:          partSize,
+		ChecksumAlgorithm: string(alg),
+		ChecksumType:      string(checksumType),
+		Source:            source,
+	}, nil
+}
+
+// isPartUploaded returns true if the part in the upload state matches both the part listed by ListParts and the
+// contents of the source.
+func isPartUploaded(saved, actual internal.UploadPart, listed types.Part) bool {
+	if saved.Size != actual.Size || saved.Digest != actual.Digest {
+		return false
+	}
+
+	if aws.ToInt64(listed.Size) != saved.Size || aws.ToString(listed.ETag) != saved.ETag {
+		return false
+	}
+
+	if saved.Checksum != "" {
+		_, checksum := internal.S3Checksums{
+			ChecksumCRC32:     listed.ChecksumCRC32,
+			ChecksumCRC32C:    listed.ChecksumCRC32C,
+			ChecksumCRC64NVME: listed.ChecksumCRC64NVME,
+			ChecksumSHA1:      listed.ChecksumSHA1,
+			ChecksumSHA256:    listed.ChecksumSHA256,
+		}.Get()
+
+		return checksum == "" || checksum == saved.Checksum
+	}
+
+	return true
+}
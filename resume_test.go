@@ -0,0 +1,254 @@
+package xy3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/go-aws-commons/sri"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadResumable(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.bin")
+	stateFile := filepath.Join(dir, "data.bin.s3-upload")
+
+	data := make([]byte, 12<<20)
+	_, _ = rand.Read(data)
+	require.NoError(t, os.WriteFile(name, data, 0666))
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// the first attempt fails at part 2, leaving the state file for part 1 (and possibly part 3).
+	client := &fakeMultipartClient{failPart: 2}
+	archive := &internal.UploadArchive{ContentType: "application/zstd", Size: int64(len(data)), ZstdDictionaryID: 42}
+	opts := &UploadOptions{StateFile: stateFile, StateArchive: archive}
+	_, err = uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.Error(t, err)
+	assert.FileExists(t, stateFile)
+
+	// the archive details are kept for the resumed upload to restore.
+	state, err := internal.LoadUploadStateFromFile(stateFile)
+	require.NoError(t, err)
+	assert.Equal(t, archive, state.Archive)
+	assert.Nil(t, client.object)
+	assert.Equal(t, 1, client.uploads[1])
+
+	// the second attempt only uploads the missing parts.
+	client.failPart = 0
+	man, err := uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.NoError(t, err)
+	assert.NoFileExists(t, stateFile)
+	assert.Equal(t, 1, client.uploads[1])
+	assert.Equal(t, 1, client.uploads[2])
+	assert.True(t, bytes.Equal(data, client.object))
+
+	h := sri.NewSha256()
+	_, _ = h.Write(data)
+	assert.Equal(t, h.SumToString(nil), man.Checksum)
+	assert.Equal(t, int64(len(data)), man.Size)
+	assert.Equal(t, h.SumToString(nil), client.metadata["checksum"])
+	assert.Equal(t, "AES256", man.SSE)
+}
+
+func TestUploadResumable_SourceChanged(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.bin")
+	stateFile := filepath.Join(dir, "data.bin.s3-upload")
+
+	data := make([]byte, 6<<20)
+	require.NoError(t, os.WriteFile(name, data, 0666))
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	client := &fakeMultipartClient{failPart: 2}
+	opts := &UploadOptions{StateFile: stateFile}
+	_, err = uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.Error(t, err)
+
+	// the multipart upload of the old contents is aborted and the upload starts over.
+	client.failPart = 0
+	data = append(data, 'a')
+	require.NoError(t, os.WriteFile(name, data, 0666))
+	_, err = uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.NoError(t, err)
+	assert.NoFileExists(t, stateFile)
+	assert.Equal(t, []string{"upload-1"}, client.aborted)
+	assert.Equal(t, "upload-2", client.uploadID)
+	assert.True(t, bytes.Equal(data, client.object))
+}
+
+func TestUploadResumable_NoSuchUpload(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "data.bin")
+	stateFile := filepath.Join(dir, "data.bin.s3-upload")
+
+	data := make([]byte, 6<<20)
+	_, _ = rand.Read(data)
+	require.NoError(t, os.WriteFile(name, data, 0666))
+
+	f, err := os.Open(name)
+	require.NoError(t, err)
+	defer f.Close()
+
+	client := &fakeMultipartClient{failPart: 2}
+	opts := &UploadOptions{StateFile: stateFile}
+	_, err = uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.Error(t, err)
+
+	// an expired multipart upload cannot be aborted so the upload just starts over.
+	client.failPart, client.uploadID = 0, ""
+	_, err = uploadResumable(context.Background(), client, f, "bucket", "key", []string{"sha256"}, opts)
+	require.NoError(t, err)
+	assert.NoFileExists(t, stateFile)
+	assert.Empty(t, client.aborted)
+	assert.Equal(t, "upload-2", client.uploadID)
+	assert.True(t, bytes.Equal(data, client.object))
+}
+
+// fakeMultipartClient implements resumableUploadClient in memory.
+type fakeMultipartClient struct {
+	failPart int32
+
+	mu       sync.Mutex
+	uploadID string
+	created  int
+	aborted  []string
+	parts    map[int32][]byte
+	uploads  map[int32]int
+	done     map[int32]chan struct{}
+	metadata map[string]string
+	object   []byte
+}
+
+func (c *fakeMultipartClient) CreateMultipartUpload(_ context.Context, input *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	c.created++
+	c.uploadID = fmt.Sprintf("upload-%d", c.created)
+	c.parts, c.uploads, c.done, c.metadata = make(map[int32][]byte), make(map[int32]int), make(map[int32]chan struct{}), input.Metadata
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String(c.uploadID)}, nil
+}
+
+func (c *fakeMultipartClient) UploadPart(ctx context.Context, input *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	partNumber := aws.ToInt32(input.PartNumber)
+	if partNumber == c.failPart {
+		// wait for the previous part so that the failure does not cancel it before it starts.
+		if partNumber > 1 {
+			select {
+			case <-c.partDone(partNumber - 1):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(5 * time.Second):
+				return nil, fmt.Errorf("timed out waiting for part %d", partNumber-1)
+			}
+		}
+
+		return nil, errors.New("connection reset")
+	}
+
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.parts[partNumber] = data
+	c.uploads[partNumber]++
+
+	if done := c.partDoneLocked(partNumber); c.uploads[partNumber] == 1 {
+		close(done)
+	}
+
+	return &s3.UploadPartOutput{ETag: aws.String(etag(data))}, nil
+}
+
+// partDone returns the channel that is closed once the given part has been uploaded.
+func (c *fakeMultipartClient) partDone(partNumber int32) chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.partDoneLocked(partNumber)
+}
+
+func (c *fakeMultipartClient) partDoneLocked(partNumber int32) chan struct{} {
+	done, ok := c.done[partNumber]
+	if !ok {
+		done = make(chan struct{})
+		c.done[partNumber] = done
+	}
+
+	return done
+}
+
+func (c *fakeMultipartClient) ListParts(_ context.Context, input *s3.ListPartsInput, _ ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if aws.ToString(input.UploadId) != c.uploadID {
+		return nil, &types.NoSuchUpload{}
+	}
+
+	output := &s3.ListPartsOutput{}
+	for partNumber, data := range c.parts {
+		output.Parts = append(output.Parts, types.Part{
+			ETag:       aws.String(etag(data)),
+			PartNumber: aws.Int32(partNumber),
+			Size:       aws.Int64(int64(len(data))),
+		})
+	}
+
+	return output, nil
+}
+
+func (c *fakeMultipartClient) CompleteMultipartUpload(_ context.Context, input *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	var object []byte
+	for _, p := range input.MultipartUpload.Parts {
+		data, ok := c.parts[aws.ToInt32(p.PartNumber)]
+		if !ok || etag(data) != aws.ToString(p.ETag) {
+			return nil, errors.New("invalid part")
+		}
+
+		object = append(object, data...)
+	}
+
+	// like S3, the bucket's default encryption is applied to objects uploaded without encryption settings.
+	c.object = object
+	return &s3.CompleteMultipartUploadOutput{ServerSideEncryption: types.ServerSideEncryptionAes256}, nil
+}
+
+func (c *fakeMultipartClient) AbortMultipartUpload(_ context.Context, input *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if aws.ToString(input.UploadId) != c.uploadID {
+		return nil, &types.NoSuchUpload{}
+	}
+
+	c.aborted = append(c.aborted, c.uploadID)
+	c.uploadID, c.parts = "", nil
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
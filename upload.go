@@ -2,16 +2,21 @@ package xy3
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
+	"hash"
 	"io"
 	"os"
 	"path/filepath"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	commons "github.com/nguyengg/go-aws-commons"
 	"github.com/nguyengg/go-aws-commons/s3writer"
 	"github.com/nguyengg/go-aws-commons/sri"
 	"github.com/nguyengg/go-aws-commons/tspb"
+	"github.com/nguyengg/xy3/codec"
 	"github.com/nguyengg/xy3/internal"
 )
 
@@ -25,6 +30,12 @@ type UploadOptions struct {
 	// Useful if you need to add ExpectedBucketOwner or StorageClass.
 	PutObjectInputOptions func(*s3.PutObjectInput)
 
+	// Digests are the digest algorithms such as sha256, sha384, sha512, or blake3 (see internal.NewDigest).
+	//
+	// The first algorithm is the primary one whose digest is added to S3 metadata "checksum" and used as the
+	// manifest's Checksum, while the digests of the others are added to the manifest's Checksums. Default to sha256.
+	Digests []string
+
 	// ExpectedChecksum can be given to skip precomputing process.
 	//
 	// However, another checksum is still computed during uploading itself, and if this checksum doesn't match the
@@ -36,6 +47,39 @@ type UploadOptions struct {
 	// Should be given if ExpectedChecksum is also given, since computing the checksum is going to read the entire
 	// file anyway. Nothing happens if the final upload size doesn't match ExpectedSize.
 	ExpectedSize int64
+
+	// ChecksumAlgorithm is the S3 additional checksum algorithm such as SHA256, CRC32C, or CRC64NVME.
+	//
+	// Multipart uploads include the checksum of every part so that S3 can validate them. The checksum that S3 reports
+	// for the object is returned in the manifest (see internal.Manifest.S3Checksum). PutObjectInputOptions can still
+	// override this by setting s3.PutObjectInput.ChecksumAlgorithm.
+	ChecksumAlgorithm types.ChecksumAlgorithm
+
+	// StateFile if given makes the upload of an *os.File resumable.
+	//
+	// The state of the multipart upload is saved to StateFile after every part. If the upload fails or is
+	// interrupted, the multipart upload is not aborted so its parts are still stored (and billed) until calling
+	// Upload again with the same StateFile resumes it, or AbortUpload gives up on it. Only give StateFile if the
+	// upload is meant to be resumed; without StateFile, failed multipart uploads are always aborted.
+	//
+	// When resuming, the uploaded parts are validated against the file and ListParts, and only the missing parts are
+	// uploaded. If the file has changed or the multipart upload no longer exists, the upload starts over instead.
+	// StateFile is deleted once the upload completes. StateFile is ignored if the file is small enough for PutObject
+	// or if Encrypter is given, since encryption is not deterministic.
+	StateFile string
+
+	// Encrypter if given encodes the contents on the fly before they are uploaded (e.g. codec.AgeCodec).
+	//
+	// Because encryption is not deterministic, no checksum is precomputed and ExpectedChecksum is ignored. The
+	// checksum and size in the returned manifest are those of the encrypted object, while the caller is responsible
+	// for recording how the object was encrypted (see internal.Manifest.Encryption).
+	Encrypter codec.Codec
+
+	// StateArchive if given is recorded in a new StateFile (see internal.UploadState.Archive).
+	//
+	// Useful if the file is an archive compressed from a directory so that resuming can restore the details of the
+	// archive without compressing the directory again.
+	StateArchive *internal.UploadArchive
 }
 
 // Upload uploads the given io.Reader contents to S3 and produces a manifest for the uploaded object.
@@ -46,6 +90,9 @@ type UploadOptions struct {
 // be different from the S3 metadata checksum if the src io.Reader is not returning the same bytes for both passes.
 //
 // If src does not implement io.ReadSeeker, the checksum is only included in the returned manifest.
+//
+// The returned manifest records the server-side encryption that S3 applied to the object, which is the bucket's default
+// encryption if the upload did not request any.
 func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key string, optFns ...func(*UploadOptions)) (man internal.Manifest, err error) {
 	opts := &UploadOptions{}
 	for _, fn := range optFns {
@@ -54,12 +101,43 @@ func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key s
 
 	man.Bucket, man.Key = bucket, key
 
+	digests, err := internal.ParseDigestAlgorithms(opts.Digests)
+	if err != nil {
+		return man, err
+	}
+
+	if f, ok := canResume(src, opts); ok {
+		return uploadResumable(ctx, client, f, bucket, key, digests, opts)
+	}
+
+	if opts.Encrypter != nil {
+		pr, pw := io.Pipe()
+		defer pr.Close()
+
+		go func(src io.Reader) {
+			w, err := opts.Encrypter.NewEncoder(pw)
+			if err == nil {
+				if _, err = commons.CopyBufferWithContext(ctx, w, src, nil); err == nil {
+					err = w.Close()
+				} else {
+					_ = w.Close()
+				}
+			}
+
+			_ = pw.CloseWithError(err)
+		}(src)
+
+		src = pr
+		opts.ExpectedChecksum = ""
+	}
+
 	var (
 		name             string
 		size             int64 = -1
 		sizer                  = &commons.Sizer{}
 		expectedChecksum       = opts.ExpectedChecksum
-		verifier         sri.Verifier
+		verifier         *internal.MultiVerifier
+		checksummer      sri.Hash
 		bar              io.WriteCloser
 	)
 
@@ -70,25 +148,51 @@ func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key s
 		size = opts.ExpectedSize
 	}
 	if expectedChecksum == "" {
-		if name, size, expectedChecksum, err = computeChecksum(ctx, src); err != nil {
+		var n int64
+		if name, n, expectedChecksum, err = computeChecksum(ctx, src, digests[0]); err != nil {
 			return man, fmt.Errorf("precompute checksum error: %w", err)
+		} else if n >= 0 {
+			size = n
 		}
 	}
 
-	if verifier, _ = sri.NewVerifier(expectedChecksum); verifier == nil {
+	// if src is not an io.ReadSeeker, there is no expected checksum to verify against so the primary digest is only
+	// computed for the manifest.
+	if expectedChecksum == "" {
+		checksummer = internal.NewDigest(digests[0])
+	} else if verifier = internal.NewMultiVerifier(expectedChecksum); verifier == nil {
 		return man, fmt.Errorf("unknown expected checksum: %s", expectedChecksum)
 	}
 
 	putObjectInput := &s3.PutObjectInput{
-		Bucket:   &bucket,
-		Key:      &key,
-		Metadata: map[string]string{"checksum": expectedChecksum},
+		Bucket:            &bucket,
+		Key:               &key,
+		ChecksumAlgorithm: opts.ChecksumAlgorithm,
+	}
+	if expectedChecksum != "" {
+		putObjectInput.Metadata = map[string]string{"checksum": expectedChecksum}
 	}
 
 	if opts.PutObjectInputOptions != nil {
 		opts.PutObjectInputOptions(putObjectInput)
 	}
 
+	// the S3 checksum of the full object is only needed if PutObject ends up being used instead of multipart upload;
+	// otherwise, CompleteMultipartUpload's response has the checksum.
+	var (
+		s3hash       hash.Hash
+		writerClient s3writer.WriterClient = client
+	)
+	if alg := putObjectInput.ChecksumAlgorithm; alg != "" {
+		if s3hash = internal.NewS3ChecksumHash(alg); s3hash == nil {
+			return man, fmt.Errorf("unsupported S3 checksum algorithm: %s", alg)
+		}
+
+		if alg == types.ChecksumAlgorithmCrc64nvme {
+			writerClient = crc64NVMEWriterClient{client}
+		}
+	}
+
 	// now upload to s3. wrap the original context so that if verifying checksum fails, we'll cancel the context
 	// to force the AbortMultipartUpload to be called.
 	ctx, cancel := context.WithCancel(ctx)
@@ -101,7 +205,10 @@ func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key s
 	}
 	defer bar.Close()
 
-	w, err := s3writer.New(ctx, client, putObjectInput, func(s3writerOpts *s3writer.Options) {
+	// s3writer does not expose PutObject's response so the version and ETag are captured by the client instead.
+	resultClient := &resultWriterClient{WriterClient: writerClient}
+
+	w, err := s3writer.New(ctx, resultClient, putObjectInput, func(s3writerOpts *s3writer.Options) {
 		if opts.S3WriterOptions != nil {
 			opts.S3WriterOptions(s3writerOpts)
 		}
@@ -110,21 +217,45 @@ func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key s
 		return man, fmt.Errorf("create s3 writer error: %w", err)
 	}
 
-	_, err = w.ReadFrom(io.TeeReader(src, io.MultiWriter(bar, sizer, verifier)))
+	// the additional digests are only computed during upload.
+	var additional *internal.MultiHash
+	if len(digests) > 1 {
+		if additional, err = internal.NewMultiHash(digests[1:]...); err != nil {
+			return man, err
+		}
+	}
+
+	ws := []io.Writer{bar, sizer}
+	if verifier != nil {
+		ws = append(ws, verifier)
+	} else {
+		ws = append(ws, checksummer)
+	}
+	if additional != nil {
+		ws = append(ws, additional)
+	}
+	if s3hash != nil {
+		ws = append(ws, s3hash)
+	}
+
+	_, err = w.ReadFrom(io.TeeReader(src, io.MultiWriter(ws...)))
 	if err != nil {
 		return man, fmt.Errorf("upload to s3 error: %w", err)
 	}
 
 	// before closing and finishing multipart upload, let's verify checksum one more time.
 	// if this verification fails, don't complete the multipart upload.
-	if !verifier.SumAndVerify(nil) {
-		cancel()
-		_ = w.Close()
+	if verifier != nil {
+		if expected, actual, ok := verifier.SumAndVerify(); !ok {
+			cancel()
+			_ = w.Close()
 
-		return man, &ErrChecksumMismatch{
-			Expected: opts.ExpectedChecksum,
-			Actual:   verifier.SumToString(nil),
+			return man, &ErrChecksumMismatch{Expected: expected, Actual: actual}
 		}
+
+		man.Checksum = expectedChecksum
+	} else {
+		man.Checksum = checksummer.SumToString(nil)
 	}
 
 	if err = w.Close(); err != nil {
@@ -132,11 +263,94 @@ func Upload(ctx context.Context, client *s3.Client, src io.Reader, bucket, key s
 	}
 
 	man.Size = sizer.Size
-	man.Checksum = verifier.SumToString(nil)
+	man.VersionID, man.ETag = resultClient.versionID, resultClient.etag
+	setManifestSSE(&man, putObjectInput, resultClient.serverSideEncryption, resultClient.sseKMSKeyID)
+	if additional != nil {
+		man.Checksums = additional.SumToStrings()
+	}
+
+	if s3hash != nil {
+		man.S3ChecksumAlgorithm = string(putObjectInput.ChecksumAlgorithm)
+
+		if out := w.GetCompleteMultipartUploadOutput(); out != nil {
+			_, man.S3Checksum = internal.S3Checksums{
+				ChecksumCRC32:     out.ChecksumCRC32,
+				ChecksumCRC32C:    out.ChecksumCRC32C,
+				ChecksumCRC64NVME: out.ChecksumCRC64NVME,
+				ChecksumSHA1:      out.ChecksumSHA1,
+				ChecksumSHA256:    out.ChecksumSHA256,
+			}.Get()
+		} else {
+			man.S3Checksum = base64.StdEncoding.EncodeToString(s3hash.Sum(nil))
+		}
+	}
+
 	return
 }
 
-func computeChecksum(ctx context.Context, src io.Reader) (string, int64, string, error) {
+// crc64NVMEWriterClient removes the CRC64NVME checksum that s3writer computes for PutObject and CompleteMultipartUpload.
+//
+// s3writer builds its CRC-64/NVME table from the non-reflected polynomial so its checksums would be rejected by S3.
+// Without the value, the SDK computes the checksum for PutObject, while S3 combines the checksums of the parts (which
+// the SDK computes for UploadPart) for CompleteMultipartUpload.
+type crc64NVMEWriterClient struct {
+	s3writer.WriterClient
+}
+
+func (c crc64NVMEWriterClient) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	input.ChecksumCRC64NVME = nil
+	return c.WriterClient.PutObject(ctx, input, optFns...)
+}
+
+func (c crc64NVMEWriterClient) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	input.ChecksumCRC64NVME = nil
+	return c.WriterClient.CompleteMultipartUpload(ctx, input, optFns...)
+}
+
+// resultWriterClient records the VersionId, ETag, and server-side encryption of the object created by either PutObject
+// or CompleteMultipartUpload.
+type resultWriterClient struct {
+	s3writer.WriterClient
+	versionID            *string
+	etag                 string
+	serverSideEncryption types.ServerSideEncryption
+	sseKMSKeyID          *string
+}
+
+func (c *resultWriterClient) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	output, err := c.WriterClient.PutObject(ctx, input, optFns...)
+	if err == nil {
+		c.versionID, c.etag = output.VersionId, aws.ToString(output.ETag)
+		c.serverSideEncryption, c.sseKMSKeyID = output.ServerSideEncryption, output.SSEKMSKeyId
+	}
+
+	return output, err
+}
+
+func (c *resultWriterClient) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	output, err := c.WriterClient.CompleteMultipartUpload(ctx, input, optFns...)
+	if err == nil {
+		c.versionID, c.etag = output.VersionId, aws.ToString(output.ETag)
+		c.serverSideEncryption, c.sseKMSKeyID = output.ServerSideEncryption, output.SSEKMSKeyId
+	}
+
+	return output, err
+}
+
+// setManifestSSE records the server-side encryption of the uploaded object in the manifest.
+//
+// Objects encrypted with a customer-provided key are identified by the key's MD5 from the request since
+// CompleteMultipartUpload does not return it. Otherwise, the encryption comes from S3's response.
+func setManifestSSE(man *internal.Manifest, input *s3.PutObjectInput, sse types.ServerSideEncryption, sseKMSKeyID *string) {
+	if input.SSECustomerAlgorithm != nil {
+		man.SSE, man.SSEKMSKeyID, man.SSECustomerKeyMD5 = internal.SSECustomer, "", aws.ToString(input.SSECustomerKeyMD5)
+		return
+	}
+
+	man.SSE, man.SSEKMSKeyID, man.SSECustomerKeyMD5 = string(sse), aws.ToString(sseKMSKeyID), ""
+}
+
+func computeChecksum(ctx context.Context, src io.Reader, digest string) (string, int64, string, error) {
 	rs, ok := src.(io.ReadSeeker)
 	if !ok {
 		return "", -1, "", nil
@@ -146,7 +360,7 @@ func computeChecksum(ctx context.Context, src io.Reader) (string, int64, string,
 		name        string
 		size        int64 = -1
 		sizer             = &commons.Sizer{}
-		checksummer       = internal.DefaultChecksum()
+		checksummer       = internal.NewDigest(digest)
 		bar         io.WriteCloser
 	)
 
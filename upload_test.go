@@ -0,0 +1,66 @@
+package xy3
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpload_Blake3(t *testing.T) {
+	data := []byte("hello, world!")
+	h := internal.NewDigest("blake3")
+	_, _ = h.Write(data)
+	checksum := h.SumToString(nil)
+
+	// small objects are uploaded with a single PutObject.
+	var metadata string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/bucket/key" {
+			w.WriteHeader(http.StatusNotImplemented)
+			return
+		}
+
+		_, _ = io.Copy(io.Discard, r.Body)
+		metadata = r.Header.Get("x-amz-meta-checksum")
+		w.Header().Set("ETag", `"etag"`)
+	}))
+	defer server.Close()
+
+	client := s3.New(s3.Options{
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKID", "SECRET", ""),
+		Region:       "us-east-1",
+		UsePathStyle: true,
+	})
+
+	man, err := Upload(t.Context(), client, bytes.NewReader(data), "bucket", "key", func(opts *UploadOptions) {
+		opts.Digests = []string{"blake3", "sha256"}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, checksum, man.Checksum)
+	assert.Equal(t, checksum, metadata)
+	assert.Equal(t, int64(len(data)), man.Size)
+	assert.Len(t, man.Checksums, 1)
+}
+
+func TestSetManifestSSE(t *testing.T) {
+	// the response has the encryption that S3 applied, even if the request had none.
+	man := internal.Manifest{}
+	setManifestSSE(&man, &s3.PutObjectInput{}, types.ServerSideEncryptionAwsKms, aws.String("key-id"))
+	assert.Equal(t, internal.Manifest{SSE: "aws:kms", SSEKMSKeyID: "key-id"}, man)
+
+	// customer-provided keys come from the request.
+	man = internal.Manifest{}
+	setManifestSSE(&man, &s3.PutObjectInput{SSECustomerAlgorithm: aws.String("AES256"), SSECustomerKeyMD5: aws.String("md5")}, "", nil)
+	assert.Equal(t, internal.Manifest{SSE: internal.SSECustomer, SSECustomerKeyMD5: "md5"}, man)
+}
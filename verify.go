@@ -0,0 +1,216 @@
+package xy3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/nguyengg/go-aws-commons/s3reader"
+	"github.com/nguyengg/xy3/internal"
+)
+
+// ErrNoS3Checksum is returned by VerifyS3Checksum if either the manifest or the S3 object has no S3 additional
+// checksum, in which case the object must be downloaded to be verified.
+var ErrNoS3Checksum = errors.New("no S3 additional checksum")
+
+// GetS3Checksum uses GetObjectAttributes to return the S3 additional checksum and size of an object without downloading
+// it.
+//
+// The checksum is returned in the same format as HeadObject and CompleteMultipartUpload return it (see
+// internal.Manifest.S3Checksum). The optFns can be used to add ExpectedBucketOwner or SSE-C headers.
+func GetS3Checksum(ctx context.Context, client *s3.Client, bucket, key string, optFns ...func(*s3.GetObjectAttributesInput)) (alg types.ChecksumAlgorithm, value string, size int64, err error) {
+	input := &s3.GetObjectAttributesInput{
+		Bucket: &bucket,
+		Key:    &key,
+		ObjectAttributes: []types.ObjectAttributes{
+			types.ObjectAttributesChecksum,
+			types.ObjectAttributesObjectParts,
+			types.ObjectAttributesObjectSize,
+		},
+	}
+	for _, fn := range optFns {
+		fn(input)
+	}
+
+	output, err := client.GetObjectAttributes(ctx, input)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("get object attributes error: %w", err)
+	}
+
+	size = aws.ToInt64(output.ObjectSize)
+	if output.Checksum == nil {
+		return "", "", size, nil
+	}
+
+	alg, value = internal.S3Checksums{
+		ChecksumCRC32:     output.Checksum.ChecksumCRC32,
+		ChecksumCRC32C:    output.Checksum.ChecksumCRC32C,
+		ChecksumCRC64NVME: output.Checksum.ChecksumCRC64NVME,
+		ChecksumSHA1:      output.Checksum.ChecksumSHA1,
+		ChecksumSHA256:    output.Checksum.ChecksumSHA256,
+	}.Get()
+
+	// unlike HeadObject, GetObjectAttributes returns the number of parts separately.
+	if output.Checksum.ChecksumType == types.ChecksumTypeComposite && output.ObjectParts != nil && !strings.Contains(value, "-") {
+		if n := aws.ToInt32(output.ObjectParts.TotalPartsCount); n > 0 {
+			value = fmt.Sprintf("%s-%d", value, n)
+		}
+	}
+
+	return
+}
+
+// VerifyS3Checksum compares the S3 additional checksum and size in the manifest against those of the S3 object.
+//
+// Because only GetObjectAttributes is used, the verification is cheap but relies on S3 having validated the checksum
+// upon upload. If the manifest or the object has no S3 additional checksum, ErrNoS3Checksum is returned. If the
+// checksums do not match, ErrChecksumMismatch is returned.
+func VerifyS3Checksum(ctx context.Context, client *s3.Client, man internal.Manifest, optFns ...func(*s3.GetObjectAttributesInput)) error {
+	if man.S3Checksum == "" {
+		return ErrNoS3Checksum
+	}
+
+	// the manifest's version is checked rather than the latest version.
+	optFns = append([]func(*s3.GetObjectAttributesInput){func(input *s3.GetObjectAttributesInput) {
+		input.VersionId = man.VersionID
+	}}, optFns...)
+
+	alg, value, size, err := GetS3Checksum(ctx, client, man.Bucket, man.Key, optFns...)
+	if err != nil {
+		return err
+	}
+
+	if man.Size != 0 && man.Size != size {
+		return fmt.Errorf("size does not match: expect %d, got %d", man.Size, size)
+	}
+
+	if value == "" {
+		return ErrNoS3Checksum
+	}
+
+	if string(alg) != man.S3ChecksumAlgorithm || value != man.S3Checksum {
+		return &ErrChecksumMismatch{
+			Expected: internal.FormatS3Checksum(types.ChecksumAlgorithm(man.S3ChecksumAlgorithm), man.S3Checksum),
+			Actual:   internal.FormatS3Checksum(alg, value),
+		}
+	}
+
+	return nil
+}
+
+// ErrObjectNotFound is returned by Verify if the object (or the manifest's version of the object) does not exist.
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrObjectChanged is returned by Verify if the size or ETag of the object does not match the manifest.
+var ErrObjectChanged = errors.New("object does not match manifest")
+
+// ErrUnverifiable is returned by Verify if neither the manifest nor the object has anything to verify the object's
+// contents against, or if the object cannot be downloaded (see ErrObjectNotRestored) in deep mode.
+var ErrUnverifiable = errors.New("object cannot be verified")
+
+// VerifyOptions customises Verify.
+type VerifyOptions struct {
+	// Deep downloads the object to compute its checksums instead of only comparing its metadata.
+	Deep bool
+
+	// DownloadOptions customises the HeadObject request of both modes and the download of deep mode.
+	//
+	// Useful for WithExpectedBucketOwner and WithSSECustomerKey. The manifest's version is always used.
+	DownloadOptions []func(*DownloadOptions)
+}
+
+// Verify checks that the S3 object still matches the manifest.
+//
+// By default, only HeadObject is used to compare the size, ETag, checksum metadata, and S3 additional checksum against
+// those in the manifest. With VerifyOptions.Deep, the object is also downloaded (and discarded) to compute its
+// checksums which are compared against those in the manifest.
+//
+// Returns ErrObjectNotFound if the object is missing, ErrObjectChanged or ErrChecksumMismatch if the object does not
+// match, or ErrUnverifiable if there is nothing to verify against.
+func Verify(ctx context.Context, client *s3.Client, man internal.Manifest, optFns ...func(*VerifyOptions)) error {
+	opts := &VerifyOptions{}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	return verify(ctx, client, man, opts)
+}
+
+func verify(ctx context.Context, client s3reader.GetAndHeadObjectClient, man internal.Manifest, opts *VerifyOptions) error {
+	downloadOpts := &DownloadOptions{}
+	for _, fn := range append(opts.DownloadOptions, WithVersionID(man.VersionID)) {
+		fn(downloadOpts)
+	}
+
+	headObjectInput := &s3.HeadObjectInput{Bucket: &man.Bucket, Key: &man.Key, ChecksumMode: types.ChecksumModeEnabled}
+	if downloadOpts.HeadObjectInputOptions != nil {
+		downloadOpts.HeadObjectInputOptions(headObjectInput)
+	}
+
+	headObjectResult, err := client.HeadObject(ctx, headObjectInput)
+	if err != nil {
+		var re *awshttp.ResponseError
+		if errors.As(err, &re) && re.HTTPStatusCode() == 404 {
+			return fmt.Errorf("head object error: %w", ErrObjectNotFound)
+		}
+
+		return fmt.Errorf("head object error: %w", err)
+	}
+
+	if size := aws.ToInt64(headObjectResult.ContentLength); man.Size != 0 && man.Size != size {
+		return fmt.Errorf("size does not match: expect %d, got %d: %w", man.Size, size, ErrObjectChanged)
+	}
+
+	// verified becomes true once the contents have been compared by one of the checksums.
+	verified := false
+
+	if etag := aws.ToString(headObjectResult.ETag); man.ETag != "" && etag != "" {
+		if man.ETag != etag {
+			return fmt.Errorf("etag does not match: expect %s, got %s: %w", man.ETag, etag, ErrObjectChanged)
+		}
+		verified = true
+	}
+
+	if checksum := headObjectResult.Metadata["checksum"]; man.Checksum != "" && checksum != "" {
+		if man.Checksum != checksum {
+			return &ErrChecksumMismatch{Expected: man.Checksum, Actual: checksum}
+		}
+		verified = true
+	}
+
+	if alg, value := internal.S3ChecksumsFromHeadObject(headObjectResult).Get(); man.S3Checksum != "" && value != "" {
+		if string(alg) != man.S3ChecksumAlgorithm || value != man.S3Checksum {
+			return &ErrChecksumMismatch{
+				Expected: internal.FormatS3Checksum(types.ChecksumAlgorithm(man.S3ChecksumAlgorithm), man.S3Checksum),
+				Actual:   internal.FormatS3Checksum(alg, value),
+			}
+		}
+		verified = true
+	}
+
+	if !opts.Deep {
+		if !verified {
+			return ErrUnverifiable
+		}
+
+		return nil
+	}
+
+	// the download verifies the manifest's digests as well as the object's own S3 additional checksum.
+	if man.Checksum == "" && len(man.Checksums) == 0 && man.S3Checksum == "" {
+		return ErrUnverifiable
+	}
+
+	downloadOpts.ExpectedChecksum, downloadOpts.ExpectedChecksums = man.Checksum, man.Checksums
+	if err = download(ctx, client, man.Bucket, man.Key, io.Discard, downloadOpts, nil); errors.Is(err, ErrObjectNotRestored) {
+		return fmt.Errorf("%w: %w", ErrUnverifiable, err)
+	}
+
+	return err
+}
@@ -0,0 +1,46 @@
+package xy3
+
+import (
+	"context"
+	"crypto/rand"
+	"testing"
+
+	"github.com/nguyengg/go-aws-commons/sri"
+	"github.com/nguyengg/xy3/internal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerify(t *testing.T) {
+	data := make([]byte, 1<<20)
+	_, _ = rand.Read(data)
+	h := sri.NewSha256()
+	_, _ = h.Write(data)
+	checksum := h.SumToString(nil)
+
+	client := &fakeObjectClient{data: data, etag: etag(data), checksum: checksum}
+	man := internal.Manifest{Bucket: "bucket", Key: "key", Size: int64(len(data)), Checksum: checksum, ETag: etag(data)}
+
+	// the cheap mode only needs HeadObject.
+	assert.NoError(t, verify(context.Background(), client, man, &VerifyOptions{}))
+	assert.Empty(t, client.ranges)
+
+	// the deep mode downloads the object.
+	assert.NoError(t, verify(context.Background(), client, man, &VerifyOptions{Deep: true}))
+	assert.NotEmpty(t, client.ranges)
+
+	changed := man
+	changed.ETag = `"other"`
+	assert.ErrorIs(t, verify(context.Background(), client, changed, &VerifyOptions{}), ErrObjectChanged)
+
+	changed = man
+	changed.Size++
+	assert.ErrorIs(t, verify(context.Background(), client, changed, &VerifyOptions{}), ErrObjectChanged)
+
+	// without ETag and checksum metadata, only the deep mode can detect that the contents differ.
+	changed = internal.Manifest{Bucket: "bucket", Key: "key", Checksum: "sha256-47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}
+	client.checksum = ""
+	client.etag = ""
+	assert.ErrorIs(t, verify(context.Background(), client, changed, &VerifyOptions{}), ErrUnverifiable)
+	_, ok := IsErrChecksumMismatch(verify(context.Background(), client, changed, &VerifyOptions{Deep: true}))
+	assert.True(t, ok)
+}
@@ -0,0 +1,464 @@
+package zipper
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	commons "github.com/nguyengg/go-aws-commons"
+	"github.com/nguyengg/xy3/archive"
+)
+
+// ErrFileExists is returned by Append if a file to be added already exists in the archive.
+var ErrFileExists = errors.New("file already exists in archive")
+
+// AppendOptions customises Append and Update.
+type AppendOptions struct {
+	CompressOptions
+
+	// StorePolicy decides which new files are written with zip.Store instead of zip.Deflate.
+	//
+	// Default to archive.DefaultStorePolicy.
+	StorePolicy archive.StorePolicy
+
+	// StoreStats if given will be updated with statistics about the new files that are stored and compressed.
+	StoreStats *archive.StoreStats
+}
+
+// Append adds the named files and directories to an existing zip archive.
+//
+// Files are added using their base names, while directories are added recursively with their base names as the root
+// directory (similar to CompressDir with CompressDirOptions.UnwrapRoot being false). If any of the files to be added
+// already exists in the archive, ErrFileExists is returned and the archive is left untouched. Use Update to replace
+// those files instead.
+//
+// See Update for how the archive is updated.
+func Append(ctx context.Context, archiveName string, names []string, optFns ...func(*AppendOptions)) error {
+	return update(ctx, archiveName, names, false, optFns...)
+}
+
+// Update adds or replaces the named files and directories in an existing zip archive.
+//
+// If none of the files replaces an existing entry, the archive is updated in place: the new files are written starting
+// at the offset of the original central directory, followed by a new central directory that has the records of the
+// existing entries and then those of the new files. The existing entries are never read or moved, so the cost of
+// appending does not depend on the size of the archive. Should this fail, the original central directory is written
+// back and the archive is truncated to its original size.
+//
+// Otherwise, the archive must be rewritten without the entries being replaced. The existing entries are not
+// decompressed and recompressed; their raw compressed bytes are located using the offsets from the central directory
+// (see NewCDScanner) and copied as-is with [zip.Writer.CreateRaw] to a temporary archive in the same directory, which
+// is then renamed to replace the original archive.
+//
+// Either way, the new files are compressed with [zip.Deflate] using the zip.Writer from CompressOptions.NewWriter, unless
+// AppendOptions.StorePolicy decides to write them with [zip.Store] instead.
+func Update(ctx context.Context, archiveName string, names []string, optFns ...func(*AppendOptions)) error {
+	return update(ctx, archiveName, names, true, optFns...)
+}
+
+// appendFile is a local file to be added to the archive.
+type appendFile struct {
+	path string
+	fi   os.FileInfo
+}
+
+func update(ctx context.Context, archiveName string, names []string, replace bool, optFns ...func(*AppendOptions)) error {
+	opts := &AppendOptions{
+		CompressOptions: CompressOptions{
+			ProgressReporter: DefaultProgressReporter,
+			BufferSize:       DefaultBufferSize,
+			NewWriter:        zip.NewWriter,
+		},
+	}
+	for _, fn := range optFns {
+		fn(opts)
+	}
+
+	// map each file to be added by its path in the archive.
+	files := make(map[string]appendFile)
+	order := make([]string, 0)
+	for _, name := range names {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("describe file (path=%s) error: %w", name, err)
+		}
+
+		if !fi.IsDir() {
+			dstPath := filepath.ToSlash(filepath.Base(name))
+			if _, ok := files[dstPath]; !ok {
+				order = append(order, dstPath)
+			}
+			files[dstPath] = appendFile{name, fi}
+			continue
+		}
+
+		base := filepath.Base(name)
+		if err = WalkRegularFiles(ctx, name, func(path string, d fs.DirEntry) error {
+			fi, err := d.Info()
+			if err != nil {
+				return fmt.Errorf("describe file (path=%s) error: %w", path, err)
+			}
+
+			rel, err := filepath.Rel(name, path)
+			if err != nil {
+				return fmt.Errorf("compute file (path=%s) name in archive error: %w", path, err)
+			}
+
+			dstPath := filepath.ToSlash(filepath.Join(base, rel))
+			if _, ok := files[dstPath]; !ok {
+				order = append(order, dstPath)
+			}
+			files[dstPath] = appendFile{path, fi}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	src, err := os.OpenFile(archiveName, os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("open zip error: %w", err)
+	}
+	defer src.Close()
+
+	fi, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("describe zip error: %w", err)
+	}
+
+	cd, err := NewCDScanner(src, fi.Size())
+	if err != nil {
+		return fmt.Errorf("scan central directory error: %w", err)
+	}
+
+	// the offset and size of the original central directory must be saved before scanning advances the offset.
+	cdOffset, cdSize, comment := cd.(*cdScanner).offset, int64(cd.(*cdScanner).size), cd.(*cdScanner).comment
+
+	headers := make([]CDFileHeader, 0, cd.RecordCount())
+	for fh := range cd.All() {
+		if _, ok := files[fh.Name]; ok {
+			if !replace {
+				return fmt.Errorf("add file (name=%s) error: %w", fh.Name, ErrFileExists)
+			}
+
+			continue
+		}
+
+		headers = append(headers, fh)
+	}
+	if err = cd.Err(); err != nil {
+		return fmt.Errorf("scan central directory error: %w", err)
+	}
+
+	if len(headers) == cd.RecordCount() {
+		if err = appendInPlace(ctx, src, fi.Size(), cdOffset, cdSize, int64(len(headers)), comment, order, files, opts); err != nil {
+			return err
+		}
+
+		if err = src.Close(); err != nil {
+			return fmt.Errorf("close archive error: %w", err)
+		}
+
+		return nil
+	}
+
+	return rewrite(ctx, archiveName, src, fi, headers, comment, order, files, opts)
+}
+
+// appendInPlace writes the new files to src starting at the offset of the original central directory, then writes the
+// new central directory.
+//
+// size is the original size of src, while cdOffset, cdSize, and records describe its original central directory, and
+// comment is the archive comment to be kept.
+func appendInPlace(ctx context.Context, src *os.File, size, cdOffset, cdSize, records int64, comment string, order []string, files map[string]appendFile, opts *AppendOptions) (err error) {
+	// everything from the original central directory onwards is kept in memory so that its records can be copied to
+	// the new central directory, and so that the archive can be restored should anything fail.
+	tail := make([]byte, size-cdOffset)
+	if _, err = src.ReadAt(tail, cdOffset); err != nil {
+		return fmt.Errorf("read central directory error: %w", err)
+	}
+	defer func() {
+		if err == nil {
+			return
+		}
+
+		_, restoreErr := src.WriteAt(tail, cdOffset)
+		if restoreErr == nil {
+			restoreErr = src.Truncate(size)
+		}
+		if restoreErr != nil {
+			err = errors.Join(err, fmt.Errorf("restore archive error: %w", restoreErr))
+		}
+	}()
+
+	// zip.Writer writes the new files followed by a central directory of only those files. SetOffset makes their local
+	// file header offsets relative to the start of the archive.
+	w := io.NewOffsetWriter(src, cdOffset)
+	zipWriter := opts.NewWriter(w)
+	zipWriter.SetOffset(cdOffset)
+
+	if err = addFiles(ctx, zipWriter, order, files, opts); err != nil {
+		return err
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		return fmt.Errorf("write central directory error: %w", err)
+	}
+
+	n, _ := w.Seek(0, io.SeekCurrent)
+	if err = src.Truncate(cdOffset + n); err != nil {
+		return fmt.Errorf("truncate archive error: %w", err)
+	}
+
+	// the new central directory is the existing records followed by the records that zip.Writer wrote.
+	cd, err := NewCDScanner(src, cdOffset+n)
+	if err != nil {
+		return fmt.Errorf("scan new central directory error: %w", err)
+	}
+
+	newCD := cd.(*cdScanner)
+	data := make([]byte, cdSize+int64(newCD.size), cdSize+int64(newCD.size)+98+int64(len(comment)))
+	copy(data, tail[:cdSize])
+	if _, err = src.ReadAt(data[cdSize:], newCD.offset); err != nil {
+		return fmt.Errorf("read new central directory error: %w", err)
+	}
+	data = appendEOCD(data, records+int64(newCD.recordCount), int64(len(data)), newCD.offset, comment)
+
+	if _, err = src.WriteAt(data, newCD.offset); err != nil {
+		return fmt.Errorf("write central directory error: %w", err)
+	}
+
+	if err = src.Truncate(newCD.offset + int64(len(data))); err != nil {
+		return fmt.Errorf("truncate archive error: %w", err)
+	}
+
+	return nil
+}
+
+// rewrite writes the existing entries in headers and the new files to a temporary archive that replaces archiveName.
+//
+// The new archive keeps the given archive comment.
+func rewrite(ctx context.Context, archiveName string, src *os.File, fi os.FileInfo, headers []CDFileHeader, comment string, order []string, files map[string]appendFile, opts *AppendOptions) error {
+	// the new archive is written to a temp file in the same directory so that it can be renamed at the end.
+	dst, err := os.CreateTemp(filepath.Dir(archiveName), filepath.Base(archiveName)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary archive error: %w", err)
+	}
+	success := false
+	defer func() {
+		if !success {
+			_, _ = dst.Close(), os.Remove(dst.Name())
+		}
+	}()
+
+	zipWriter := opts.NewWriter(dst)
+	if err = zipWriter.SetComment(comment); err != nil {
+		return fmt.Errorf("set archive comment error: %w", err)
+	}
+	buf := make([]byte, opts.BufferSize)
+
+	// copy existing entries' raw bytes.
+	lfh := make([]byte, 30)
+	for _, fh := range headers {
+		// https://en.wikipedia.org/wiki/ZIP_(file_format)#Local_file_header
+		offset := int64(fh.Offset)
+		if _, err = src.ReadAt(lfh, offset); err != nil {
+			return fmt.Errorf("read local file header (name=%s) error: %w", fh.Name, err)
+		}
+
+		n := int64(binary.LittleEndian.Uint16(lfh[26:28]))
+		m := int64(binary.LittleEndian.Uint16(lfh[28:30]))
+		raw := io.NewSectionReader(src, offset+30+n+m, int64(fh.CompressedSize64))
+
+		// zip.Writer will add its own ZIP64 extra field if needed, and would add extended timestamp extra field if
+		// Modified is non-zero. clearing Modified preserves the original MS-DOS date and time.
+		header := fh.FileHeader
+		header.Extra = removeExtraField(header.Extra, zip64ExtraID)
+		header.Modified = time.Time{}
+
+		w, err := zipWriter.CreateRaw(&header)
+		if err != nil {
+			return fmt.Errorf("create raw zip record (name=%s) error: %w", fh.Name, err)
+		}
+
+		if _, err = commons.CopyBufferWithContext(ctx, w, raw, buf); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+
+			return fmt.Errorf("copy raw zip record (name=%s) error: %w", fh.Name, err)
+		}
+	}
+
+	if err = addFiles(ctx, zipWriter, order, files, opts); err != nil {
+		return err
+	}
+
+	if err = zipWriter.Close(); err != nil {
+		return fmt.Errorf("write central directory error: %w", err)
+	}
+
+	// os.CreateTemp creates the file with mode 0600 so the original archive's permissions must be restored.
+	if err = dst.Chmod(fi.Mode().Perm()); err != nil {
+		return fmt.Errorf("change temporary archive mode error: %w", err)
+	}
+
+	if err = dst.Close(); err != nil {
+		return fmt.Errorf("close temporary archive error: %w", err)
+	}
+
+	_ = src.Close()
+
+	if err = os.Rename(dst.Name(), archiveName); err != nil {
+		return fmt.Errorf("replace archive error: %w", err)
+	}
+
+	success = true
+	return nil
+}
+
+// addFiles compresses or stores the files in the given order to zipWriter.
+func addFiles(ctx context.Context, zipWriter *zip.Writer, order []string, files map[string]appendFile, opts *AppendOptions) error {
+	pr := opts.ProgressReporter
+	buf := make([]byte, opts.BufferSize)
+
+	policy := opts.StorePolicy
+	if policy == nil {
+		policy = archive.DefaultStorePolicy
+	}
+
+	for _, dstPath := range order {
+		f := files[dstPath]
+
+		if err := func() error {
+			r, err := os.Open(f.path)
+			if err != nil {
+				return fmt.Errorf("open file (path=%s) error: %w", f.path, err)
+			}
+			defer r.Close()
+
+			// the first 512 bytes are sniffed by the StorePolicy, then written before the rest of the file.
+			sniff := make([]byte, 512)
+			n, err := io.ReadFull(r, sniff)
+			if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+				return fmt.Errorf("read file (path=%s) error: %w", f.path, err)
+			}
+			sniff = sniff[:n]
+
+			store := policy(dstPath, sniff)
+			header := fileHeader(f.fi, dstPath)
+			if header.Method = zip.Deflate; store {
+				header.Method = zip.Store
+			}
+
+			w, err := zipWriter.CreateHeader(header)
+			if err != nil {
+				return fmt.Errorf("create zip record (name=%s) for file (path=%s) error: %w", dstPath, f.path, err)
+			}
+
+			var written int64
+			start := time.Now()
+			src := io.MultiReader(bytes.NewReader(sniff), r)
+			if pr == nil {
+				written, err = commons.CopyBufferWithContext(ctx, w, src, buf)
+			} else {
+				pw := pr.CreateWriter(f.path, dstPath)
+				if written, err = commons.CopyBufferWithContext(ctx, io.MultiWriter(w, pw), src, buf); err == nil {
+					err = pw.Close()
+				}
+			}
+			if stats := opts.StoreStats; stats != nil && err == nil {
+				if store {
+					stats.StoredFiles++
+					stats.StoredBytes += written
+				} else {
+					stats.CompressedFiles++
+					stats.CompressedBytes += written
+					stats.CompressDuration += time.Since(start)
+				}
+			}
+			if err != nil {
+				if errors.Is(err, context.Canceled) {
+					return err
+				}
+
+				return fmt.Errorf("add file (path=%s) to archive file (name=%s) error: %w", f.path, dstPath, err)
+			}
+
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// appendEOCD appends to b the end of central directory record, preceded by the ZIP64 end of central directory record
+// and locator if needed, of a central directory with the given record count and size that starts at offset, followed
+// by the archive comment.
+//
+// https://en.wikipedia.org/wiki/ZIP_(file_format)#End_of_central_directory_record_(EOCD)
+func appendEOCD(b []byte, records, size, offset int64, comment string) []byte {
+	le := binary.LittleEndian
+
+	if records >= 0xFFFF || size >= 0xFFFFFFFF || offset >= 0xFFFFFFFF {
+		b = append(b, sigZip64EOCD...)
+		b = le.AppendUint64(b, 44) // size of the remaining record.
+		b = le.AppendUint16(b, 45) // version made by.
+		b = le.AppendUint16(b, 45) // version needed to extract.
+		b = le.AppendUint32(b, 0)  // number of this disk.
+		b = le.AppendUint32(b, 0)  // disk where central directory starts.
+		b = le.AppendUint64(b, uint64(records))
+		b = le.AppendUint64(b, uint64(records))
+		b = le.AppendUint64(b, uint64(size))
+		b = le.AppendUint64(b, uint64(offset))
+
+		b = append(b, sigZip64EOCDLocator...)
+		b = le.AppendUint32(b, 0) // disk where ZIP64 end of central directory record starts.
+		b = le.AppendUint64(b, uint64(offset+size))
+		b = le.AppendUint32(b, 1) // total number of disks.
+
+		// the real values are in the ZIP64 end of central directory record.
+		records, size, offset = 0xFFFF, 0xFFFFFFFF, 0xFFFFFFFF
+	}
+
+	b = append(b, sigEOCD...)
+	b = le.AppendUint16(b, 0) // number of this disk.
+	b = le.AppendUint16(b, 0) // disk where central directory starts.
+	b = le.AppendUint16(b, uint16(records))
+	b = le.AppendUint16(b, uint16(records))
+	b = le.AppendUint32(b, uint32(size))
+	b = le.AppendUint32(b, uint32(offset))
+	b = le.AppendUint16(b, uint16(len(comment)))
+	b = append(b, comment...)
+
+	return b
+}
+
+// removeExtraField returns a copy of the extra field data without the extra fields with the given header ID.
+func removeExtraField(extra []byte, id uint16) []byte {
+	res := make([]byte, 0, len(extra))
+	for len(extra) >= 4 {
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			break
+		}
+
+		if binary.LittleEndian.Uint16(extra[0:2]) != id {
+			res = append(res, extra[:4+size]...)
+		}
+
+		extra = extra[4+size:]
+	}
+
+	return res
+}
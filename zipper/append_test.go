@@ -0,0 +1,332 @@
+package zipper
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nguyengg/xy3/archive"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	// testdata/default.zip has this content:
+	//	test/a.txt
+	//	test/path/b.txt
+	//	test/another/path/c.txt
+	tests := []struct {
+		name  string
+		names []string
+		// added maps the path in the archive to the local file that has the expected content.
+		added map[string]string
+	}{
+		{
+			name:  "add new file",
+			names: []string{"testdata/my-dir/a.txt"},
+			added: map[string]string{
+				"a.txt": "testdata/my-dir/a.txt",
+			},
+		},
+		{
+			name:  "add new directory",
+			names: []string{"testdata/my-dir"},
+			added: map[string]string{
+				"my-dir/a.txt":              "testdata/my-dir/a.txt",
+				"my-dir/path/b.txt":         "testdata/my-dir/path/b.txt",
+				"my-dir/another/path/c.txt": "testdata/my-dir/another/path/c.txt",
+			},
+		},
+		{
+			// test/a.txt will be replaced with the contents of c.txt.
+			name:  "replace existing file",
+			names: []string{"testdata/test"},
+			added: map[string]string{
+				"test/a.txt": "testdata/my-dir/another/path/c.txt",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "")
+			assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+			defer os.RemoveAll(tmpDir)
+
+			// "replace existing file" needs a directory named test to replace test/a.txt.
+			names := make([]string, 0, len(tt.names))
+			for _, name := range tt.names {
+				if name == "testdata/test" {
+					name = filepath.Join(tmpDir, "test")
+					assert.NoError(t, os.Mkdir(name, 0755))
+					assert.NoError(t, copyFile("testdata/my-dir/another/path/c.txt", filepath.Join(name, "a.txt")))
+				}
+
+				names = append(names, name)
+			}
+
+			archiveName := filepath.Join(tmpDir, "default.zip")
+			assert.NoError(t, copyFile("testdata/default.zip", archiveName))
+
+			// existing entries must be copied as-is so their contents come from the original archive.
+			expected := readZip(t, archiveName)
+			for k, v := range tt.added {
+				data, err := os.ReadFile(v)
+				assert.NoError(t, err)
+				expected[k] = string(data)
+			}
+
+			err = Update(ctx, archiveName, names, func(options *AppendOptions) {
+				options.ProgressReporter = NoOpProgressReporter
+			})
+			assert.NoErrorf(t, err, "Update() error = %v", err)
+
+			assert.Equal(t, expected, readZip(t, archiveName))
+		})
+	}
+}
+
+func TestAppend_ErrFileExists(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "unwrap_root.zip")
+	assert.NoError(t, copyFile("testdata/unwrap_root.zip", archiveName))
+
+	// unwrap_root.zip already has a.txt.
+	err = Append(context.Background(), archiveName, []string{"testdata/my-dir/a.txt"})
+	assert.ErrorIs(t, err, ErrFileExists)
+
+	// the archive must be left untouched.
+	expected, err := os.ReadFile("testdata/unwrap_root.zip")
+	assert.NoError(t, err)
+	actual, err := os.ReadFile(archiveName)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestAppend_PreservesMode(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "default.zip")
+	assert.NoError(t, copyFile("testdata/default.zip", archiveName))
+	assert.NoError(t, os.Chmod(archiveName, 0644))
+
+	err = Append(context.Background(), archiveName, []string{"testdata/my-dir/a.txt"}, func(options *AppendOptions) {
+		options.ProgressReporter = NoOpProgressReporter
+	})
+	assert.NoErrorf(t, err, "Append() error = %v", err)
+
+	fi, err := os.Stat(archiveName)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+}
+
+func TestAppend_InPlace(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "default.zip")
+	assert.NoError(t, copyFile("testdata/default.zip", archiveName))
+	before, err := os.Stat(archiveName)
+	assert.NoError(t, err)
+
+	expected := readZip(t, archiveName)
+	data, err := os.ReadFile("testdata/my-dir/a.txt")
+	assert.NoError(t, err)
+	expected["a.txt"] = string(data)
+
+	err = Append(context.Background(), archiveName, []string{"testdata/my-dir/a.txt"}, func(options *AppendOptions) {
+		options.ProgressReporter = NoOpProgressReporter
+	})
+	assert.NoErrorf(t, err, "Append() error = %v", err)
+	assert.Equal(t, expected, readZip(t, archiveName))
+
+	// the archive must have been updated instead of replaced.
+	after, err := os.Stat(archiveName)
+	assert.NoError(t, err)
+	assert.True(t, os.SameFile(before, after))
+}
+
+func TestAppend_InPlaceRestoresOnError(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	archiveName := filepath.Join(tmpDir, "default.zip")
+	assert.NoError(t, copyFile("testdata/default.zip", archiveName))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = Append(ctx, archiveName, []string{"testdata/my-dir"}, func(options *AppendOptions) {
+		options.ProgressReporter = NoOpProgressReporter
+	})
+	assert.ErrorIs(t, err, context.Canceled)
+
+	// the original central directory must have been written back.
+	expected, err := os.ReadFile("testdata/default.zip")
+	assert.NoError(t, err)
+	actual, err := os.ReadFile(archiveName)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, actual)
+}
+
+func TestAppend_InPlaceZip64(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	// more than 0xFFFF records need the ZIP64 end of central directory record.
+	archiveName := filepath.Join(tmpDir, "many.zip")
+	f, err := os.Create(archiveName)
+	assert.NoError(t, err)
+	zw := zip.NewWriter(f)
+	for i := range 0xFFFF {
+		_, err = zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("%d.txt", i), Method: zip.Store})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, f.Close())
+
+	err = Append(context.Background(), archiveName, []string{"testdata/my-dir/a.txt"}, func(options *AppendOptions) {
+		options.ProgressReporter = NoOpProgressReporter
+	})
+	assert.NoErrorf(t, err, "Append() error = %v", err)
+
+	actual := readZip(t, archiveName)
+	assert.Len(t, actual, 0xFFFF+1)
+	data, err := os.ReadFile("testdata/my-dir/a.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), actual["a.txt"])
+}
+
+func TestUpdate_KeepsComment(t *testing.T) {
+	tmpDir, err := os.MkdirTemp("", "")
+	assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+	defer os.RemoveAll(tmpDir)
+
+	// copy test/a.txt from testdata/default.zip into a new archive that has a comment.
+	archiveName := filepath.Join(tmpDir, "default.zip")
+	r, err := zip.OpenReader("testdata/default.zip")
+	assert.NoError(t, err)
+	f, err := os.Create(archiveName)
+	assert.NoError(t, err)
+	w := zip.NewWriter(f)
+	assert.NoError(t, w.Copy(r.File[0]))
+	assert.NoError(t, w.SetComment("keep me"))
+	assert.NoError(t, w.Close())
+	assert.NoError(t, f.Close())
+	assert.NoError(t, r.Close())
+
+	// Append adds to the archive in-place, while Update replacing test/a.txt must rewrite the archive.
+	dir := filepath.Join(tmpDir, "test")
+	assert.NoError(t, os.Mkdir(dir, 0755))
+	assert.NoError(t, copyFile("testdata/my-dir/another/path/c.txt", filepath.Join(dir, "a.txt")))
+
+	for _, fn := range []func() error{
+		func() error {
+			return Append(context.Background(), archiveName, []string{"testdata/my-dir/a.txt"}, func(options *AppendOptions) {
+				options.ProgressReporter = NoOpProgressReporter
+			})
+		},
+		func() error {
+			return Update(context.Background(), archiveName, []string{dir}, func(options *AppendOptions) {
+				options.ProgressReporter = NoOpProgressReporter
+			})
+		},
+	} {
+		assert.NoError(t, fn())
+
+		r, err = zip.OpenReader(archiveName)
+		assert.NoError(t, err)
+		assert.Equal(t, "keep me", r.Comment)
+		assert.NoError(t, r.Close())
+	}
+
+	data, err := os.ReadFile("testdata/my-dir/another/path/c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, string(data), readZip(t, archiveName)["test/a.txt"])
+}
+
+func TestAppend_StorePolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy archive.StorePolicy
+		method uint16
+		stats  archive.StoreStats
+	}{
+		{name: "never", policy: archive.NeverStore, method: zip.Deflate, stats: archive.StoreStats{CompressedFiles: 3, CompressedBytes: 1178}},
+		{name: "always", policy: archive.AlwaysStore, method: zip.Store, stats: archive.StoreStats{StoredFiles: 3, StoredBytes: 1178}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpDir, err := os.MkdirTemp("", "")
+			assert.NoErrorf(t, err, `MkdirTemp("", "") error = %v`, err)
+			defer os.RemoveAll(tmpDir)
+
+			archiveName := filepath.Join(tmpDir, "default.zip")
+			assert.NoError(t, copyFile("testdata/default.zip", archiveName))
+
+			stats := &archive.StoreStats{}
+			err = Append(context.Background(), archiveName, []string{"testdata/my-dir"}, func(options *AppendOptions) {
+				options.ProgressReporter = NoOpProgressReporter
+				options.StorePolicy = tt.policy
+				options.StoreStats = stats
+			})
+			assert.NoErrorf(t, err, "Append() error = %v", err)
+
+			stats.CompressDuration = 0
+			assert.Equal(t, tt.stats, *stats)
+
+			r, err := zip.OpenReader(archiveName)
+			assert.NoError(t, err)
+			defer r.Close()
+			for _, f := range r.File {
+				if strings.HasPrefix(f.Name, "my-dir/") {
+					assert.Equalf(t, tt.method, f.Method, "method of %s", f.Name)
+				}
+			}
+		})
+	}
+}
+
+func readZip(t *testing.T, name string) map[string]string {
+	r, err := zip.OpenReader(name)
+	assert.NoErrorf(t, err, "zip.OpenReader() error = %v", err)
+	defer r.Close()
+
+	m := make(map[string]string)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		assert.NoErrorf(t, err, "zip.File.Open() error = %v", err)
+
+		data, err := io.ReadAll(rc)
+		assert.NoErrorf(t, err, "read from zip file error = %v", err)
+		_ = rc.Close()
+
+		m[f.Name] = string(data)
+	}
+
+	return m
+}
+
+func copyFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(dst, data, 0644)
+}
@@ -73,14 +73,35 @@ func NewCDScanner(src io.ReadSeeker, size int64) (CDScanner, error) {
 		}
 
 		if i := bytes.LastIndex(buf, sigEOCD); i != -1 {
-			if i+20 > len(buf) {
+			if i+22 > len(buf) {
 				return nil, fmt.Errorf("invalid EOCD")
 			}
 
 			cd := &cdScanner{src: src}
 			cd.recordCount = int(binary.LittleEndian.Uint16(buf[i+10 : i+12]))
-			cd.size = int(binary.LittleEndian.Uint16(buf[i+12 : i+14]))
+			cd.size = int(binary.LittleEndian.Uint32(buf[i+12 : i+16]))
 			cd.offset = int64(binary.LittleEndian.Uint32(buf[i+16 : i+20]))
+
+			// the archive comment immediately follows the EOCD.
+			if n := int(binary.LittleEndian.Uint16(buf[i+20 : i+22])); n > 0 {
+				comment := make([]byte, n)
+				if _, err = src.Seek(offset+int64(i)+22, io.SeekStart); err == nil {
+					_, err = io.ReadFull(src, comment)
+				}
+				if err != nil {
+					return nil, fmt.Errorf("read archive comment error: %w", err)
+				}
+
+				cd.comment = string(comment)
+			}
+
+			// saturated values indicate that the real values are in the ZIP64 end of central directory record.
+			if cd.recordCount == 0xFFFF || cd.size == 0xFFFFFFFF || cd.offset == 0xFFFFFFFF {
+				if err = cd.readZip64EOCD(offset + int64(i)); err != nil {
+					return nil, err
+				}
+			}
+
 			return cd, nil
 		}
 
@@ -100,10 +121,47 @@ type cdScanner struct {
 	recordCount int
 	size        int
 	offset      int64
+	comment     string
 	err         error
 	eof         bool
 }
 
+// readZip64EOCD uses the ZIP64 end of central directory locator immediately preceding the EOCD at the given offset to
+// read the record count, size, and offset of the central directory.
+//
+// https://en.wikipedia.org/wiki/ZIP_(file_format)#ZIP64
+func (s *cdScanner) readZip64EOCD(eocdOffset int64) (err error) {
+	if eocdOffset < 20 {
+		return fmt.Errorf("invalid ZIP64 EOCD locator")
+	}
+
+	data := make([]byte, 56)
+	if _, err = s.src.Seek(eocdOffset-20, io.SeekStart); err != nil {
+		return fmt.Errorf("seek ZIP64 EOCD locator error: %w", err)
+	}
+	if _, err = io.ReadFull(s.src, data[:20]); err != nil {
+		return fmt.Errorf("read ZIP64 EOCD locator error: %w", err)
+	}
+	if !bytes.Equal(data[:4], sigZip64EOCDLocator) {
+		return fmt.Errorf("invalid ZIP64 EOCD locator signature")
+	}
+
+	if _, err = s.src.Seek(int64(binary.LittleEndian.Uint64(data[8:16])), io.SeekStart); err != nil {
+		return fmt.Errorf("seek ZIP64 EOCD error: %w", err)
+	}
+	if _, err = io.ReadFull(s.src, data); err != nil {
+		return fmt.Errorf("read ZIP64 EOCD error: %w", err)
+	}
+	if !bytes.Equal(data[:4], sigZip64EOCD) {
+		return fmt.Errorf("invalid ZIP64 EOCD signature")
+	}
+
+	s.recordCount = int(binary.LittleEndian.Uint64(data[32:40]))
+	s.size = int(binary.LittleEndian.Uint64(data[40:48]))
+	s.offset = int64(binary.LittleEndian.Uint64(data[48:56]))
+	return nil
+}
+
 func (s *cdScanner) RecordCount() int {
 	return s.recordCount
 }
@@ -131,7 +189,8 @@ func (s *cdScanner) Next() (ok bool, fh CDFileHeader) {
 	}
 
 	if j := bytes.Index(bb.B, sigCDFH); j != 0 {
-		if j = bytes.Index(bb.B, sigEOCD); j == 0 {
+		// ZIP64 archives have the ZIP64 end of central directory record immediately after the central directory.
+		if bytes.HasPrefix(bb.B, sigEOCD) || bytes.HasPrefix(bb.B, sigZip64EOCD) {
 			return
 		}
 
@@ -168,7 +227,7 @@ func (s *cdScanner) All() iter.Seq[CDFileHeader] {
 			}
 
 			if j := bytes.Index(bb.B, sigCDFH); j != 0 {
-				if j = bytes.Index(bb.B, sigEOCD); j == 0 {
+				if bytes.HasPrefix(bb.B, sigEOCD) || bytes.HasPrefix(bb.B, sigZip64EOCD) {
 					return
 				}
 
@@ -222,8 +281,48 @@ func toFileHeader(data []byte) (fh CDFileHeader) {
 	m := int(data[30]) | int(data[31])<<8
 	k := int(data[32]) | int(data[33])<<8
 	fh.Name = string(data[46 : 46+n])
-	fh.Comment = string(data[46+n : 46+n+m])
-	fh.Extra = data[46+n+m : 46+n+m+k]
+	fh.Extra = data[46+n : 46+n+m]
+	fh.Comment = string(data[46+n+m : 46+n+m+k])
+
+	// saturated sizes and offset mean the real values are in the ZIP64 extended information extra field, and only
+	// the saturated values are present in the extra field in this specific order.
+	//
+	// https://en.wikipedia.org/wiki/ZIP_(file_format)#ZIP64
+	needUncompressedSize := fh.UncompressedSize64 == 0xFFFFFFFF
+	needCompressedSize := fh.CompressedSize64 == 0xFFFFFFFF
+	needOffset := fh.Offset == 0xFFFFFFFF
+	if !needUncompressedSize && !needCompressedSize && !needOffset {
+		return
+	}
+
+	for extra := fh.Extra; len(extra) >= 4; {
+		id := binary.LittleEndian.Uint16(extra[0:2])
+		size := int(binary.LittleEndian.Uint16(extra[2:4]))
+		if len(extra) < 4+size {
+			break
+		}
+
+		if id != zip64ExtraID {
+			extra = extra[4+size:]
+			continue
+		}
+
+		field := extra[4 : 4+size]
+		if needUncompressedSize && len(field) >= 8 {
+			fh.UncompressedSize64 = binary.LittleEndian.Uint64(field[:8])
+			field = field[8:]
+		}
+		if needCompressedSize && len(field) >= 8 {
+			fh.CompressedSize64 = binary.LittleEndian.Uint64(field[:8])
+			field = field[8:]
+		}
+		if needOffset && len(field) >= 8 {
+			fh.Offset = binary.LittleEndian.Uint64(field[:8])
+		}
+
+		break
+	}
+
 	return
 }
 
@@ -249,12 +348,19 @@ func msDosTimeToTime(dosDate, dosTime uint16) time.Time {
 	)
 }
 
+// zip64ExtraID is the header ID of the ZIP64 extended information extra field.
+const zip64ExtraID = 0x0001
+
 var (
-	sigCDFH = make([]byte, 4)
-	sigEOCD = make([]byte, 4)
+	sigCDFH             = make([]byte, 4)
+	sigEOCD             = make([]byte, 4)
+	sigZip64EOCD        = make([]byte, 4)
+	sigZip64EOCDLocator = make([]byte, 4)
 )
 
 func init() {
 	binary.LittleEndian.PutUint32(sigCDFH, 0x02014b50)
 	binary.LittleEndian.PutUint32(sigEOCD, 0x06054b50)
+	binary.LittleEndian.PutUint32(sigZip64EOCD, 0x06064b50)
+	binary.LittleEndian.PutUint32(sigZip64EOCDLocator, 0x07064b50)
 }